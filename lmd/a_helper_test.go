@@ -281,6 +281,9 @@ func prepareTmpDataHostService(dataFolder string, tempFolder string, table *Tabl
 
 var TestPeerWaitGroup *sync.WaitGroup
 
+// runningTestPeer is the test peer which has not been stopped yet
+var runningTestPeer *Peer
+
 func StartMockMainLoop(sockets []string, extraConfig string) {
 	nodeAccessor = nil
 	var testConfig = `
@@ -330,6 +333,12 @@ func StartTestPeer(numPeers int, numHosts int, numServices int) *Peer {
 // It returns a peer with the "mainloop" connection configured
 // if numServices is  0, empty test data will be used
 func StartTestPeerExtra(numPeers int, numHosts int, numServices int, extraConfig string) (peer *Peer) {
+	// some tests do not stop their peer, it would block waiting for later peers otherwise
+	if runningTestPeer != nil {
+		if err := StopTestPeer(runningTestPeer); err != nil {
+			panic(err.Error())
+		}
+	}
 	sockets := []string{}
 	for i := 0; i < numPeers; i++ {
 		listen := StartMockLivestatusSource(i, numHosts, numServices)
@@ -359,10 +368,12 @@ func StartTestPeerExtra(numPeers int, numHosts int, numServices int, extraConfig
 		}
 	}
 
+	runningTestPeer = peer
 	return
 }
 
 func StopTestPeer(peer *Peer) (err error) {
+	runningTestPeer = nil
 	// stop the mock servers
 	_, _, err = peer.QueryString("COMMAND [0] MOCK_EXIT")
 	if err != nil {
@@ -389,6 +400,43 @@ func PauseTestPeers(peer *Peer) {
 	}
 }
 
+// updateTestRow changes a single dynamic column of the row with the given primary key
+// by running a delta update, just like a regular update from the backend.
+func updateTestRow(ds *DataStoreSet, table TableName, key []string, column string, value interface{}) error {
+	store := ds.Get(table)
+	ds.Lock.RLock()
+	var row *DataRow
+	switch len(key) {
+	case 1:
+		row = store.Index[key[0]]
+	case 2:
+		row = store.Index2[key[0]][key[1]]
+	}
+	if row == nil {
+		ds.Lock.RUnlock()
+		return fmt.Errorf("no %s row found for %v", table.String(), key)
+	}
+	col := store.GetColumn(column)
+	found := false
+	update := make([]interface{}, 0, len(key)+len(store.DynamicColumnCache))
+	for _, k := range key {
+		update = append(update, k)
+	}
+	for _, c := range store.DynamicColumnCache {
+		val := row.GetValueByColumn(c)
+		if c == col {
+			val = value
+			found = true
+		}
+		update = append(update, val)
+	}
+	ds.Lock.RUnlock()
+	if !found {
+		return fmt.Errorf("%s is not a dynamic column of %s", column, table.String())
+	}
+	return ds.insertDeltaDataResult(len(key), ResultSet{update}, &ResultMetaData{Request: &Request{}}, store)
+}
+
 func CheckOpenFilesLimit(b *testing.B, minimum uint64) {
 	b.Helper()
 	var rLimit syscall.Rlimit
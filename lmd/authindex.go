@@ -0,0 +1,237 @@
+package main
+
+import (
+	"time"
+)
+
+// AuthIndex contains the precomputed visibility of hosts, services and groups for each contact.
+// Contacts and group members are static columns, so the index is built once after all
+// references have been set and replaced together with the DataStoreSet on reloads.
+type AuthIndex struct {
+	serviceAuth string // ServiceAuthorization used to build this index
+	groupAuth   string // GroupAuthorization used to build this index
+	contacts    map[string]*AuthContactIndex
+}
+
+// AuthContactIndex contains all objects visible to a single contact.
+type AuthContactIndex struct {
+	hosts         map[string]bool
+	services      map[string]map[string]bool
+	hostgroups    map[string]bool
+	servicegroups map[string]bool
+	hostRows      []*DataRow // visible hosts in the order of the hosts store
+	serviceRows   []*DataRow // visible services in the order of the services store
+}
+
+// NewAuthIndex creates the auth index for all contacts from the hosts, services and groups of the DataStoreSet.
+// It returns nil if the required tables are not available.
+func NewAuthIndex(ds *DataStoreSet) *AuthIndex {
+	hosts := ds.tables[TableHosts]
+	services := ds.tables[TableServices]
+	if hosts == nil || services == nil || ds.peer == nil {
+		return nil
+	}
+	t1 := time.Now()
+	idx := &AuthIndex{
+		serviceAuth: ds.peer.GlobalConfig.ServiceAuthorization,
+		groupAuth:   ds.peer.GlobalConfig.GroupAuthorization,
+		contacts:    make(map[string]*AuthContactIndex),
+	}
+
+	hostNameCol := hosts.GetColumn("name")
+	for _, row := range hosts.Data {
+		hostName := row.GetString(hostNameCol)
+		for _, contact := range idx.hostContacts(ds, hostName) {
+			c := idx.contact(contact)
+			if !c.hosts[hostName] {
+				c.hosts[hostName] = true
+				c.hostRows = append(c.hostRows, row)
+			}
+		}
+	}
+
+	svcHostNameCol := services.GetColumn("host_name")
+	svcDescriptionCol := services.GetColumn("description")
+	for _, row := range services.Data {
+		hostName := row.GetString(svcHostNameCol)
+		description := row.GetString(svcDescriptionCol)
+		for _, contact := range idx.serviceContacts(ds, hostName, description) {
+			c := idx.contact(contact)
+			if c.services[hostName][description] {
+				continue
+			}
+			if _, ok := c.services[hostName]; !ok {
+				c.services[hostName] = make(map[string]bool)
+			}
+			c.services[hostName][description] = true
+			c.serviceRows = append(c.serviceRows, row)
+		}
+	}
+
+	if store := ds.tables[TableHostgroups]; store != nil {
+		nameCol := store.GetColumn("name")
+		membersCol := store.GetColumn("members")
+		for _, row := range store.Data {
+			name := row.GetString(nameCol)
+			members := row.GetStringList(membersCol)
+			count := make(map[string]int)
+			for _, hostName := range members {
+				for _, contact := range idx.hostContacts(ds, hostName) {
+					count[contact]++
+				}
+			}
+			for _, contact := range idx.groupContacts(count, len(members)) {
+				idx.contacts[contact].hostgroups[name] = true
+			}
+		}
+	}
+
+	if store := ds.tables[TableServicegroups]; store != nil {
+		nameCol := store.GetColumn("name")
+		membersCol := store.GetColumn("members")
+		for _, row := range store.Data {
+			name := row.GetString(nameCol)
+			members := row.GetServiceMemberList(membersCol)
+			count := make(map[string]int)
+			for _, member := range members {
+				for _, contact := range idx.serviceContacts(ds, member[0], member[1]) {
+					count[contact]++
+				}
+			}
+			for _, contact := range idx.groupContacts(count, len(members)) {
+				idx.contacts[contact].servicegroups[name] = true
+			}
+		}
+	}
+
+	logWith(ds).Debugf("auth index for %d contacts created in %s", len(idx.contacts), time.Since(t1).Truncate(time.Microsecond))
+	return idx
+}
+
+// contact returns the index entry for the given contact and creates it if necessary
+func (idx *AuthIndex) contact(name string) *AuthContactIndex {
+	c, ok := idx.contacts[name]
+	if !ok {
+		c = &AuthContactIndex{
+			hosts:         make(map[string]bool),
+			services:      make(map[string]map[string]bool),
+			hostgroups:    make(map[string]bool),
+			servicegroups: make(map[string]bool),
+		}
+		idx.contacts[name] = c
+	}
+	return c
+}
+
+// hostContacts returns the unique contacts of the given host
+func (idx *AuthIndex) hostContacts(ds *DataStoreSet, hostName string) []string {
+	hosts := ds.tables[TableHosts]
+	row, ok := hosts.Index[hostName]
+	if !ok {
+		return nil
+	}
+	return uniqueStrings(row.GetStringList(hosts.GetColumn("contacts")))
+}
+
+// serviceContacts returns the unique contacts which can see the given service.
+// With loose ServiceAuthorization this includes the contacts of the host.
+func (idx *AuthIndex) serviceContacts(ds *DataStoreSet, hostName string, description string) []string {
+	services := ds.tables[TableServices]
+	row, ok := services.Index2[hostName][description]
+	if !ok {
+		return nil
+	}
+	contacts := row.GetStringList(services.GetColumn("contacts"))
+	if idx.serviceAuth == AuthLoose {
+		contacts = append(append([]string{}, contacts...), idx.hostContacts(ds, hostName)...)
+	}
+	return uniqueStrings(contacts)
+}
+
+// groupContacts returns the contacts which can see any (loose) or all (strict) members of a group
+func (idx *AuthIndex) groupContacts(count map[string]int, numMembers int) (contacts []string) {
+	for contact, num := range count {
+		if idx.groupAuth == AuthLoose || num == numMembers {
+			contacts = append(contacts, contact)
+		}
+	}
+	return
+}
+
+// isUsable returns true if the index has been built with the current authorization settings
+func (idx *AuthIndex) isUsable(conf *Config) bool {
+	return idx != nil && conf.ServiceAuthorization == idx.serviceAuth && conf.GroupAuthorization == idx.groupAuth
+}
+
+// isAuthorizedFor returns true if the contact can see the host or service
+func (idx *AuthIndex) isAuthorizedFor(authUser string, host string, service string) bool {
+	c, ok := idx.contacts[authUser]
+	if !ok {
+		return false
+	}
+	if (service != "" && idx.serviceAuth == AuthLoose) || service == "" {
+		if c.hosts[host] {
+			return true
+		}
+	}
+	if service == "" {
+		return false
+	}
+	return c.services[host][service]
+}
+
+// isAuthorizedForHostGroup returns true if the contact can see the hostgroup
+func (idx *AuthIndex) isAuthorizedForHostGroup(authUser string, hostgroup string) bool {
+	c, ok := idx.contacts[authUser]
+	return ok && c.hostgroups[hostgroup]
+}
+
+// isAuthorizedForServiceGroup returns true if the contact can see the servicegroup
+func (idx *AuthIndex) isAuthorizedForServiceGroup(authUser string, servicegroup string) bool {
+	c, ok := idx.contacts[authUser]
+	return ok && c.servicegroups[servicegroup]
+}
+
+// GetPreFilteredDataAuth returns the same as GetPreFilteredDataIndex but uses the auth index
+// for hosts and services if it results in less rows to scan.
+func (d *DataStore) GetPreFilteredDataAuth(filter []*Filter, authUser string) (data []*DataRow, index string) {
+	data, index = d.GetPreFilteredDataIndex(filter)
+	if authUser == "" || d.DataSet == nil {
+		return
+	}
+	idx := d.DataSet.authIndex
+	if !idx.isUsable(d.Peer.GlobalConfig) {
+		return
+	}
+	var authRows []*DataRow
+	switch d.Table.Name {
+	case TableHosts:
+		if c, ok := idx.contacts[authUser]; ok {
+			authRows = c.hostRows
+		}
+	case TableServices:
+		if c, ok := idx.contacts[authUser]; ok {
+			authRows = c.serviceRows
+		}
+	default:
+		return
+	}
+	if len(authRows) >= len(data) {
+		return
+	}
+	log.Tracef("using auth index for %s with dataset of size: %d", authUser, len(authRows))
+	return authRows, "authuser"
+}
+
+// uniqueStrings returns the list without duplicate entries
+func uniqueStrings(list []string) []string {
+	uniq := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			uniq = append(uniq, s)
+		}
+	}
+	return uniq
+}
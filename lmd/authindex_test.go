@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAuthIndex(t *testing.T) {
+	peer := StartTestPeer(1, 2, 2)
+	PauseTestPeers(peer)
+
+	PeerMapLock.RLock()
+	p := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+
+	ds, err := p.GetDataStoreSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.authIndex == nil {
+		t.Fatal("auth index has not been created")
+	}
+
+	ds.Lock.RLock()
+	hosts := ds.tables[TableHosts]
+	services := ds.tables[TableServices]
+	hostgroups := ds.tables[TableHostgroups]
+	servicegroups := ds.tables[TableServicegroups]
+	row := hosts.Data[0]
+
+	// compare index results with walking the contact lists
+	index := ds.authIndex
+	for _, strict := range []bool{false, true} {
+		for _, user := range []string{"authuser", "example", "nobody"} {
+			for _, host := range hosts.Data {
+				ds.authIndex = index
+				indexed := row.isAuthorizedFor(user, host.GetStringByName("name"), "")
+				ds.authIndex = nil
+				if err = assertEq(row.isAuthorizedFor(user, host.GetStringByName("name"), ""), indexed); err != nil {
+					t.Errorf("host %s for %s: %s", host.GetStringByName("name"), user, err)
+				}
+			}
+			for _, svc := range services.Data {
+				ds.authIndex = index
+				indexed := row.isAuthorizedFor(user, svc.GetStringByName("host_name"), svc.GetStringByName("description"))
+				ds.authIndex = nil
+				if err = assertEq(row.isAuthorizedFor(user, svc.GetStringByName("host_name"), svc.GetStringByName("description")), indexed); err != nil {
+					t.Errorf("service %s for %s: %s", svc.GetStringByName("description"), user, err)
+				}
+			}
+			for _, group := range hostgroups.Data {
+				ds.authIndex = index
+				indexed := row.isAuthorizedForHostGroup(user, group.GetStringByName("name"))
+				ds.authIndex = nil
+				if err = assertEq(row.isAuthorizedForHostGroup(user, group.GetStringByName("name")), indexed); err != nil {
+					t.Errorf("hostgroup %s for %s: %s", group.GetStringByName("name"), user, err)
+				}
+			}
+			for _, group := range servicegroups.Data {
+				ds.authIndex = index
+				indexed := row.isAuthorizedForServiceGroup(user, group.GetStringByName("name"))
+				ds.authIndex = nil
+				if err = assertEq(row.isAuthorizedForServiceGroup(user, group.GetStringByName("name")), indexed); err != nil {
+					t.Errorf("servicegroup %s for %s: %s", group.GetStringByName("name"), user, err)
+				}
+			}
+		}
+		if !strict {
+			// rebuild with strict service and loose group authorization
+			p.GlobalConfig.ServiceAuthorization = AuthStrict
+			p.GlobalConfig.GroupAuthorization = AuthLoose
+			if index.isUsable(p.GlobalConfig) {
+				t.Error("index should not be used after changing the authorization settings")
+			}
+			index = NewAuthIndex(ds)
+		}
+	}
+	p.GlobalConfig.ServiceAuthorization = AuthLoose
+	p.GlobalConfig.GroupAuthorization = AuthStrict
+	ds.authIndex = NewAuthIndex(ds)
+
+	// auth index is used as pre filter
+	data, name := hosts.GetPreFilteredDataAuth([]*Filter{}, "authuser")
+	if err = assertEq("authuser", name); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(1, len(data)); err != nil {
+		t.Error(err)
+	}
+	data, _ = hosts.GetPreFilteredDataAuth([]*Filter{}, "nobody")
+	if err = assertEq(0, len(data)); err != nil {
+		t.Error(err)
+	}
+	ds.Lock.RUnlock()
+
+	res, _, err := peer.QueryString("GET services\nColumns: host_name description\nAuthUser: authuser\nOutputFormat: json\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res)); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
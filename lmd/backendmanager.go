@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sasha-s/go-deadlock"
+)
+
+// BackendStopTimeout sets the timeout when waiting for a paused backend to stop
+const BackendStopTimeout = 10 * time.Second
+
+var reBackendCommand = regexp.MustCompile(`^COMMAND +\[\d+\] +(LMD_(?:ADD|UPDATE|REMOVE|PAUSE|RESUME)_BACKEND);(.*)$`)
+
+// backendManager handles runtime changes of the backends, set by initializePeers
+var backendManager *BackendManager
+
+// BackendManager adds, updates, pauses, resumes and removes peers at runtime without reloading.
+type BackendManager struct {
+	noCopy          noCopy
+	lock            *deadlock.Mutex // serializes changes and writes to the BackendConfigFile
+	config          *Config
+	waitGroup       *sync.WaitGroup
+	shutdownChannel chan bool
+}
+
+// backendConfig is the content of the BackendConfigFile
+type backendConfig struct {
+	RemovedConnections []string
+	Connections        []Connection
+}
+
+// NewBackendManager creates a new BackendManager which starts new peers with the given config.
+func NewBackendManager(localConfig *Config, waitGroup *sync.WaitGroup, shutdownChannel chan bool) *BackendManager {
+	return &BackendManager{
+		lock:            new(deadlock.Mutex),
+		config:          localConfig,
+		waitGroup:       waitGroup,
+		shutdownChannel: shutdownChannel,
+	}
+}
+
+// Add creates and starts a new peer.
+// Changes are persisted first, so a failed write does not change the running backends.
+func (m *BackendManager) Add(c *Connection) error {
+	if err := m.prepareConnection(c); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	PeerMapLock.RLock()
+	_, exists := PeerMap[c.ID]
+	PeerMapLock.RUnlock()
+	if exists {
+		return fmt.Errorf("backend %s exists already", c.ID)
+	}
+
+	err := m.persist(func(bc *backendConfig) {
+		bc.setConnection(c)
+	})
+	if err != nil {
+		return err
+	}
+
+	PeerMapLock.Lock()
+	p := NewPeer(m.config, c, m.waitGroup, m.shutdownChannel)
+	PeerMap[c.ID] = p
+	PeerMapOrder = append(PeerMapOrder, c.ID)
+	PeerMapLock.Unlock()
+
+	nodeAccessor.AddBackend(c.ID)
+	logWith(p).Infof("adding backend")
+	p.Start()
+	return nil
+}
+
+// Update replaces the peer with a new one using the changed connection settings.
+// Paused peers stay paused.
+func (m *BackendManager) Update(c *Connection) error {
+	if err := m.prepareConnection(c); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	PeerMapLock.RLock()
+	old, err := m.getPeer(c.ID)
+	PeerMapLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	if c.Equals(old.Config) {
+		return nil
+	}
+
+	err = m.persist(func(bc *backendConfig) {
+		bc.setConnection(c)
+	})
+	if err != nil {
+		return err
+	}
+
+	PeerMapLock.Lock()
+	old, err = m.getPeer(c.ID)
+	if err != nil {
+		PeerMapLock.Unlock()
+		return err
+	}
+	paused := old.StatusGet(Paused).(bool)
+	p := NewPeer(m.config, c, m.waitGroup, m.shutdownChannel)
+	PeerMap[c.ID] = p
+	oldPeers := append(m.removeSubPeers(c.ID), old)
+	PeerMapLock.Unlock()
+
+	logWith(p).Infof("updating backend")
+	for _, peer := range oldPeers {
+		peer.Stop()
+		peer.ClearData(true)
+	}
+	if !paused {
+		p.Start()
+	}
+	return nil
+}
+
+// Remove stops the peer and its sub peers and removes them.
+func (m *BackendManager) Remove(id string) error {
+	if err := m.checkMode(); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	PeerMapLock.RLock()
+	_, err := m.getPeer(id)
+	PeerMapLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	err = m.persist(func(bc *backendConfig) {
+		bc.removeConnection(id)
+	})
+	if err != nil {
+		return err
+	}
+
+	PeerMapLock.Lock()
+	p, err := m.getPeer(id)
+	if err != nil {
+		PeerMapLock.Unlock()
+		return err
+	}
+	peers := append(m.removeSubPeers(id), p)
+	PeerMapRemove(id)
+	PeerMapLock.Unlock()
+
+	nodeAccessor.RemoveBackend(id)
+	logWith(p).Infof("removing backend")
+	for _, peer := range peers {
+		peer.Stop()
+		peer.ClearData(true)
+	}
+	return nil
+}
+
+// Pause stops updating the peer and its sub peers. The last fetched data is still served.
+func (m *BackendManager) Pause(id string) error {
+	if err := m.checkMode(); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	PeerMapLock.RLock()
+	p, err := m.getPeer(id)
+	peers := m.subPeers(id)
+	PeerMapLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	if p.StatusGet(Paused).(bool) {
+		return fmt.Errorf("backend %s is already paused", id)
+	}
+
+	logWith(p).Infof("pausing backend")
+	for _, peer := range append(peers, p) {
+		peer.Stop()
+	}
+	// wait till the update loops have finished, so the peers can be resumed
+	t1 := time.Now()
+	for _, peer := range append(peers, p) {
+		for !peer.StatusGet(Paused).(bool) {
+			if time.Since(t1) > BackendStopTimeout {
+				return fmt.Errorf("timeout while waiting for backend %s to stop", peer.ID)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// Resume starts updating a paused peer and its sub peers again.
+func (m *BackendManager) Resume(id string) error {
+	if err := m.checkMode(); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	PeerMapLock.RLock()
+	p, err := m.getPeer(id)
+	peers := m.subPeers(id)
+	PeerMapLock.RUnlock()
+	if err != nil {
+		return err
+	}
+	if !p.StatusGet(Paused).(bool) {
+		return fmt.Errorf("backend %s is not paused", id)
+	}
+
+	logWith(p).Infof("resuming backend")
+	for _, peer := range append(peers, p) {
+		if peer.StatusGet(Paused).(bool) {
+			peer.Start()
+		}
+	}
+	return nil
+}
+
+// Command runs one of the LMD_*_BACKEND commands. Add and update expect the
+// connection as json, all other commands the backend id.
+func (m *BackendManager) Command(name string, args string) error {
+	switch name {
+	case "LMD_ADD_BACKEND", "LMD_UPDATE_BACKEND":
+		c, err := parseConnectionJSON(strings.NewReader(args))
+		if err != nil {
+			return err
+		}
+		if name == "LMD_ADD_BACKEND" {
+			return m.Add(c)
+		}
+		return m.Update(c)
+	case "LMD_REMOVE_BACKEND":
+		return m.Remove(strings.TrimSpace(args))
+	case "LMD_PAUSE_BACKEND":
+		return m.Pause(strings.TrimSpace(args))
+	case "LMD_RESUME_BACKEND":
+		return m.Resume(strings.TrimSpace(args))
+	}
+	return fmt.Errorf("unknown backend command: %s", name)
+}
+
+// checkMode returns an error if backends cannot be changed at runtime.
+func (m *BackendManager) checkMode() error {
+	if nodeAccessor != nil && nodeAccessor.IsClustered() {
+		return fmt.Errorf("changing backends at runtime is not supported in cluster mode")
+	}
+	return nil
+}
+
+// prepareConnection validates the connection and completes its sources.
+func (m *BackendManager) prepareConnection(c *Connection) error {
+	if err := m.checkMode(); err != nil {
+		return err
+	}
+	switch {
+	case c.ID == "":
+		return fmt.Errorf("backend requires an id")
+	case c.Name == "":
+		return fmt.Errorf("backend %s requires a name", c.ID)
+	case len(c.Source) == 0:
+		return fmt.Errorf("backend %s requires at least one source", c.ID)
+	}
+	for i := range c.Source {
+		if strings.HasPrefix(c.Source[i], "http") {
+			c.Source[i] = completePeerHTTPAddr(c.Source[i])
+		}
+	}
+	c.validateOverrides()
+	if c.TLSCertificate != "" || c.TLSCA != "" {
+		tmpPeer := &Peer{Config: c, GlobalConfig: m.config}
+		if _, err := tmpPeer.getTLSClientConfig(); err != nil {
+			return fmt.Errorf("backend %s: %s", c.ID, err.Error())
+		}
+	}
+	return nil
+}
+
+// getPeer returns the peer for the given id, sub peers cannot be changed directly.
+// The caller must hold the PeerMapLock.
+func (m *BackendManager) getPeer(id string) (*Peer, error) {
+	p, ok := PeerMap[id]
+	if !ok {
+		return nil, fmt.Errorf("backend %s does not exist", id)
+	}
+	if p.ParentID != "" {
+		return nil, fmt.Errorf("backend %s is a sub peer of %s and cannot be changed", id, p.ParentID)
+	}
+	return p, nil
+}
+
+// subPeers returns all sub peers of the given peer id.
+// The caller must hold the PeerMapLock.
+func (m *BackendManager) subPeers(id string) (peers []*Peer) {
+	for _, subID := range PeerMapOrder {
+		if p, ok := PeerMap[subID]; ok && p.ParentID == id {
+			peers = append(peers, p)
+		}
+	}
+	return
+}
+
+// removeSubPeers removes all sub peers of the given peer id from the PeerMap and returns them.
+// The caller must hold the PeerMapLock.
+func (m *BackendManager) removeSubPeers(id string) (peers []*Peer) {
+	peers = m.subPeers(id)
+	for _, p := range peers {
+		PeerMapRemove(p.ID)
+	}
+	return
+}
+
+// persist applies the change to the BackendConfigFile if configured
+func (m *BackendManager) persist(change func(*backendConfig)) error {
+	if m.config.BackendConfigFile == "" {
+		return nil
+	}
+	bc, err := readBackendConfigFile(m.config.BackendConfigFile)
+	if err != nil {
+		return err
+	}
+	change(bc)
+	return writeBackendConfigFile(m.config.BackendConfigFile, bc)
+}
+
+// setConnection adds or replaces the connection
+func (bc *backendConfig) setConnection(c *Connection) {
+	bc.RemovedConnections = removeFromList(bc.RemovedConnections, c.ID)
+	for i := range bc.Connections {
+		if bc.Connections[i].ID == c.ID {
+			bc.Connections[i] = *c
+			return
+		}
+	}
+	bc.Connections = append(bc.Connections, *c)
+}
+
+// removeConnection removes the connection and hides connections with the same id from the main config files
+func (bc *backendConfig) removeConnection(id string) {
+	for i := range bc.Connections {
+		if bc.Connections[i].ID == id {
+			bc.Connections = append(bc.Connections[:i], bc.Connections[i+1:]...)
+			break
+		}
+	}
+	bc.RemovedConnections = append(removeFromList(bc.RemovedConnections, id), id)
+}
+
+// apply merges the runtime changes into the connections from the main config files
+func (bc *backendConfig) apply(conf *Config) {
+	connections := make([]Connection, 0, len(conf.Connections)+len(bc.Connections))
+	for i := range conf.Connections {
+		c := conf.Connections[i]
+		removed := false
+		for _, id := range bc.RemovedConnections {
+			if id == c.ID {
+				removed = true
+				log.Debugf("connection %s has been removed at runtime", c.ID)
+				break
+			}
+		}
+		for j := range bc.Connections {
+			if bc.Connections[j].ID == c.ID {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			connections = append(connections, c)
+		}
+	}
+	conf.Connections = append(connections, bc.Connections...)
+}
+
+// readBackendConfigFile reads the runtime changes from the given file, a missing file contains no changes.
+func readBackendConfigFile(file string) (*backendConfig, error) {
+	bc := &backendConfig{}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return bc, nil
+	}
+	if _, err := toml.DecodeFile(file, bc); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return bc, nil
+}
+
+// writeBackendConfigFile replaces the given file atomically
+func writeBackendConfigFile(file string, bc *backendConfig) error {
+	buf := bytes.NewBufferString("# this file is managed by lmd, changes will be overwritten\n\n")
+	if err := toml.NewEncoder(buf).Encode(bc); err != nil {
+		return fmt.Errorf("failed to encode backends: %w", err)
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err = tmpFile.Write(buf.Bytes()); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	if err = tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	if err = os.Rename(tmpFile.Name(), file); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// parseBackendCommand returns the name and arguments if the command is one of the LMD_*_BACKEND commands
+func parseBackendCommand(command string) (name string, args string, ok bool) {
+	matched := reBackendCommand.FindStringSubmatch(strings.TrimSpace(command))
+	if len(matched) != 3 {
+		return "", "", false
+	}
+	return matched[1], matched[2], true
+}
+
+// getBackendManager returns the backendManager or an error if backends cannot be changed at runtime
+func getBackendManager() (*BackendManager, error) {
+	if backendManager == nil || flagImport != "" {
+		return nil, fmt.Errorf("changing backends at runtime is not available")
+	}
+	if !backendManager.config.BackendManagement {
+		return nil, fmt.Errorf("changing backends at runtime is disabled, set BackendManagement = true to enable it")
+	}
+	return backendManager, nil
+}
+
+// runBackendCommand runs one of the LMD_*_BACKEND commands
+func runBackendCommand(name string, args string) error {
+	m, err := getBackendManager()
+	if err != nil {
+		return err
+	}
+	return m.Command(name, args)
+}
+
+// parseConnectionJSON reads a connection from json
+func parseConnectionJSON(data io.Reader) (*Connection, error) {
+	c := &Connection{}
+	decoder := json.NewDecoder(data)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to parse backend: %s", err.Error())
+	}
+	return c, nil
+}
+
+// removeFromList returns the list without the given value
+func removeFromList(list []string, value string) []string {
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
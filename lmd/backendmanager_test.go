@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackendConfigFile(t *testing.T) {
+	file := "backends_test.ini"
+	defer os.Remove(file)
+
+	bc, err := readBackendConfigFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interval := int64(30)
+	bc.setConnection(&Connection{ID: "id1", Name: "changed", Source: []string{"changed.sock"}, Updateinterval: &interval})
+	bc.setConnection(&Connection{ID: "id3", Name: "added", Source: []string{"added.sock"}})
+	bc.removeConnection("id2")
+	if err = writeBackendConfigFile(file, bc); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile("test1.ini", []byte(`
+BackendConfigFile = "`+file+`"
+
+[[Connections]]
+name = "site1"
+id = "id1"
+source = ["site1.sock"]
+
+[[Connections]]
+name = "site2"
+id = "id2"
+source = ["site2.sock"]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("test1.ini")
+
+	conf := NewConfig([]string{"test1.ini"})
+	if err = assertEq(2, len(conf.Connections)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("changed", conf.Connections[0].Name); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(int64(30), *conf.Connections[0].Updateinterval); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(true, conf.Connections[0].IdleTimeout == nil); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("id3", conf.Connections[1].ID); err != nil {
+		t.Error(err)
+	}
+
+	// adding a removed connection again clears it from the removed list
+	bc.setConnection(&Connection{ID: "id2", Name: "site2", Source: []string{"site2.sock"}})
+	if err = assertEq([]string{}, bc.RemovedConnections); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackendManager(t *testing.T) {
+	file := "backends_test.ini"
+	defer os.Remove(file)
+	peer := StartTestPeerExtra(1, 10, 10, "BackendManagement = true\nBackendConfigFile = \""+file+"\"\n")
+
+	PeerMapLock.RLock()
+	source := PeerMap["mockid0"].Source[0]
+	PeerMapLock.RUnlock()
+
+	backendStatus := func(id string) []interface{} {
+		res, _, err := peer.QueryString(fmt.Sprintf("GET backends\nColumns: name status paused\nFilter: peer_key = %s\n\n", id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) == 0 {
+			return nil
+		}
+		return res[0]
+	}
+	waitOnline := func(id string) {
+		for i := 0; i < 100; i++ {
+			if status := backendStatus(id); status != nil && status[1] == float64(PeerStatusUp) {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("backend %s did not come online", id)
+	}
+
+	// add backend by command
+	_, _, err := peer.QueryString(fmt.Sprintf("COMMAND [0] LMD_ADD_BACKEND;{\"id\": \"added\", \"name\": \"Added\", \"source\": [\"%s\"]}\n\n", source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitOnline("added")
+	res, _, err := peer.QueryString("GET hosts\nColumns: name\nBackends: added\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(10, len(res)); err != nil {
+		t.Error(err)
+	}
+	bc, err := readBackendConfigFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(bc.Connections)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("added", bc.Connections[0].ID); err != nil {
+		t.Error(err)
+	}
+
+	// errors are returned to the client
+	_, _, err = peer.QueryString("COMMAND [0] LMD_PAUSE_BACKEND;doesnotexist\n\n")
+	if err == nil {
+		t.Fatal("expected error for unknown backend")
+	}
+	if err = assertLike("backend doesnotexist does not exist", err.Error()); err != nil {
+		t.Error(err)
+	}
+
+	// pause and resume by http
+	router := initializeHTTPRouter()
+	send := func(method, uri, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, uri, strings.NewReader(body)))
+		return rec
+	}
+	if err = assertEq(http.StatusOK, send("POST", "/backends/added/pause", "").Code); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(1), backendStatus("added")[2]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(http.StatusBadRequest, send("POST", "/backends/added/pause", "").Code); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(http.StatusOK, send("POST", "/backends/added/resume", "").Code); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(0), backendStatus("added")[2]); err != nil {
+		t.Error(err)
+	}
+
+	// update replaces the peer
+	rec := send("PUT", "/backends/added", fmt.Sprintf(`{"name": "Renamed", "source": ["%s"]}`, source))
+	if err = assertEq(http.StatusOK, rec.Code); err != nil {
+		t.Fatal(rec.Body.String())
+	}
+	waitOnline("added")
+	if err = assertEq("Renamed", backendStatus("added")[0]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(http.StatusBadRequest, send("PUT", "/backends/added", `{"unknown": 1}`).Code); err != nil {
+		t.Error(err)
+	}
+
+	// failed writes to the BackendConfigFile do not change the backends
+	backendManager.config.BackendConfigFile = "doesnotexist/" + file
+	_, _, err = peer.QueryString(fmt.Sprintf("COMMAND [0] LMD_ADD_BACKEND;{\"id\": \"failed\", \"name\": \"Failed\", \"source\": [\"%s\"]}\n\n", source))
+	if err == nil {
+		t.Error("expected error for unwritable backend config file")
+	}
+	_, _, err = peer.QueryString("COMMAND [0] LMD_REMOVE_BACKEND;added\n\n")
+	if err == nil {
+		t.Error("expected error for unwritable backend config file")
+	}
+	backendManager.config.BackendConfigFile = file
+	if err = assertEq([]interface{}(nil), backendStatus("failed")); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("Renamed", backendStatus("added")[0]); err != nil {
+		t.Error(err)
+	}
+
+	// remove backends, removed connections from the config files are remembered
+	if err = assertEq(http.StatusOK, send("DELETE", "/backends/added", "").Code); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = peer.QueryString("COMMAND [0] LMD_REMOVE_BACKEND;mockid0\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err = peer.QueryString("GET backends\nColumns: peer_key\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(0, len(res)); err != nil {
+		t.Error(err)
+	}
+	bc, err = readBackendConfigFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(0, len(bc.Connections)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq([]string{"added", "mockid0"}, bc.RemovedConnections); err != nil {
+		t.Error(err)
+	}
+
+	// add the mock backend again, so the test peer can be stopped
+	_, _, err = peer.QueryString(fmt.Sprintf("COMMAND [0] LMD_ADD_BACKEND;{\"id\": \"mockid0\", \"name\": \"Mock\", \"source\": [\"%s\"]}\n\n", source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitOnline("mockid0")
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestBackendManagerDisabled(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	_, _, err := peer.QueryString("COMMAND [0] LMD_PAUSE_BACKEND;mockid0\n\n")
+	if err == nil {
+		t.Fatal("expected error if backend management is disabled")
+	}
+	if err = assertLike("changing backends at runtime is disabled", err.Error()); err != nil {
+		t.Error(err)
+	}
+
+	rec := httptest.NewRecorder()
+	initializeHTTPRouter().ServeHTTP(rec, httptest.NewRequest("POST", "/backends/mockid0/pause", nil))
+	if err = assertEq(http.StatusBadRequest, rec.Code); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// CircuitState contains the state of the circuit breaker of a peer
+type CircuitState uint8
+
+// The circuit is closed as long as the peer works. It opens after CircuitBreakerThreshold
+// errors and all requests fail fast while it is open. Once the backoff passed, the circuit
+// is half-open and the next update tries to reach the peer again. The backoff doubles
+// with every failed retry.
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String converts a CircuitState into a string
+func (cs *CircuitState) String() string {
+	switch *cs {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		log.Panicf("not implemented")
+	}
+	return ""
+}
+
+// circuitBackoff returns the seconds to wait before the next retry after the given number of consecutive openings
+func circuitBackoff(conf *Config, opens int) int64 {
+	backoff := conf.CircuitBreakerBackoff
+	for i := 1; i < opens && backoff < conf.CircuitBreakerMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > conf.CircuitBreakerMaxBackoff {
+		backoff = conf.CircuitBreakerMaxBackoff
+	}
+	return backoff
+}
+
+// circuitFailure opens the circuit if the error threshold is reached or the retry
+// of a half-open circuit failed.
+// The caller must hold the write lock.
+func (p *Peer) circuitFailure(err error) {
+	if p.GlobalConfig.CircuitBreakerThreshold <= 0 {
+		return
+	}
+	state := p.Status[CircuitBreakerState].(CircuitState)
+	switch state {
+	case CircuitOpen:
+		return
+	case CircuitClosed:
+		if p.ErrorCount < p.GlobalConfig.CircuitBreakerThreshold {
+			return
+		}
+	}
+	opens := p.Status[CircuitBreakerOpens].(int) + 1
+	backoff := circuitBackoff(p.GlobalConfig, opens)
+	p.Status[CircuitBreakerState] = CircuitOpen
+	p.Status[CircuitBreakerOpens] = opens
+	p.Status[CircuitBreakerRetry] = time.Now().Unix() + backoff
+	logWith(p).Infof("circuit breaker opened after %d errors, next retry in %ds: %s", p.ErrorCount, backoff, err.Error())
+	promPeerCircuitState.WithLabelValues(p.Name).Set(float64(CircuitOpen))
+	promPeerCircuitOpens.WithLabelValues(p.Name).Inc()
+}
+
+// circuitSuccess closes the circuit after the peer has recovered.
+// The caller must hold the write lock.
+func (p *Peer) circuitSuccess() {
+	state := p.Status[CircuitBreakerState].(CircuitState)
+	if state == CircuitClosed {
+		return
+	}
+	logWith(p).Infof("circuit breaker closed, peer recovered")
+	p.Status[CircuitBreakerState] = CircuitClosed
+	p.Status[CircuitBreakerOpens] = 0
+	p.Status[CircuitBreakerRetry] = int64(0)
+	promPeerCircuitState.WithLabelValues(p.Name).Set(float64(CircuitClosed))
+}
+
+// circuitAllowUpdate returns false while the circuit is open. Once the backoff passed,
+// the circuit switches to half-open and the update may try to reach the peer again.
+func (p *Peer) circuitAllowUpdate(now int64) bool {
+	p.Lock.RLock()
+	state := p.Status[CircuitBreakerState].(CircuitState)
+	p.Lock.RUnlock()
+	if state != CircuitOpen {
+		return true
+	}
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	if now < p.Status[CircuitBreakerRetry].(int64) {
+		// still mark the peer down once it is stale
+		if p.Status[PeerState].(PeerStatus) != PeerStatusDown {
+			p.setStaleStatus(p.Status[LastError].(string))
+		}
+		return false
+	}
+	logWith(p).Debugf("circuit breaker half-open, trying to reconnect")
+	p.Status[CircuitBreakerState] = CircuitHalfOpen
+	promPeerCircuitState.WithLabelValues(p.Name).Set(float64(CircuitHalfOpen))
+	return true
+}
+
+// circuitError returns an error if the circuit is open, so requests fail fast
+// instead of waiting for the connect timeout.
+func (p *Peer) circuitError() error {
+	p.Lock.RLock()
+	defer p.Lock.RUnlock()
+	if p.Status[CircuitBreakerState].(CircuitState) != CircuitOpen {
+		return nil
+	}
+	retry := p.Status[CircuitBreakerRetry].(int64) - time.Now().Unix()
+	if retry < 0 {
+		retry = 0
+	}
+	return &PeerError{msg: fmt.Sprintf("circuit breaker open, next retry in %ds: %s", retry, p.Status[LastError]), kind: CircuitOpenError}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBackoff(t *testing.T) {
+	conf := &Config{CircuitBreakerBackoff: 10, CircuitBreakerMaxBackoff: 600}
+	for opens, exp := range map[int]int64{1: 10, 2: 20, 3: 40, 6: 320, 7: 600, 50: 600} {
+		if err := assertEq(exp, circuitBackoff(conf, opens)); err != nil {
+			t.Errorf("opens %d: %s", opens, err)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	peer := NewPeer(GlobalTestConfig, &Connection{Source: []string{"doesnotexist.sock"}, Name: "Circuit", ID: "circuitid"}, TestPeerWaitGroup, make(chan bool))
+
+	// circuit opens after reaching the error threshold
+	for i := 0; i < GlobalTestConfig.CircuitBreakerThreshold; i++ {
+		_, _, err := peer.QueryString("GET status\nColumns: program_start\n\n")
+		if err == nil {
+			t.Fatal("expected connection error")
+		}
+		if peer.StatusGet(CircuitBreakerState) == CircuitOpen {
+			break
+		}
+	}
+	if err := assertEq(CircuitOpen, peer.StatusGet(CircuitBreakerState)); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertEq(1, peer.StatusGet(CircuitBreakerOpens)); err != nil {
+		t.Error(err)
+	}
+	retry := peer.StatusGet(CircuitBreakerRetry).(int64)
+	if err := assertEq(time.Now().Unix()+GlobalTestConfig.CircuitBreakerBackoff, retry); err != nil {
+		t.Error(err)
+	}
+
+	// requests fail fast while open
+	_, _, err := peer.QueryString("GET status\nColumns: program_start\n\n")
+	if err == nil {
+		t.Fatal("expected circuit breaker error")
+	}
+	if err2 := assertEq(CircuitOpenError, err.(*PeerError).kind); err2 != nil {
+		t.Error(err2)
+	}
+	errorCount := peer.ErrorCount
+	if err2 := assertEq(true, errorCount >= GlobalTestConfig.CircuitBreakerThreshold); err2 != nil {
+		t.Error(err2)
+	}
+
+	// updates wait for the backoff
+	if err2 := assertEq(false, peer.circuitAllowUpdate(time.Now().Unix())); err2 != nil {
+		t.Error(err2)
+	}
+
+	// failed retry doubles the backoff
+	if err2 := assertEq(true, peer.circuitAllowUpdate(retry)); err2 != nil {
+		t.Error(err2)
+	}
+	if err2 := assertEq(CircuitHalfOpen, peer.StatusGet(CircuitBreakerState)); err2 != nil {
+		t.Error(err2)
+	}
+	_, _, err = peer.QueryString("GET status\nColumns: program_start\n\n")
+	if err == nil {
+		t.Fatal("expected connection error")
+	}
+	if err2 := assertEq(CircuitOpen, peer.StatusGet(CircuitBreakerState)); err2 != nil {
+		t.Error(err2)
+	}
+	if err2 := assertEq(2, peer.StatusGet(CircuitBreakerOpens)); err2 != nil {
+		t.Error(err2)
+	}
+	if err2 := assertEq(time.Now().Unix()+2*GlobalTestConfig.CircuitBreakerBackoff, peer.StatusGet(CircuitBreakerRetry)); err2 != nil {
+		t.Error(err2)
+	}
+
+	// recovered peers close the circuit
+	peer.Lock.Lock()
+	peer.resetErrors()
+	peer.Lock.Unlock()
+	if err2 := assertEq(CircuitClosed, peer.StatusGet(CircuitBreakerState)); err2 != nil {
+		t.Error(err2)
+	}
+	if err2 := assertEq(0, peer.StatusGet(CircuitBreakerOpens)); err2 != nil {
+		t.Error(err2)
+	}
+}
@@ -130,6 +130,19 @@ func (cl *ClientConnection) processRequests(ctx context.Context, reqs []*Request
 		reqctx := context.WithValue(ctx, CtxRequest, req.ID())
 		t1 := time.Now()
 		if req.Command != "" {
+			if name, args, ok := parseBackendCommand(req.Command); ok {
+				// send all pending commands first, the backend might be removed
+				err = cl.sendRemainingCommands(reqctx, &commandsByPeer)
+				if err != nil {
+					return
+				}
+				if err = runBackendCommand(name, args); err != nil {
+					_, err = cl.connection.Write([]byte(fmt.Sprintf("%d: %s\n", 400, err.Error())))
+					return
+				}
+				logWith(reqctx).Infof("incoming %s command finished in %s", name, time.Since(t1))
+				continue
+			}
 			for _, pID := range req.BackendsMap {
 				commandsByPeer[pID] = append(commandsByPeer[pID], strings.TrimSpace(req.Command))
 			}
@@ -32,6 +32,7 @@ var VirtualColumnList = []VirtualColumnMapEntry{
 	{Name: "last_update", StatusKey: LastUpdate},
 	{Name: "response_time", StatusKey: ResponseTime},
 	{Name: "idling", StatusKey: Idling},
+	{Name: "paused", StatusKey: Paused},
 	{Name: "last_query", StatusKey: LastQuery},
 	{Name: "section", StatusKey: Section},
 	{Name: "parent", StatusKey: PeerParent},
@@ -40,6 +41,15 @@ var VirtualColumnList = []VirtualColumnMapEntry{
 	{Name: "federation_name", StatusKey: SubName},
 	{Name: "federation_addr", StatusKey: SubAddr},
 	{Name: "federation_type", StatusKey: SubType},
+	{Name: "mem_rows", StatusKey: MemoryRows},
+	{Name: "mem_string_bytes", StatusKey: MemoryStringBytes},
+	{Name: "mem_compressed_bytes", StatusKey: MemoryCompressedBytes},
+	{Name: "mem_dedup_savings", StatusKey: MemoryDedupSavings},
+	{Name: "mem_total", StatusKey: MemoryTotalBytes},
+	{Name: "mem_tables", StatusKey: MemoryTables},
+	{Name: "circuit_state", StatusKey: CircuitBreakerState},
+	{Name: "circuit_opens", StatusKey: CircuitBreakerOpens},
+	{Name: "circuit_retry", StatusKey: CircuitBreakerRetry},
 
 	// calculated columns by ResolveFunc
 	{Name: "lmd_last_cache_update", ResolveFunc: func(d *DataRow, _ *Column) interface{} { return d.LastUpdate }},
@@ -56,12 +66,54 @@ var VirtualColumnList = []VirtualColumnMapEntry{
 	{Name: "total_services", ResolveFunc: VirtualColTotalServices},
 	{Name: "flags", ResolveFunc: VirtualColFlags},
 	{Name: "localtime", ResolveFunc: VirtualColLocaltime},
+	{Name: "sources", ResolveFunc: VirtualColSources},
+	{Name: "update_interval", ResolveFunc: VirtualColPeerConfig},
+	{Name: "full_update_interval", ResolveFunc: VirtualColPeerConfig},
+	{Name: "idle_timeout", ResolveFunc: VirtualColPeerConfig},
+	{Name: "idle_interval", ResolveFunc: VirtualColPeerConfig},
+	{Name: "net_timeout", ResolveFunc: VirtualColPeerConfig},
+	{Name: "connect_timeout", ResolveFunc: VirtualColPeerConfig},
+	{Name: "sync_is_executing", ResolveFunc: VirtualColPeerConfig},
+	{Name: "max_parallel_connections", ResolveFunc: VirtualColPeerConfig},
 	{Name: "empty", ResolveFunc: func(_ *DataRow, _ *Column) interface{} { return "" }}, // return empty string as placeholder for nonexisting columns
 }
 
 // VirtualColumnMap maps is the lookup map for the VirtualColumnList
 var VirtualColumnMap = map[string]*VirtualColumnMapEntry{}
 
+// TimestampColumns contains all columns holding unix timestamps which will be
+// shifted by the Localtime header
+var TimestampColumns = map[string]bool{
+	"end_time":                true,
+	"entry_time":              true,
+	"expire_time":             true,
+	"last_check":              true,
+	"last_command_check":      true,
+	"last_hard_state_change":  true,
+	"last_log_rotation":       true,
+	"last_notification":       true,
+	"last_online":             true,
+	"last_query":              true,
+	"last_state_change":       true,
+	"last_state_change_order": true,
+	"last_time_critical":      true,
+	"last_time_down":          true,
+	"last_time_ok":            true,
+	"last_time_unknown":       true,
+	"last_time_unreachable":   true,
+	"last_time_up":            true,
+	"last_time_warning":       true,
+	"last_update":             true,
+	"lmd_last_cache_update":   true,
+	"next_check":              true,
+	"next_notification":       true,
+	"peer_last_online":        true,
+	"peer_last_update":        true,
+	"program_start":           true,
+	"start_time":              true,
+	"time":                    true,
+}
+
 // ServiceMember is a host_name / description pair
 type ServiceMember [2]string
 
@@ -279,6 +331,18 @@ func (c *Column) String() string {
 	return c.Name
 }
 
+// IsTimestamp returns true if the column contains unix timestamps
+func (c *Column) IsTimestamp() bool {
+	if c.StorageType == RefStore {
+		return c.RefCol.IsTimestamp()
+	}
+	switch c.DataType {
+	case IntCol, Int64Col, FloatCol:
+		return TimestampColumns[c.Name]
+	}
+	return false
+}
+
 // GetEmptyValue returns an empty placeholder representation for the given column type
 func (c *Column) GetEmptyValue() interface{} {
 	switch c.DataType {
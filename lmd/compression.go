@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/sasha-s/go-deadlock"
+)
+
+// DefaultCompressionCodec is used unless another codec is configured
+const DefaultCompressionCodec = "gzip"
+
+// StringContainerCacheShards sets the number of independently locked parts of the string container cache
+const StringContainerCacheShards = 16
+
+// compressionCodec is the codec used to compress new large strings
+var compressionCodec CompressionCodec = &gzipCodec{}
+
+// compressionCodecSettings contains the settings used to create the current compressionCodec
+var compressionCodecSettings string
+
+// stringContainerCache caches decompressed strings, it is nil if the cache is disabled
+var stringContainerCache *StringContainerCache
+
+// CompressionCodec compresses and decompresses large string values.
+type CompressionCodec interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// NewCompressionCodec returns the codec for the given name. The dictionary file is
+// optional and only used by the deflate and zstd codecs.
+func NewCompressionCodec(name string, dictionaryFile string) (CompressionCodec, error) {
+	var dict []byte
+	if dictionaryFile != "" {
+		var err error
+		dict, err = ioutil.ReadFile(dictionaryFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read compression dictionary: %s", err.Error())
+		}
+	}
+	switch strings.ToLower(name) {
+	case "", "gzip":
+		return &gzipCodec{}, nil
+	case "deflate":
+		return &deflateCodec{dictionary: dict}, nil
+	case "snappy":
+		return &snappyCodec{}, nil
+	case "zstd":
+		return newZstdCodec(dict)
+	case "lz4":
+		return &lz4Codec{}, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %s, supported codecs are: gzip, deflate, snappy, zstd, lz4 and none", name)
+}
+
+// setCompressionCodec replaces the compressionCodec if its settings have changed.
+// The previous codec will be closed, strings compressed by it still can be decompressed.
+func setCompressionCodec(name string, dictionaryFile string) {
+	settings := fmt.Sprintf("%s;%s;%d", name, dictionaryFile, CompressionLevel)
+	if settings == compressionCodecSettings {
+		return
+	}
+	codec, err := NewCompressionCodec(name, dictionaryFile)
+	if err != nil {
+		log.Warnf("failed to create compression codec: %s", err.Error())
+	}
+	previous := compressionCodec
+	compressionCodec = codec
+	compressionCodecSettings = settings
+	if closer, ok := previous.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+// gzipCodec uses gzip with the configured CompressionLevel
+type gzipCodec struct{}
+
+func (c *gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (c *gzipCodec) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&b, CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err = gz.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c *gzipCodec) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// deflateCodec uses raw deflate without gzip header and an optional preset dictionary.
+// A dictionary containing typical plugin output improves the ratio for short values.
+type deflateCodec struct {
+	dictionary []byte
+}
+
+func (c *deflateCodec) Name() string {
+	return "deflate"
+}
+
+func (c *deflateCodec) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := flate.NewWriterDict(&b, CompressionLevel, c.dictionary)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c *deflateCodec) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReaderDict(bytes.NewReader(data), c.dictionary)
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// snappyCodec trades compression ratio for speed
+type snappyCodec struct{}
+
+func (c *snappyCodec) Name() string {
+	return "snappy"
+}
+
+func (c *snappyCodec) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (c *snappyCodec) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// zstdCodec uses zstd with an optional dictionary, which must be trained by
+// `zstd --train` from typical plugin output.
+type zstdCodec struct {
+	lock       *deadlock.RWMutex
+	closed     bool
+	dictionary []byte
+	encoder    *zstd.Encoder
+	decoder    *zstd.Decoder
+}
+
+func newZstdCodec(dict []byte) (*zstdCodec, error) {
+	level := zstd.SpeedDefault
+	if CompressionLevel >= 0 {
+		level = zstd.EncoderLevelFromZstd(CompressionLevel)
+	}
+	// encoder and decoder are shared by all query goroutines
+	concurrency := runtime.GOMAXPROCS(0)
+	encoderOptions := []zstd.EOption{zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(concurrency)}
+	encoder, err := zstd.NewWriter(nil, encoderOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zstd dictionary: %s", err.Error())
+	}
+	decoder, err := newZstdDecoder(dict, concurrency)
+	if err != nil {
+		LogErrors(encoder.Close())
+		return nil, err
+	}
+	return &zstdCodec{lock: new(deadlock.RWMutex), dictionary: dict, encoder: encoder, decoder: decoder}, nil
+}
+
+func newZstdDecoder(dict []byte, concurrency int) (*zstd.Decoder, error) {
+	decoderOptions := []zstd.DOption{zstd.WithDecoderConcurrency(concurrency)}
+	if dict != nil {
+		decoderOptions = append(decoderOptions, zstd.WithDecoderDicts(dict))
+	}
+	decoder, err := zstd.NewReader(nil, decoderOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zstd dictionary: %s", err.Error())
+	}
+	return decoder, nil
+}
+
+func (c *zstdCodec) Name() string {
+	return "zstd"
+}
+
+func (c *zstdCodec) Compress(data []byte) ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.closed {
+		// codec has just been replaced, the value will be stored uncompressed
+		return nil, nil
+	}
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCodec) Decompress(data []byte) ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if !c.closed {
+		return c.decoder.DecodeAll(data, nil)
+	}
+	// strings compressed before the codec has been replaced use a temporary decoder until they are updated
+	decoder, err := newZstdDecoder(c.dictionary, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	return decoder.DecodeAll(data, nil)
+}
+
+// Close stops the encoder and decoder goroutines
+func (c *zstdCodec) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	LogErrors(c.encoder.Close())
+	c.decoder.Close()
+}
+
+// lz4Codec uses lz4 blocks prefixed by the uncompressed size, it is even faster than snappy
+type lz4Codec struct{}
+
+// lz4Compressors contains reusable lz4 compressors, a compressor must not be used concurrently
+var lz4Compressors = sync.Pool{
+	New: func() interface{} { return &lz4.Compressor{} },
+}
+
+func (c *lz4Codec) Name() string {
+	return "lz4"
+}
+
+func (c *lz4Codec) Compress(data []byte) ([]byte, error) {
+	buf := make([]byte, binary.MaxVarintLen64+lz4.CompressBlockBound(len(data)))
+	size := binary.PutUvarint(buf, uint64(len(data)))
+	compressor := lz4Compressors.Get().(*lz4.Compressor)
+	num, err := compressor.CompressBlock(data, buf[size:])
+	lz4Compressors.Put(compressor)
+	if err != nil {
+		return nil, err
+	}
+	if num == 0 || size+num >= len(data) {
+		// data is not compressible, the value will be stored uncompressed
+		return nil, nil
+	}
+	return buf[:size+num], nil
+}
+
+func (c *lz4Codec) Decompress(data []byte) ([]byte, error) {
+	length, size := binary.Uvarint(data)
+	if size <= 0 {
+		return nil, errors.New("invalid lz4 data")
+	}
+	buf := make([]byte, length)
+	num, err := lz4.UncompressBlock(data[size:], buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:num], nil
+}
+
+// StringContainerCache keeps the most recently used decompressed strings.
+// Entries are keyed by the compressed data, so updated values never hit stale entries.
+// The cache is split into shards, so concurrent lookups do not block each other.
+type StringContainerCache struct {
+	noCopy noCopy
+	shards []*stringContainerCacheShard
+}
+
+// stringContainerCacheShard is a least recently used cache for a part of the keys.
+type stringContainerCacheShard struct {
+	noCopy  noCopy
+	lock    *deadlock.Mutex
+	size    int
+	order   *list.List
+	entries map[*byte]*list.Element
+}
+
+type stringContainerCacheEntry struct {
+	key   *byte
+	value string
+}
+
+// NewStringContainerCache creates a new cache for up to size strings.
+// It returns nil if size is not greater than 0.
+func NewStringContainerCache(size int) *StringContainerCache {
+	if size <= 0 {
+		return nil
+	}
+	num := StringContainerCacheShards
+	if size < num {
+		num = size
+	}
+	c := &StringContainerCache{
+		shards: make([]*stringContainerCacheShard, num),
+	}
+	for i := range c.shards {
+		// spread the remainder, so the total size matches
+		shardSize := size / num
+		if i < size%num {
+			shardSize++
+		}
+		c.shards[i] = &stringContainerCacheShard{
+			lock:    new(deadlock.Mutex),
+			size:    shardSize,
+			order:   list.New(),
+			entries: make(map[*byte]*list.Element),
+		}
+	}
+	return c
+}
+
+// shard returns the shard responsible for the given key
+func (c *StringContainerCache) shard(key *byte) *stringContainerCacheShard {
+	// allocations are aligned, so skip the lower bits
+	return c.shards[(uintptr(unsafe.Pointer(key))>>4)%uintptr(len(c.shards))]
+}
+
+// Get returns the cached string for the compressed data.
+func (c *StringContainerCache) Get(compressed []byte) (string, bool) {
+	return c.shard(&compressed[0]).get(&compressed[0])
+}
+
+// Add stores the decompressed string and removes the least recently used entry if the cache is full.
+func (c *StringContainerCache) Add(compressed []byte, value string) {
+	c.shard(&compressed[0]).add(&compressed[0], value)
+}
+
+// Len returns the number of cached strings.
+func (c *StringContainerCache) Len() (num int) {
+	for _, s := range c.shards {
+		num += s.len()
+	}
+	return
+}
+
+func (c *stringContainerCacheShard) get(key *byte) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*stringContainerCacheEntry).value, true
+}
+
+func (c *stringContainerCacheShard) add(key *byte, value string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&stringContainerCacheEntry{key: key, value: value})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*stringContainerCacheEntry).key)
+	}
+}
+
+func (c *stringContainerCacheShard) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.order.Len()
+}
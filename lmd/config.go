@@ -27,6 +27,17 @@ type Connection struct {
 	TLSSkipVerify  int
 	Proxy          string
 	Flags          []string
+	LoadBalance    bool // spread passthrough queries and updates across all healthy sources
+
+	// optional overrides of the global settings, nil uses the global value
+	Updateinterval             *int64
+	FullUpdateInterval         *int64
+	IdleTimeout                *int64
+	IdleInterval               *int64
+	NetTimeout                 *int
+	ConnectTimeout             *int
+	SyncIsExecuting            *bool
+	MaxParallelPeerConnections *int
 }
 
 // Equals checks if two connection objects are identical.
@@ -40,11 +51,81 @@ func (c *Connection) Equals(other *Connection) bool {
 	equal = equal && c.TLSKey == other.TLSKey
 	equal = equal && c.TLSCA == other.TLSCA
 	equal = equal && c.TLSSkipVerify == other.TLSSkipVerify
+	equal = equal && c.LoadBalance == other.LoadBalance
+	equal = equal && equalInt64Ptr(c.Updateinterval, other.Updateinterval)
+	equal = equal && equalInt64Ptr(c.FullUpdateInterval, other.FullUpdateInterval)
+	equal = equal && equalInt64Ptr(c.IdleTimeout, other.IdleTimeout)
+	equal = equal && equalInt64Ptr(c.IdleInterval, other.IdleInterval)
+	equal = equal && equalIntPtr(c.NetTimeout, other.NetTimeout)
+	equal = equal && equalIntPtr(c.ConnectTimeout, other.ConnectTimeout)
+	equal = equal && equalBoolPtr(c.SyncIsExecuting, other.SyncIsExecuting)
+	equal = equal && equalIntPtr(c.MaxParallelPeerConnections, other.MaxParallelPeerConnections)
 	equal = equal && strings.Join(c.Source, ":") == strings.Join(other.Source, ":")
 	equal = equal && strings.Join(c.Flags, ":") == strings.Join(other.Flags, ":")
 	return equal
 }
 
+// hasOverrides returns true if the connection overrides any global setting.
+func (c *Connection) hasOverrides() bool {
+	return c.Updateinterval != nil || c.FullUpdateInterval != nil ||
+		c.IdleTimeout != nil || c.IdleInterval != nil ||
+		c.NetTimeout != nil || c.ConnectTimeout != nil ||
+		c.SyncIsExecuting != nil || c.MaxParallelPeerConnections != nil
+}
+
+// validateOverrides removes invalid overrides, so the global value is used instead.
+func (c *Connection) validateOverrides() {
+	if c.Updateinterval != nil && *c.Updateinterval <= 0 {
+		log.Warnf("config: connection %s: Updateinterval invalid, value must be greater than 0", c.Name)
+		c.Updateinterval = nil
+	}
+	if c.FullUpdateInterval != nil && *c.FullUpdateInterval < 0 {
+		log.Warnf("config: connection %s: FullUpdateInterval invalid, value must be greater than or equal to 0", c.Name)
+		c.FullUpdateInterval = nil
+	}
+	if c.IdleTimeout != nil && *c.IdleTimeout <= 0 {
+		log.Warnf("config: connection %s: IdleTimeout invalid, value must be greater than 0", c.Name)
+		c.IdleTimeout = nil
+	}
+	if c.IdleInterval != nil && *c.IdleInterval <= 0 {
+		log.Warnf("config: connection %s: IdleInterval invalid, value must be greater than 0", c.Name)
+		c.IdleInterval = nil
+	}
+	if c.NetTimeout != nil && *c.NetTimeout <= 0 {
+		log.Warnf("config: connection %s: NetTimeout invalid, value must be greater than 0", c.Name)
+		c.NetTimeout = nil
+	}
+	if c.ConnectTimeout != nil && *c.ConnectTimeout <= 0 {
+		log.Warnf("config: connection %s: ConnectTimeout invalid, value must be greater than 0", c.Name)
+		c.ConnectTimeout = nil
+	}
+	if c.MaxParallelPeerConnections != nil && *c.MaxParallelPeerConnections <= 0 {
+		log.Warnf("config: connection %s: MaxParallelPeerConnections invalid, value must be greater than 0", c.Name)
+		c.MaxParallelPeerConnections = nil
+	}
+}
+
+func equalInt64Ptr(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalBoolPtr(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 type configFiles []string
 
 // String returns the config files list as string.
@@ -94,10 +175,29 @@ type Config struct {
 	SyncIsExecuting            bool
 	CompressionMinimumSize     int
 	CompressionLevel           int
+	CompressionCodec           string
+	CompressionDictionary      string
+	CompressionCacheSize       int
 	MaxClockDelta              float64
 	UpdateOffset               int64
 	TLSMinVersion              string
 	MaxParallelPeerConnections int
+	StreamResponses            bool
+	ResultCacheSize            int
+	StateDir                   string
+	SnapshotInterval           int64
+	LogCacheDir                string
+	LogCacheRetention          int
+	StateChangeHistorySize     int
+	SecondaryIndexes           []string
+	ParallelFilterThreshold    int
+	ParallelFilterWorkers      int
+	MemoryStatisticsInterval   int64
+	CircuitBreakerThreshold    int
+	CircuitBreakerBackoff      int64
+	CircuitBreakerMaxBackoff   int64
+	BackendManagement          bool
+	BackendConfigFile          string
 }
 
 // NewConfig reads all config files.
@@ -122,10 +222,20 @@ func NewConfig(files []string) *Config {
 		SyncIsExecuting:            true,
 		CompressionMinimumSize:     DefaultCompressionMinimumSize,
 		CompressionLevel:           -1,
+		CompressionCodec:           DefaultCompressionCodec,
+		CompressionCacheSize:       1000,
 		MaxClockDelta:              10,
 		UpdateOffset:               3,
 		TLSMinVersion:              "tls1.1",
 		MaxParallelPeerConnections: 3,
+		SnapshotInterval:           300,
+		LogCacheRetention:          31,
+		StateChangeHistorySize:     10000,
+		ParallelFilterThreshold:    DefaultParallelFilterThreshold,
+		MemoryStatisticsInterval:   300,
+		CircuitBreakerThreshold:    3,
+		CircuitBreakerBackoff:      10,
+		CircuitBreakerMaxBackoff:   600,
 	}
 
 	// combine listeners from all files
@@ -154,6 +264,16 @@ func NewConfig(files []string) *Config {
 	}
 	conf.Listen = allListeners
 
+	// apply backends changed at runtime
+	if conf.BackendConfigFile != "" {
+		bc, err := readBackendConfigFile(conf.BackendConfigFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: could not load backends from %s: %s\n", conf.BackendConfigFile, err.Error())
+			os.Exit(ExitUnknown)
+		}
+		bc.apply(&conf)
+	}
+
 	for i := range conf.Connections {
 		for j := range conf.Connections[i].Source {
 			if strings.HasPrefix(conf.Connections[i].Source[j], "http") {
@@ -211,10 +331,68 @@ func (conf *Config) ValidateConfig() {
 		log.Warnf("config: CompressionMinimumSize invalid, value must be greater than 0")
 		conf.CompressionMinimumSize = DefaultConfig.CompressionMinimumSize
 	}
+	if _, err := NewCompressionCodec(conf.CompressionCodec, conf.CompressionDictionary); err != nil {
+		log.Warnf("config: CompressionCodec invalid, %s", err.Error())
+		conf.CompressionCodec = DefaultCompressionCodec
+		conf.CompressionDictionary = ""
+	}
+	if conf.CompressionCacheSize < 0 {
+		log.Warnf("config: CompressionCacheSize invalid, value must be greater than or equal to 0")
+		conf.CompressionCacheSize = 0
+	}
 	if conf.MaxClockDelta < 0 {
 		log.Warnf("config: MaxClockDelta invalid, value must be greater than 0")
 		conf.MaxClockDelta = 10
 	}
+	if conf.ResultCacheSize < 0 {
+		log.Warnf("config: ResultCacheSize invalid, value must be greater than or equal to 0")
+		conf.ResultCacheSize = 0
+	}
+	if conf.SnapshotInterval <= 0 {
+		log.Warnf("config: SnapshotInterval invalid, value must be greater than 0")
+		conf.SnapshotInterval = DefaultConfig.SnapshotInterval
+	}
+	if conf.MemoryStatisticsInterval < 0 {
+		log.Warnf("config: MemoryStatisticsInterval invalid, value must be greater than or equal to 0")
+		conf.MemoryStatisticsInterval = 0
+	}
+	if conf.LogCacheRetention <= 0 {
+		log.Warnf("config: LogCacheRetention invalid, value must be greater than 0")
+		conf.LogCacheRetention = DefaultConfig.LogCacheRetention
+	}
+	if conf.StateChangeHistorySize < 0 {
+		log.Warnf("config: StateChangeHistorySize invalid, value must be greater than or equal to 0")
+		conf.StateChangeHistorySize = 0
+	}
+	indexes := make([]string, 0, len(conf.SecondaryIndexes))
+	for _, definition := range conf.SecondaryIndexes {
+		if _, _, _, err := parseSecondaryIndexDefinition(definition); err != nil {
+			log.Warnf("config: SecondaryIndexes: %s", err.Error())
+			continue
+		}
+		indexes = append(indexes, definition)
+	}
+	conf.SecondaryIndexes = indexes
+	if conf.ParallelFilterThreshold < 0 {
+		log.Warnf("config: ParallelFilterThreshold invalid, value must be greater than or equal to 0")
+		conf.ParallelFilterThreshold = 0
+	}
+	if conf.ParallelFilterWorkers < 0 {
+		log.Warnf("config: ParallelFilterWorkers invalid, value must be greater than or equal to 0")
+		conf.ParallelFilterWorkers = 0
+	}
+	if conf.CircuitBreakerThreshold < 0 {
+		log.Warnf("config: CircuitBreakerThreshold invalid, value must be greater than or equal to 0")
+		conf.CircuitBreakerThreshold = 0
+	}
+	if conf.CircuitBreakerBackoff <= 0 {
+		log.Warnf("config: CircuitBreakerBackoff invalid, value must be greater than 0")
+		conf.CircuitBreakerBackoff = DefaultConfig.CircuitBreakerBackoff
+	}
+	if conf.CircuitBreakerMaxBackoff < conf.CircuitBreakerBackoff {
+		log.Warnf("config: CircuitBreakerMaxBackoff invalid, value must be greater than or equal to CircuitBreakerBackoff")
+		conf.CircuitBreakerMaxBackoff = conf.CircuitBreakerBackoff
+	}
 	if conf.UpdateOffset <= 0 {
 		log.Warnf("config: UpdateOffset invalid, value must be greater than 0")
 		conf.UpdateOffset = 3
@@ -223,6 +401,74 @@ func (conf *Config) ValidateConfig() {
 	if err != nil {
 		log.Warnf("%s", err)
 	}
+	for i := range conf.Connections {
+		conf.Connections[i].validateOverrides()
+	}
+}
+
+// ForConnection returns the effective config of the given connection with all its
+// overrides applied. The config itself is returned if nothing is overridden.
+func (conf *Config) ForConnection(c *Connection) *Config {
+	if c == nil || !c.hasOverrides() {
+		return conf
+	}
+	effective := *conf
+	if c.Updateinterval != nil {
+		effective.Updateinterval = *c.Updateinterval
+	}
+	if c.FullUpdateInterval != nil {
+		effective.FullUpdateInterval = *c.FullUpdateInterval
+	}
+	if c.IdleTimeout != nil {
+		effective.IdleTimeout = *c.IdleTimeout
+	}
+	if c.IdleInterval != nil {
+		effective.IdleInterval = *c.IdleInterval
+	}
+	if c.NetTimeout != nil {
+		effective.NetTimeout = *c.NetTimeout
+	}
+	if c.ConnectTimeout != nil {
+		effective.ConnectTimeout = *c.ConnectTimeout
+	}
+	if c.SyncIsExecuting != nil {
+		effective.SyncIsExecuting = *c.SyncIsExecuting
+	}
+	if c.MaxParallelPeerConnections != nil {
+		effective.MaxParallelPeerConnections = *c.MaxParallelPeerConnections
+	}
+	return &effective
+}
+
+// VirtualColPeerConfig returns the effective value of a per connection setting
+func VirtualColPeerConfig(d *DataRow, col *Column) interface{} {
+	p := d.DataStore.Peer
+	if p == nil {
+		return nil
+	}
+	switch col.Name {
+	case "update_interval":
+		return p.GlobalConfig.Updateinterval
+	case "full_update_interval":
+		return p.GlobalConfig.FullUpdateInterval
+	case "idle_timeout":
+		return p.GlobalConfig.IdleTimeout
+	case "idle_interval":
+		return p.GlobalConfig.IdleInterval
+	case "net_timeout":
+		return p.GlobalConfig.NetTimeout
+	case "connect_timeout":
+		return p.GlobalConfig.ConnectTimeout
+	case "sync_is_executing":
+		if p.GlobalConfig.SyncIsExecuting {
+			return 1
+		}
+		return 0
+	case "max_parallel_connections":
+		return p.GlobalConfig.MaxParallelPeerConnections
+	}
+	log.Panicf("unsupported peer config column: %s", col.Name)
+	return nil
 }
 
 func (conf *Config) SetServiceAuthorization() {
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RowCursor marks the position of the last returned row for cursor based pagination.
+// It contains the sort values of that row and its peer and primary key as tie-breaker.
+type RowCursor struct {
+	noCopy  noCopy
+	Values  []interface{} // sort values, either float64 or string depending on the sort column
+	PeerKey string        // peer id of the last row
+	ID      string        // primary key of the last row
+}
+
+// NewRowCursor creates a cursor pointing to the given row.
+func NewRowCursor(row *DataRow, sortFields []*SortField) *RowCursor {
+	cursor := &RowCursor{
+		Values:  make([]interface{}, len(sortFields)),
+		PeerKey: row.DataStore.PeerKey,
+		ID:      row.GetID(),
+	}
+	for i, s := range sortFields {
+		cursor.Values[i] = cursorSortValue(row, s.Column)
+	}
+	return cursor
+}
+
+// ParseRowCursor decodes a cursor token. An empty token returns a cursor
+// without position which starts at the first row.
+func ParseRowCursor(token string) (cursor *RowCursor, err error) {
+	cursor = &RowCursor{}
+	if token == "" {
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var list []interface{}
+	err = json.Unmarshal(data, &list)
+	if err != nil || len(list) < 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	peerKey, ok1 := list[len(list)-2].(string)
+	id, ok2 := list[len(list)-1].(string)
+	if !ok1 || !ok2 || peerKey == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	cursor.Values = list[0 : len(list)-2]
+	cursor.PeerKey = peerKey
+	cursor.ID = id
+	return
+}
+
+// IsStart returns true if the cursor has no position yet.
+func (c *RowCursor) IsStart() bool {
+	return c.PeerKey == ""
+}
+
+// String returns the cursor token.
+func (c *RowCursor) String() string {
+	if c.IsStart() {
+		return ""
+	}
+	list := make([]interface{}, 0, len(c.Values)+2)
+	list = append(list, c.Values...)
+	list = append(list, c.PeerKey, c.ID)
+	data, err := json.Marshal(list)
+	if err != nil {
+		log.Errorf("failed to encode cursor: %s", err.Error())
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Validate checks if the cursor values match the sort columns.
+func (c *RowCursor) Validate(sortFields []*SortField) error {
+	if c.IsStart() {
+		return nil
+	}
+	if len(c.Values) != len(sortFields) {
+		return fmt.Errorf("cursor does not match sort order")
+	}
+	for i, s := range sortFields {
+		var ok bool
+		switch cursorSortValue(nil, s.Column).(type) {
+		case float64:
+			_, ok = c.Values[i].(float64)
+		default:
+			_, ok = c.Values[i].(string)
+		}
+		if !ok {
+			return fmt.Errorf("cursor does not match sort order")
+		}
+	}
+	return nil
+}
+
+// Compare returns -1 if the row sorts before the cursor position, 0 if the row is the
+// cursor row itself and +1 if the row sorts after the cursor.
+func (c *RowCursor) Compare(row *DataRow, sortFields []*SortField) int {
+	if c.IsStart() {
+		return 1
+	}
+	for i, s := range sortFields {
+		var cmp int
+		switch val := cursorSortValue(row, s.Column).(type) {
+		case float64:
+			cmp = compareFloat(val, c.Values[i].(float64))
+		case string:
+			cmp = strings.Compare(val, c.Values[i].(string))
+		}
+		if cmp == 0 {
+			continue
+		}
+		if s.Direction == Desc {
+			return -cmp
+		}
+		return cmp
+	}
+	if cmp := strings.Compare(row.DataStore.PeerKey, c.PeerKey); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(row.GetID(), c.ID)
+}
+
+// compareRowIdentity compares two rows by peer key and primary key. It is used
+// as tie-breaker to get a stable sort order for cursor based pagination.
+func compareRowIdentity(a, b *DataRow) int {
+	if cmp := strings.Compare(a.DataStore.PeerKey, b.DataStore.PeerKey); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(a.GetID(), b.GetID())
+}
+
+// cursorSortValue returns the value used for sorting, numbers are compared as float
+// and everything else as string just like RawResultSet.Less does.
+// If row is nil, the zero value of the corresponding type is returned.
+func cursorSortValue(row *DataRow, col *Column) interface{} {
+	switch col.DataType {
+	case IntCol, Int64Col, FloatCol:
+		if row == nil {
+			return float64(0)
+		}
+		return row.GetFloat(col)
+	default:
+		if row == nil {
+			return ""
+		}
+		return row.GetString(col)
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
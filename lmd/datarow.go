@@ -15,12 +15,17 @@ import (
 
 const ListSepChar1 = "\x00"
 
+// dataRevision is incremented on each data update and used as revision of the row
+var dataRevision int64
+
 // DataRow represents a single entry in a DataTable
 type DataRow struct {
 	noCopy                noCopy                 // we don't want to make copies, use references
 	DataStore             *DataStore             // reference to the datastore itself
 	Refs                  map[TableName]*DataRow // contains references to other objects, ex.: hosts from the services table
 	LastUpdate            int64                  // timestamp when this row has been updated
+	Revision              int64                  // revision of the last update
+	seq                   int64                  // position in the datastore, used to sort rows from secondary indexes
 	dataString            []string               // stores string data
 	dataInt               []int                  // stores integers
 	dataInt64             []int64                // stores large integers
@@ -37,6 +42,7 @@ func NewDataRow(store *DataStore, raw []interface{}, columns ColumnList, timesta
 	d = &DataRow{
 		LastUpdate: timestamp,
 		DataStore:  store,
+		Revision:   atomic.LoadInt64(&dataRevision),
 	}
 	if raw == nil {
 		// virtual tables without data have no references or ids
@@ -100,6 +106,18 @@ func (d *DataRow) GetID2() (string, string) {
 	return id1, id2
 }
 
+// changedRevision returns the latest revision of the row and its referenced rows,
+// since columns of referenced rows, ex.: host_state of services, are part of the row as well.
+func (d *DataRow) changedRevision() int64 {
+	revision := d.Revision
+	for _, ref := range d.Refs {
+		if ref != nil && ref.Revision > revision {
+			revision = ref.Revision
+		}
+	}
+	return revision
+}
+
 // SetData creates initial data
 func (d *DataRow) SetData(raw []interface{}, columns ColumnList, timestamp int64) error {
 	d.dataString = make([]string, d.DataStore.DataSizes[StringCol])
@@ -111,7 +129,7 @@ func (d *DataRow) SetData(raw []interface{}, columns ColumnList, timestamp int64
 	d.dataServiceMemberList = make([][]ServiceMember, d.DataStore.DataSizes[ServiceMemberListCol])
 	d.dataInterfaceList = make([][]interface{}, d.DataStore.DataSizes[InterfaceListCol])
 	d.dataStringLarge = make([]StringContainer, d.DataStore.DataSizes[StringLargeCol])
-	return d.UpdateValues(0, raw, columns, timestamp)
+	return d.setValues(0, raw, columns, timestamp)
 }
 
 // setLowerCaseCache sets lowercase columns
@@ -144,6 +162,10 @@ func (d *DataRow) SetReferences() (err error) {
 			return fmt.Errorf("%s reference not found from table %s, refmap contains %d elements", tableName.String(), store.Table.Name.String(), len(refsByName))
 		}
 	}
+	// indexes on referenced columns can only be built once the references are set
+	if len(store.SecondaryIndexes) > 0 {
+		store.updateSecondaryIndexes(d)
+	}
 	return
 }
 
@@ -698,17 +720,17 @@ func (d *DataRow) MatchFilter(filter *Filter) bool {
 	case And:
 		for _, f := range filter.Filter {
 			if !d.MatchFilter(f) {
-				return false
+				return filter.Negate
 			}
 		}
-		return true
+		return !filter.Negate
 	case Or:
 		for _, f := range filter.Filter {
 			if d.MatchFilter(f) {
-				return true
+				return !filter.Negate
 			}
 		}
-		return false
+		return filter.Negate
 	}
 
 	// if this is a optional column and we do not meet the requirements, match against an empty default column
@@ -748,9 +770,24 @@ func (d *DataRow) getStatsKey(res *Response) string {
 
 // UpdateValues updates this datarow with new values
 func (d *DataRow) UpdateValues(dataOffset int, data []interface{}, columns ColumnList, timestamp int64) error {
+	err := d.setValues(dataOffset, data, columns, timestamp)
+	if err != nil {
+		return err
+	}
+	d.Revision = d.DataStore.bumpRevision()
+	return nil
+}
+
+// setValues sets new values without changing the revision
+func (d *DataRow) setValues(dataOffset int, data []interface{}, columns ColumnList, timestamp int64) error {
 	if len(columns) != len(data)-dataOffset {
 		return fmt.Errorf("table %s update failed, data size mismatch, expected %d columns and got %d", d.DataStore.Table.Name.String(), len(columns), len(data))
 	}
+	counters := d.DataStore.TacCounters
+	var tacKey tacCounterKey
+	if counters.isReady() {
+		tacKey = counters.key(d)
+	}
 	for i, col := range columns {
 		if col.StorageType != LocalStore {
 			continue
@@ -791,6 +828,12 @@ func (d *DataRow) UpdateValues(dataOffset int, data []interface{}, columns Colum
 		timestamp = time.Now().Unix()
 	}
 	d.LastUpdate = timestamp
+	if len(d.DataStore.SecondaryIndexes) > 0 {
+		d.DataStore.updateSecondaryIndexes(d)
+	}
+	if counters.isReady() {
+		counters.update(d, tacKey)
+	}
 	return nil
 }
 
@@ -799,6 +842,11 @@ func (d *DataRow) UpdateValuesNumberOnly(dataOffset int, data []interface{}, col
 	if len(columns) != len(data)-dataOffset {
 		return fmt.Errorf("table %s update failed, data size mismatch, expected %d columns and got %d", d.DataStore.Table.Name.String(), len(columns), len(data))
 	}
+	counters := d.DataStore.TacCounters
+	var tacKey tacCounterKey
+	if counters.isReady() {
+		tacKey = counters.key(d)
+	}
 	for i := range columns {
 		col := columns[i]
 		i += dataOffset
@@ -816,6 +864,13 @@ func (d *DataRow) UpdateValuesNumberOnly(dataOffset int, data []interface{}, col
 		}
 	}
 	d.LastUpdate = timestamp
+	d.Revision = d.DataStore.bumpRevision()
+	if len(d.DataStore.SecondaryIndexes) > 0 {
+		d.DataStore.updateSecondaryIndexes(d)
+	}
+	if counters.isReady() {
+		counters.update(d, tacKey)
+	}
 	return nil
 }
 
@@ -1348,6 +1403,10 @@ func (d *DataRow) isAuthorizedFor(authUser string, host string, service string)
 	p := d.DataStore.Peer
 	ds := d.DataStore.DataSet
 
+	if ds.authIndex.isUsable(p.GlobalConfig) {
+		return ds.authIndex.isAuthorizedFor(authUser, host, service)
+	}
+
 	// get contacts for host, if we are checking a host or
 	// if this is a service and ServiceAuthorization is loose
 	if (service != "" && p.GlobalConfig.ServiceAuthorization == AuthLoose) || service == "" {
@@ -1388,6 +1447,10 @@ func (d *DataRow) isAuthorizedForHostGroup(authUser string, hostgroup string) (c
 	ds := d.DataStore.DataSet
 	canView = false
 
+	if ds.authIndex.isUsable(p.GlobalConfig) {
+		return ds.authIndex.isAuthorizedForHostGroup(authUser, hostgroup)
+	}
+
 	hostgroupObj, ok := ds.tables[TableHostgroups].Index[hostgroup]
 	membersColumn := ds.tables[TableHostgroups].GetColumn("members")
 	if !ok {
@@ -1428,6 +1491,10 @@ func (d *DataRow) isAuthorizedForServiceGroup(authUser string, servicegroup stri
 	ds := d.DataStore.DataSet
 	canView = false
 
+	if ds.authIndex.isUsable(p.GlobalConfig) {
+		return ds.authIndex.isAuthorizedForServiceGroup(authUser, servicegroup)
+	}
+
 	servicegroupObj, ok := ds.tables[TableServicegroups].Index[servicegroup]
 	membersColumn := ds.tables[TableServicegroups].GetColumn("members")
 	if !ok {
@@ -1513,6 +1580,17 @@ func (d *DataRow) checkAuth(authUser string) (canView bool) {
 			hostgroupName := d.dataString[hostgroupIndex]
 			canView = d.isAuthorizedFor(authUser, hostName, serviceDescription) && d.isAuthorizedForHostGroup(authUser, hostgroupName)
 		}
+	case TableLog:
+		hostIndex := table.GetColumn("host_name").Index
+		serviceIndex := table.GetColumn("service_description").Index
+		hostName := d.dataString[hostIndex]
+		serviceDescription := d.dataString[serviceIndex]
+		// log entries without host are not related to any object, ex.: program messages
+		canView = hostName == "" || d.isAuthorizedFor(authUser, hostName, serviceDescription)
+	case TableStatechanges:
+		hostIndex := table.GetColumn("host_name").Index
+		serviceIndex := table.GetColumn("service_description").Index
+		canView = d.isAuthorizedFor(authUser, d.dataString[hostIndex], d.dataString[serviceIndex])
 	case TableDowntimes, TableComments:
 		hostIndex := table.GetColumn("host_name").Index
 		serviceIndex := table.GetColumn("service_description").Index
@@ -1544,6 +1622,16 @@ func (d *DataRow) CountStats(stats []*Filter, result []*Filter) {
 			if d.MatchFilter(s) {
 				d.CountStats(s.Filter, result)
 			}
+		case CountDistinct:
+			// list columns count each list element
+			if s.Column.DataType == StringListCol {
+				for _, val := range d.GetStringList(s.Column) {
+					result[resultPos].ApplyDistinctValue(val, 0)
+				}
+				result[resultPos].StatsCount++
+			} else {
+				result[resultPos].ApplyDistinctValue(d.GetString(s.Column), 1)
+			}
 		default:
 			result[resultPos].ApplyValue(d.GetFloat(s.Column), 1)
 		}
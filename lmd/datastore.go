@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,6 +25,10 @@ type DataStore struct {
 	dupStringList           map[[32]byte][]string          // lookup pointer to other stringlists during initialization
 	PeerLockMode            PeerLockMode                   // flag wether datarow have to set PeerLock when accessing status
 	LowerCaseColumns        map[int]int                    // list of string column indexes with their coresponding lower case index
+	SecondaryIndexes        []*SecondaryIndex              // configured indexes on non primary key columns
+	nextSeq                 int64                          // position of the next added row
+	TacCounters             *TacCounters                   // aggregated counters for stats queries, nil if not available
+	ResyncRevision          int64                          // rows might have been removed after this revision
 }
 
 // NewDataStore creates a new datastore with columns based on given flags
@@ -75,6 +80,19 @@ func NewDataStore(table *Table, peer interface{}) (d *DataStore) {
 		}
 	}
 	d.DataSizes = dataSizes
+
+	// create configured secondary indexes for this table
+	if d.Peer != nil && d.Peer.GlobalConfig != nil {
+		for _, definition := range d.Peer.GlobalConfig.SecondaryIndexes {
+			index, indexTable, err := NewSecondaryIndex(definition)
+			if err != nil || indexTable != table {
+				continue
+			}
+			d.SecondaryIndexes = append(d.SecondaryIndexes, index)
+		}
+	}
+	d.TacCounters = NewTacCounters(table)
+
 	// prepend primary keys to dynamic keys, since they are required to map the results back to specific items
 	if len(d.DynamicColumnNamesCache) > 0 {
 		d.DynamicColumnNamesCache = append(d.Table.PrimaryKey, d.DynamicColumnNamesCache...)
@@ -123,6 +141,7 @@ func (d *DataStore) AppendData(data ResultSet, columns ColumnList) error {
 		if nErr != nil {
 			return nErr
 		}
+		row.Revision = d.bumpRevision()
 		d.AddItem(row)
 	}
 	return nil
@@ -131,6 +150,10 @@ func (d *DataStore) AppendData(data ResultSet, columns ColumnList) error {
 // InsertItem adds an new DataRow to a DataStore at given Index.
 func (d *DataStore) InsertItem(index int, row *DataRow) {
 	d.Data[index] = row
+	row.seq = int64(index)
+	if row.seq >= d.nextSeq {
+		d.nextSeq = row.seq + 1
+	}
 	switch len(d.Table.PrimaryKey) {
 	case 0:
 	case 1:
@@ -149,6 +172,8 @@ func (d *DataStore) InsertItem(index int, row *DataRow) {
 // AddItem adds an new DataRow to a DataStore.
 func (d *DataStore) AddItem(row *DataRow) {
 	d.Data = append(d.Data, row)
+	row.seq = d.nextSeq
+	d.nextSeq++
 	switch len(d.Table.PrimaryKey) {
 	case 0:
 	case 1:
@@ -173,6 +198,10 @@ func (d *DataStore) RemoveItem(row *DataRow) {
 	default:
 		panic("not supported number of primary keys")
 	}
+	for _, idx := range d.SecondaryIndexes {
+		idx.remove(row)
+	}
+	atomic.StoreInt64(&d.ResyncRevision, d.bumpRevision())
 	for i := range d.Data {
 		if d.Data[i] == row {
 			d.Data = append(d.Data[:i], d.Data[i+1:]...)
@@ -182,6 +211,15 @@ func (d *DataStore) RemoveItem(row *DataRow) {
 	log.Panicf("element not found")
 }
 
+// bumpRevision returns a new data revision and marks the data of the peer as changed.
+// Temporary stores, ex.: for virtual tables, are not updated and must not call this.
+func (d *DataStore) bumpRevision() int64 {
+	if d.Peer != nil {
+		atomic.AddInt64(&d.Peer.revision, 1)
+	}
+	return atomic.AddInt64(&dataRevision, 1)
+}
+
 // SetReferences creates reference entries for this tables
 func (d *DataStore) SetReferences() (err error) {
 	for _, row := range d.Data {
@@ -191,6 +229,9 @@ func (d *DataStore) SetReferences() (err error) {
 			return
 		}
 	}
+	if d.TacCounters != nil {
+		d.TacCounters.rebuild(d.Data)
+	}
 	return
 }
 
@@ -234,23 +275,39 @@ type getPreFilteredDataFilter func(*DataStore, map[string]bool, *Filter) bool
 
 // GetPreFilteredData returns d.Data but try to return reduced dataset by using host / service index if table supports it
 func (d *DataStore) GetPreFilteredData(filter []*Filter) []*DataRow {
+	data, _ := d.GetPreFilteredDataIndex(filter)
+	return data
+}
+
+// GetPreFilteredDataIndex works like GetPreFilteredData and additionally returns the name
+// of the used index or an empty string if all rows have to be scanned.
+func (d *DataStore) GetPreFilteredDataIndex(filter []*Filter) (data []*DataRow, index string) {
 	if len(filter) == 0 {
-		return d.Data
+		return d.Data, ""
 	}
 	switch d.Table.Name {
 	case TableHosts:
-		return (d.tryFilterIndexData(filter, appendIndexHostsFromHostColumns))
+		data = d.tryFilterIndexData(filter, appendIndexHostsFromHostColumns)
+		index = "hosts.name"
 	case TableServices:
-		return (d.tryFilterIndexData(filter, appendIndexHostsFromServiceColumns))
+		data = d.tryFilterIndexData(filter, appendIndexHostsFromServiceColumns)
+		index = "services.host_name"
+	}
+	if data == nil {
+		data, index = d.trySecondaryIndexData(filter)
+	}
+	if data == nil {
+		return d.Data, ""
 	}
-	return d.Data
+	return data, index
 }
 
+// tryFilterIndexData returns the rows found by the host index or nil if the index cannot be used
 func (d *DataStore) tryFilterIndexData(filter []*Filter, fn getPreFilteredDataFilter) []*DataRow {
 	uniqHosts := make(map[string]bool)
 	ok := d.TryFilterIndex(uniqHosts, filter, fn, false)
 	if !ok {
-		return d.Data
+		return nil
 	}
 	// sort and return list of index names used
 	hostlist := []string{}
@@ -259,7 +316,7 @@ func (d *DataStore) tryFilterIndexData(filter []*Filter, fn getPreFilteredDataFi
 	}
 	sort.Strings(hostlist)
 	if len(hostlist) == 0 {
-		return d.Data
+		return nil
 	}
 	indexedData := make([]*DataRow, 0)
 	switch d.Table.Name {
@@ -5,6 +5,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/sasha-s/go-deadlock"
@@ -12,9 +13,10 @@ import (
 
 // DataStoreSet is the handle to a peers datastores
 type DataStoreSet struct {
-	peer   *Peer
-	Lock   *deadlock.RWMutex
-	tables map[TableName]*DataStore
+	peer      *Peer
+	Lock      *deadlock.RWMutex
+	tables    map[TableName]*DataStore
+	authIndex *AuthIndex // precomputed contact visibility, nil if not available
 }
 
 func NewDataStoreSet(peer *Peer) *DataStoreSet {
@@ -30,6 +32,8 @@ func (ds *DataStoreSet) Set(name TableName, store *DataStore) {
 	ds.Lock.Lock()
 	ds.tables[name] = store
 	store.DataSet = ds
+	// all rows have been replaced
+	atomic.StoreInt64(&store.ResyncRevision, store.bumpRevision())
 	ds.Lock.Unlock()
 }
 
@@ -100,6 +104,7 @@ func (ds *DataStoreSet) SetReferences() (err error) {
 			return
 		}
 	}
+	ds.authIndex = NewAuthIndex(ds)
 	return
 }
 
@@ -170,6 +175,38 @@ func (ds *DataStoreSet) UpdateDelta(from, to int64) (err error) {
 		return
 	}
 
+	if ds.peer.isIcinga2API() {
+		err = ds.updateDeltaIcinga2API()
+	} else {
+		err = ds.updateDeltaLivestatus(from, to)
+	}
+	if err != nil {
+		return err
+	}
+
+	p := ds.peer
+	duration := time.Since(t1)
+	logWith(p).Debugf("delta update complete in: %s", duration.String())
+
+	p.Lock.Lock()
+	peerStatus := p.Status[PeerState].(PeerStatus)
+	p.resetErrors()
+	p.Status[LastUpdate] = to
+	p.Status[ResponseTime] = duration.Seconds()
+	p.Lock.Unlock()
+
+	if peerStatus != PeerStatusUp && peerStatus != PeerStatusPending {
+		logWith(p).Infof("site soft recovered from short outage")
+	}
+
+	promPeerUpdates.WithLabelValues(p.Name).Inc()
+	promPeerUpdateDuration.WithLabelValues(p.Name).Set(duration.Seconds())
+	return
+}
+
+// updateDeltaLivestatus fetches all hosts and services changed between from and to
+// along with new comments and downtimes.
+func (ds *DataStoreSet) updateDeltaLivestatus(from, to int64) (err error) {
 	updateOffset := ds.peer.GlobalConfig.UpdateOffset
 
 	filterStr := ""
@@ -202,24 +239,6 @@ func (ds *DataStoreSet) UpdateDelta(from, to int64) (err error) {
 	if err != nil {
 		return err
 	}
-
-	p := ds.peer
-	duration := time.Since(t1)
-	logWith(p).Debugf("delta update complete in: %s", duration.String())
-
-	p.Lock.Lock()
-	peerStatus := p.Status[PeerState].(PeerStatus)
-	p.resetErrors()
-	p.Status[LastUpdate] = to
-	p.Status[ResponseTime] = duration.Seconds()
-	p.Lock.Unlock()
-
-	if peerStatus != PeerStatusUp && peerStatus != PeerStatusPending {
-		logWith(p).Infof("site soft recovered from short outage")
-	}
-
-	promPeerUpdates.WithLabelValues(p.Name).Inc()
-	promPeerUpdateDuration.WithLabelValues(p.Name).Set(duration.Seconds())
 	return
 }
 
@@ -287,10 +306,16 @@ func (ds *DataStoreSet) insertDeltaDataResult(dataOffset int, res ResultSet, res
 	}
 	now := time.Now().Unix()
 
+	history := ds.peer.stateChanges
+	stateColumns := newStateChangeColumns(table)
 	ds.Lock.Lock()
 	defer ds.Lock.Unlock()
 	for i := range updateSet {
 		update := updateSet[i]
+		var oldState [3]int
+		if history != nil && stateColumns != nil {
+			oldState = stateColumns.values(update.DataRow)
+		}
 		if update.FullUpdate {
 			err = update.DataRow.UpdateValues(dataOffset, update.ResultRow, table.DynamicColumnCache, now)
 		} else {
@@ -299,6 +324,7 @@ func (ds *DataStoreSet) insertDeltaDataResult(dataOffset int, res ResultSet, res
 		if err != nil {
 			return
 		}
+		history.Record(stateColumns, update.DataRow, oldState, now)
 	}
 
 	duration := time.Since(t1).Truncate(time.Millisecond)
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/sasha-s/go-deadlock"
+)
+
+// QueryPlan describes how a request has been processed. It is returned instead
+// of the result for requests with the Explain header.
+type QueryPlan struct {
+	noCopy         noCopy
+	lock           *deadlock.Mutex
+	Start          time.Time
+	Mode           string // local, passthrough or distributed
+	Peers          []*QueryPlanPeer
+	FilterDuration time.Duration // time spent gathering and filtering rows on all peers
+	SortDuration   time.Duration // time spent sorting the result
+	EncodeDuration time.Duration // time spent encoding the result in the requested output format
+	EncodedSize    int64         // size of the encoded result in bytes
+	RemoteScanned  int           // rows scanned on other cluster nodes
+	RemoteTotal    int           // result rows on other cluster nodes
+}
+
+// QueryPlanPeer contains the plan details for a single peer.
+type QueryPlanPeer struct {
+	noCopy      noCopy
+	PeerKey     string
+	PeerName    string
+	Node        string // cluster node which processed this peer, empty for local peers
+	Index       string // name of the used index, empty for a full scan
+	RowsScanned int
+	RowsMatched int
+	Duration    time.Duration
+}
+
+// NewQueryPlan creates a new query plan which starts measuring time now.
+func NewQueryPlan(mode string) *QueryPlan {
+	return &QueryPlan{
+		lock:  new(deadlock.Mutex),
+		Start: time.Now(),
+		Mode:  mode,
+		Peers: make([]*QueryPlanPeer, 0),
+	}
+}
+
+// AddPeer adds the plan details of a peer, it is safe to call from parallel peer go routines.
+func (p *QueryPlan) AddPeer(peer *QueryPlanPeer) {
+	p.lock.Lock()
+	p.Peers = append(p.Peers, peer)
+	if peer.Duration > p.FilterDuration {
+		p.FilterDuration = peer.Duration
+	}
+	p.lock.Unlock()
+}
+
+// AddRemotePlan adds the peers and totals from the query plan of another cluster node.
+func (p *QueryPlan) AddRemotePlan(node string, plan map[string]interface{}) {
+	peers, _ := plan["peers"].([]interface{})
+	for _, raw := range peers {
+		peer, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		index, _ := peer["index"].(string)
+		p.AddPeer(&QueryPlanPeer{
+			PeerKey:     interface2stringNoDedup(peer["peer_key"]),
+			PeerName:    interface2stringNoDedup(peer["peer_name"]),
+			Node:        node,
+			Index:       index,
+			RowsScanned: interface2int(peer["rows_scanned"]),
+			RowsMatched: interface2int(peer["rows_matched"]),
+			Duration:    time.Duration(interface2float64(peer["duration"]) * float64(time.Second)),
+		})
+	}
+	p.lock.Lock()
+	p.RemoteScanned += interface2int(plan["rows_scanned"])
+	p.RemoteTotal += interface2int(plan["total_count"])
+	p.lock.Unlock()
+}
+
+// WriteQueryPlan encodes the result to measure the encoding time and writes the query plan as json.
+func (res *Response) WriteQueryPlan(buf io.Writer) error {
+	plan := res.Plan
+	t1 := time.Now()
+	countingWriter := NewWriteCounter(ioutil.Discard)
+	err := res.WriteResult(countingWriter)
+	if err != nil {
+		return err
+	}
+	plan.EncodeDuration = time.Since(t1)
+	plan.EncodedSize = countingWriter.Count
+
+	req := res.Request
+	json := jsoniter.ConfigCompatibleWithStandardLibrary.BorrowStream(buf)
+	defer jsoniter.ConfigCompatibleWithStandardLibrary.ReturnStream(json)
+
+	json.WriteObjectStart()
+	json.WriteObjectField("table")
+	json.WriteString(req.Table.String())
+	json.WriteMore()
+	json.WriteObjectField("mode")
+	json.WriteString(plan.Mode)
+	json.WriteMore()
+	json.WriteObjectField("filter")
+	json.WriteVal(explainFilter(req.Filter, ""))
+	json.WriteMore()
+	json.WriteObjectField("stats")
+	json.WriteVal(explainFilter(req.Stats, "Stats"))
+	json.WriteMore()
+	json.WriteObjectField("sort")
+	sort := make([]string, 0, len(req.Sort))
+	for _, s := range req.Sort {
+		sort = append(sort, s.Name+" "+s.Direction.String())
+	}
+	json.WriteVal(sort)
+	json.WriteMore()
+	json.WriteObjectField("limit")
+	if req.Limit != nil {
+		json.WriteInt(*req.Limit)
+	} else {
+		json.WriteNil()
+	}
+	json.WriteMore()
+	json.WriteObjectField("offset")
+	json.WriteInt(req.Offset)
+	json.WriteMore()
+	json.WriteObjectField("peers")
+	json.WriteArrayStart()
+	for i, peer := range plan.Peers {
+		if i > 0 {
+			json.WriteMore()
+		}
+		json.WriteObjectStart()
+		json.WriteObjectField("peer_key")
+		json.WriteString(peer.PeerKey)
+		json.WriteMore()
+		json.WriteObjectField("peer_name")
+		json.WriteString(peer.PeerName)
+		json.WriteMore()
+		if peer.Node != "" {
+			json.WriteObjectField("node")
+			json.WriteString(peer.Node)
+			json.WriteMore()
+		}
+		json.WriteObjectField("index")
+		if peer.Index != "" {
+			json.WriteString(peer.Index)
+		} else {
+			json.WriteNil()
+		}
+		json.WriteMore()
+		json.WriteObjectField("rows_scanned")
+		json.WriteInt(peer.RowsScanned)
+		json.WriteMore()
+		json.WriteObjectField("rows_matched")
+		json.WriteInt(peer.RowsMatched)
+		json.WriteMore()
+		json.WriteObjectField("duration")
+		json.WriteFloat64(peer.Duration.Seconds())
+		json.WriteObjectEnd()
+	}
+	json.WriteArrayEnd()
+	json.WriteMore()
+	json.WriteObjectField("timings")
+	json.WriteObjectStart()
+	json.WriteObjectField("filter")
+	json.WriteFloat64(plan.FilterDuration.Seconds())
+	json.WriteMore()
+	json.WriteObjectField("sort")
+	json.WriteFloat64(plan.SortDuration.Seconds())
+	json.WriteMore()
+	json.WriteObjectField("encode")
+	json.WriteFloat64(plan.EncodeDuration.Seconds())
+	json.WriteMore()
+	json.WriteObjectField("total")
+	json.WriteFloat64(time.Since(plan.Start).Seconds())
+	json.WriteObjectEnd()
+	json.WriteMore()
+	json.WriteObjectField("rows_scanned")
+	json.WriteInt(res.RowsScanned)
+	json.WriteMore()
+	json.WriteObjectField("total_count")
+	json.WriteInt(res.ResultTotal)
+	json.WriteMore()
+	json.WriteObjectField("result_size")
+	json.WriteInt64(plan.EncodedSize)
+	json.WriteObjectEnd()
+
+	return json.Flush()
+}
+
+// explainFilter returns the filter lines including internal operators and columns.
+func explainFilter(filter []*Filter, prefix string) []string {
+	lines := make([]string, 0)
+	for _, f := range filter {
+		lines = append(lines, strings.Split(strings.TrimSpace(f.format(prefix, true)), "\n")...)
+	}
+	return lines
+}
@@ -39,6 +39,11 @@ func (ex *Exporter) Export(file string, localConfig *Config) (err error) {
 	ex.config = localConfig
 	ex.initPeers(ex.config)
 
+	return ex.writeTarball(file, ex.exportPeers)
+}
+
+// writeTarball creates a gzipped tarball and calls fn to add its content
+func (ex *Exporter) writeTarball(file string, fn func() error) (err error) {
 	userinfo, err := user.Current()
 	if err != nil {
 		return fmt.Errorf("failed to fetch user info: %s", err)
@@ -66,11 +71,22 @@ func (ex *Exporter) Export(file string, localConfig *Config) (err error) {
 	ex.tar = tarWriter
 	ex.exportTime = time.Now()
 
-	err = ex.exportPeers()
+	err = fn()
 	if err != nil {
 		return err
 	}
 
+	// close explicitly to catch write errors, the deferred calls will be noops then
+	if err = tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write tarball: %s", err)
+	}
+	if err = gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write tarball: %s", err)
+	}
+	if err = tarball.Close(); err != nil {
+		return fmt.Errorf("failed to write tarball: %s", err)
+	}
+
 	return
 }
 
@@ -87,38 +103,47 @@ func (ex *Exporter) exportPeers() (err error) {
 			continue
 		}
 		log.Debugf("exporting %s (%s)", p.Name, p.ID)
-		err = ex.addDir(fmt.Sprintf("sites/%s/", p.ID))
-		if err != nil {
-			return
-		}
-		total := int64(0)
-		written := int64(0)
-		written, err = ex.addTable(p, Objects.Tables[TableSites])
+		var total int64
+		total, err = ex.exportPeer(p)
 		if err != nil {
 			return
 		}
-		total += written
-		for _, t := range Objects.Tables {
-			switch {
-			case t.PassthroughOnly:
-				continue
-			case t.Name == TableBackends:
-				continue
-			case t.Name == TableSites:
-				continue
-			case t.Name == TableColumns:
-				continue
-			case t.Virtual != nil:
-				continue
-			default:
-				written, err = ex.addTable(p, t)
-				if err != nil {
-					return
-				}
-				total += written
+		log.Infof("exported %10s (%5s), used space: %8d kb", p.Name, p.ID, total/1024)
+	}
+	return
+}
+
+// exportPeer adds the sites entry and all cached tables of a single peer
+func (ex *Exporter) exportPeer(p *Peer) (total int64, err error) {
+	err = ex.addDir(fmt.Sprintf("sites/%s/", p.ID))
+	if err != nil {
+		return
+	}
+	written := int64(0)
+	written, err = ex.addTable(p, Objects.Tables[TableSites])
+	if err != nil {
+		return
+	}
+	total += written
+	for _, t := range Objects.Tables {
+		switch {
+		case t.PassthroughOnly:
+			continue
+		case t.Name == TableBackends:
+			continue
+		case t.Name == TableSites:
+			continue
+		case t.Name == TableColumns:
+			continue
+		case t.Virtual != nil:
+			continue
+		default:
+			written, err = ex.addTable(p, t)
+			if err != nil {
+				return
 			}
+			total += written
 		}
-		log.Infof("exported %10s (%5s), used space: %8d kb", p.Name, p.ID, total/1024)
 	}
 	return
 }
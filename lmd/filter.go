@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,15 +15,19 @@ import (
 // StatsType is the stats operator.
 type StatsType uint8
 
-// Besides the Counter, which counts the data rows by using a filter, there are 4 aggregations
-// operators: Sum, Average, Min and Max.
+// Besides the Counter, which counts the data rows by using a filter, there are the aggregations
+// operators: Sum, Average, Min, Max, Percentile, Median, StdDev and CountDistinct.
 const (
 	NoStats StatsType = iota
 	Counter
-	Sum     // sum
-	Average // avg
-	Min     // min
-	Max     // max
+	Sum           // sum
+	Average       // avg
+	Min           // min
+	Max           // max
+	Percentile    // percentileNN
+	Median        // median
+	StdDev        // stddev
+	CountDistinct // count_distinct
 	StatsGroup
 )
 
@@ -39,6 +46,14 @@ func (op *StatsType) String() string {
 		return "min"
 	case Max:
 		return "Max"
+	case Percentile:
+		return "percentile"
+	case Median:
+		return "median"
+	case StdDev:
+		return "stddev"
+	case CountDistinct:
+		return "count_distinct"
 	default:
 		log.Panicf("not implemented: %#v", op)
 	}
@@ -63,10 +78,14 @@ type Filter struct {
 	GroupOperator GroupOperator
 
 	// stats query
-	Stats      float64
-	StatsCount int
-	StatsType  StatsType
-	StatsPos   int // position in stats result array
+	Stats           float64
+	StatsCount      int
+	StatsType       StatsType
+	StatsPos        int             // position in stats result array
+	StatsValues     []float64       // collected values for percentile and median
+	StatsSquares    float64         // sum of squares for stddev
+	StatsPercentile float64         // requested percentile, ex.: 95 for percentile95
+	StatsDistinct   map[string]bool // distinct values for count_distinct
 
 	// copy of Column.Optional
 	ColumnOptional OptionalFlags
@@ -149,14 +168,37 @@ func (op *Operator) String() string {
 	return ""
 }
 
+// explainString returns the operator including internal only operators which
+// are used for optimized regular expression filters.
+func (op *Operator) explainString() string {
+	switch *op {
+	case Contains:
+		return ("contains")
+	case ContainsNot:
+		return ("!contains")
+	case ContainsNoCase:
+		return ("contains_nocase")
+	case ContainsNoCaseNot:
+		return ("!contains_nocase")
+	}
+	return op.String()
+}
+
 // String converts a filter back to its string representation.
 func (f *Filter) String(prefix string) (str string) {
+	return f.format(prefix, false)
+}
+
+// format returns the filter as livestatus header lines. With explain set, internal
+// operators and lower case columns are kept, so optimizations become visible.
+func (f *Filter) format(prefix string, explain bool) (str string) {
 	if f.GroupOperator == And || f.GroupOperator == Or {
 		if len(f.Filter) > 0 {
 			for i := range f.Filter {
-				str += f.Filter[i].String(prefix)
+				str += f.Filter[i].format(prefix, explain)
 			}
 			str += fmt.Sprintf("%s%s: %d\n", prefix, f.GroupOperator.String(), len(f.Filter))
+			str += f.negateString(prefix)
 			return
 		}
 	}
@@ -167,30 +209,52 @@ func (f *Filter) String(prefix string) (str string) {
 	}
 
 	// trim lower case columns prefix, they are used internally only
-	colName := strings.TrimSuffix(f.Column.Name, "_lc")
+	colName := f.Column.Name
+	if !explain {
+		colName = strings.TrimSuffix(colName, "_lc")
+	}
 
 	switch f.StatsType {
 	case NoStats:
 		if prefix == "" {
 			prefix = "Filter"
 		}
-		str = fmt.Sprintf("%s: %s %s%s\n", prefix, colName, f.Operator.String(), strVal)
+		str = fmt.Sprintf("%s: %s %s%s\n", prefix, colName, f.operatorString(explain), strVal)
 	case StatsGroup:
 		if prefix == "" {
 			prefix = "Filter"
 		}
-		str = fmt.Sprintf("%sGroup: %s %s%s\n", prefix, colName, f.Operator.String(), strVal)
+		str = fmt.Sprintf("%sGroup: %s %s%s\n", prefix, colName, f.operatorString(explain), strVal)
 	case Counter:
-		str = fmt.Sprintf("Stats: %s %s%s\n", colName, f.Operator.String(), strVal)
+		str = fmt.Sprintf("Stats: %s %s%s\n", colName, f.operatorString(explain), strVal)
+	case Percentile:
+		str = fmt.Sprintf("Stats: percentile%s %s\n", strconv.FormatFloat(f.StatsPercentile, 'f', -1, 64), colName)
 	default:
 		str = fmt.Sprintf("Stats: %s %s\n", f.StatsType.String(), colName)
 	}
-	if f.Negate {
-		str += fmt.Sprintf("%s\n", "Negate:")
-	}
+	str += f.negateString(prefix)
 	return
 }
 
+// operatorString returns the filter operator, including internal operators for explain output
+func (f *Filter) operatorString(explain bool) string {
+	if explain {
+		return f.Operator.explainString()
+	}
+	return f.Operator.String()
+}
+
+// negateString returns the negate header if this filter is negated
+func (f *Filter) negateString(prefix string) string {
+	if !f.Negate {
+		return ""
+	}
+	if prefix == "Stats" {
+		return "StatsNegate:\n"
+	}
+	return "Negate:\n"
+}
+
 // Equals returns true if both filter are exactly identical
 func (f *Filter) Equals(o *Filter) bool {
 	if f.Column != o.Column {
@@ -211,6 +275,9 @@ func (f *Filter) Equals(o *Filter) bool {
 	if f.StatsType != o.StatsType {
 		return false
 	}
+	if f.StatsPercentile != o.StatsPercentile {
+		return false
+	}
 	if f.GroupOperator != o.GroupOperator {
 		return false
 	}
@@ -278,12 +345,130 @@ func (f *Filter) ApplyValue(val float64, count int) {
 		if f.Stats < value {
 			f.Stats = value
 		}
+	case Percentile, Median:
+		f.StatsValues = append(f.StatsValues, val)
+	case StdDev:
+		f.Stats += val
+		f.StatsSquares += val * val
+	case CountDistinct:
+		f.addDistinctValue(strconv.FormatFloat(val, 'f', -1, 64))
 	default:
 		panic("not implemented stats type")
 	}
 	f.StatsCount += count
 }
 
+// MergeStats merges the intermediate stats result from another stats filter into this one
+func (f *Filter) MergeStats(o *Filter) {
+	switch f.StatsType {
+	case Percentile, Median:
+		f.StatsValues = append(f.StatsValues, o.StatsValues...)
+		f.StatsCount += o.StatsCount
+	case StdDev:
+		f.Stats += o.Stats
+		f.StatsSquares += o.StatsSquares
+		f.StatsCount += o.StatsCount
+	case CountDistinct:
+		for val := range o.StatsDistinct {
+			f.addDistinctValue(val)
+		}
+		f.StatsCount += o.StatsCount
+	default:
+		f.ApplyValue(o.Stats, o.StatsCount)
+	}
+}
+
+// ApplyDistinctValue adds the given value to this count_distinct stats filter
+func (f *Filter) ApplyDistinctValue(val string, count int) {
+	f.addDistinctValue(val)
+	f.StatsCount += count
+}
+
+func (f *Filter) addDistinctValue(val string) {
+	if f.StatsDistinct == nil {
+		f.StatsDistinct = make(map[string]bool)
+	}
+	f.StatsDistinct[val] = true
+}
+
+// StatsData returns the intermediate stats result which is sent to other cluster nodes.
+// It contains the value and the count and, depending on the stats type, the raw values,
+// the distinct values or the sum of squares.
+func (f *Filter) StatsData() []interface{} {
+	switch f.StatsType {
+	case Percentile, Median:
+		return []interface{}{f.Stats, f.StatsCount, f.StatsValues}
+	case StdDev:
+		return []interface{}{f.Stats, f.StatsCount, f.StatsSquares}
+	case CountDistinct:
+		distinct := make([]string, 0, len(f.StatsDistinct))
+		for val := range f.StatsDistinct {
+			distinct = append(distinct, val)
+		}
+		return []interface{}{f.Stats, f.StatsCount, distinct}
+	}
+	return []interface{}{f.Stats, f.StatsCount}
+}
+
+// ApplyStatsData merges intermediate stats data as created by StatsData into this stats filter
+func (f *Filter) ApplyStatsData(raw interface{}) {
+	data := reflect.ValueOf(raw)
+	value := interface2float64(data.Index(0).Interface())
+	count := int(interface2float64(data.Index(1).Interface()))
+	switch f.StatsType {
+	case Percentile, Median:
+		if data.Len() > 2 {
+			list := reflect.ValueOf(data.Index(2).Interface())
+			if list.Kind() == reflect.Slice {
+				for i := 0; i < list.Len(); i++ {
+					f.StatsValues = append(f.StatsValues, interface2float64(list.Index(i).Interface()))
+				}
+			}
+		}
+		f.StatsCount += count
+	case StdDev:
+		f.Stats += value
+		if data.Len() > 2 {
+			f.StatsSquares += interface2float64(data.Index(2).Interface())
+		}
+		f.StatsCount += count
+	case CountDistinct:
+		if data.Len() > 2 {
+			list := reflect.ValueOf(data.Index(2).Interface())
+			if list.Kind() == reflect.Slice {
+				for i := 0; i < list.Len(); i++ {
+					f.addDistinctValue(interface2stringNoDedup(list.Index(i).Interface()))
+				}
+			}
+		}
+		f.StatsCount += count
+	default:
+		f.ApplyValue(value, count)
+	}
+}
+
+// percentile returns the nth percentile of the given values using linear interpolation
+// between the closest ranks. The values will be sorted in place.
+func percentile(values []float64, nth float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := nth / 100 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
+
+// stdDeviation returns the standard deviation from the sum, the sum of squares and the number of values
+func stdDeviation(sum, squares float64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	mean := sum / float64(count)
+	return math.Sqrt(math.Max(0, squares/float64(count)-mean*mean))
+}
+
 // ParseFilter parses a single line into a filter object.
 // It returns any error encountered.
 func ParseFilter(value []byte, table TableName, stack *[]*Filter, options ParseOptions) (err error) {
@@ -523,8 +708,10 @@ func ParseStats(value []byte, table TableName, stack *[]*Filter, options ParseOp
 		return
 	}
 	startWith := float64(0)
+	nth := float64(0)
 	var op StatsType
-	switch string(bytes.ToLower(tmp[0])) {
+	statsOp := string(bytes.ToLower(tmp[0]))
+	switch statsOp {
 	case "avg":
 		op = Average
 	case "min":
@@ -534,7 +721,23 @@ func ParseStats(value []byte, table TableName, stack *[]*Filter, options ParseOp
 		op = Max
 	case "sum":
 		op = Sum
+	case "median":
+		op = Median
+		nth = 50
+	case "stddev":
+		op = StdDev
+	case "count_distinct":
+		op = CountDistinct
 	default:
+		if strings.HasPrefix(statsOp, "percentile") {
+			nth, err = strconv.ParseFloat(strings.TrimPrefix(statsOp, "percentile"), 64)
+			if err != nil || math.IsNaN(nth) || math.IsInf(nth, 0) || nth < 0 || nth > 100 {
+				err = fmt.Errorf("bad percentile %s, must be a number between 0 and 100, ex.: percentile95", tmp[0])
+				return
+			}
+			op = Percentile
+			break
+		}
 		err = ParseFilter(value, table, stack, options)
 		if err != nil {
 			return
@@ -551,10 +754,11 @@ func ParseStats(value []byte, table TableName, stack *[]*Filter, options ParseOp
 		col = t.GetColumnWithFallback(columnName)
 	}
 	stats := &Filter{
-		Column:     col,
-		StatsType:  op,
-		Stats:      startWith,
-		StatsCount: 0,
+		Column:          col,
+		StatsType:       op,
+		Stats:           startWith,
+		StatsCount:      0,
+		StatsPercentile: nth,
 	}
 	*stack = append(*stack, stats)
 	return
@@ -599,6 +803,32 @@ func ParseFilterNegate(stack []*Filter) (err error) {
 	return
 }
 
+// shiftTimestampFilter adds the offset to all filter values on timestamp columns.
+// Empty timestamps (0) are never shifted.
+func shiftTimestampFilter(stack []*Filter, offset int64) {
+	for _, f := range stack {
+		if len(f.Filter) > 0 {
+			shiftTimestampFilter(f.Filter, offset)
+			continue
+		}
+		if f.Column == nil || f.IsEmpty || !f.Column.IsTimestamp() {
+			continue
+		}
+		if f.StatsType != NoStats && f.StatsType != Counter {
+			continue
+		}
+		if f.FloatValue <= 0 {
+			continue
+		}
+		f.FloatValue += float64(offset)
+		if f.Column.DataType == FloatCol {
+			f.StrValue = strconv.FormatFloat(f.FloatValue, 'f', -1, 64)
+		} else {
+			f.StrValue = strconv.FormatInt(int64(f.FloatValue), 10)
+		}
+	}
+}
+
 // Match returns true if the given filter matches the given value.
 func (f *Filter) Match(row *DataRow) bool {
 	switch f.Column.DataType {
@@ -102,3 +102,10 @@ func TestRegexpDetection(t *testing.T) {
 		}
 	}
 }
+
+func TestStatsTypeString(t *testing.T) {
+	op := Percentile
+	if err := assertEq("percentile", op.String()); err != nil {
+		t.Error(err)
+	}
+}
@@ -46,6 +46,10 @@ func (c *HTTPServerController) queryTable(w http.ResponseWriter, requestData map
 		return
 	}
 
+	if req.OutputFormat == OutputFormatNDJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
 	// Fetch backend data
 	err = req.ExpandRequestedBackends()
 	if err != nil {
@@ -66,6 +70,15 @@ func (c *HTTPServerController) queryTable(w http.ResponseWriter, requestData map
 		return
 	}
 
+	// Stream JSON, errors cannot be sent anymore once the output has started
+	if res.Streaming {
+		_, err = res.SendUnbuffered(w)
+		if err != nil {
+			log.Debugf("streaming failed: %e", err)
+		}
+		return
+	}
+
 	// Send JSON
 	buf, err := res.Buffer()
 	if err != nil {
@@ -114,7 +127,7 @@ func (c *HTTPServerController) queryPing(w http.ResponseWriter, _ map[string]int
 	id := nodeAccessor.ID
 	j := make(map[string]interface{})
 	j["identifier"] = id
-	j["peers"] = nodeAccessor.assignedBackends
+	j["peers"] = nodeAccessor.AssignedBackends()
 	j["version"] = Version()
 
 	// Send data
@@ -151,6 +164,56 @@ func (c *HTTPServerController) query(w http.ResponseWriter, request *http.Reques
 	}
 }
 
+// changeBackend runs the change with the backendManager and sends the result
+func (c *HTTPServerController) changeBackend(w http.ResponseWriter, change func(*BackendManager) error) {
+	m, err := getBackendManager()
+	if err == nil {
+		err = change(m)
+	}
+	if err != nil {
+		c.errorOutput(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok"})
+	if err != nil {
+		log.Debugf("encoder failed: %e", err)
+	}
+}
+
+func (c *HTTPServerController) addBackend(w http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+	defer request.Body.Close()
+	con, err := parseConnectionJSON(request.Body)
+	if err != nil {
+		c.errorOutput(err, w)
+		return
+	}
+	c.changeBackend(w, func(m *BackendManager) error { return m.Add(con) })
+}
+
+func (c *HTTPServerController) updateBackend(w http.ResponseWriter, request *http.Request, ps httprouter.Params) {
+	defer request.Body.Close()
+	con, err := parseConnectionJSON(request.Body)
+	if err != nil {
+		c.errorOutput(err, w)
+		return
+	}
+	con.ID = ps.ByName("id")
+	c.changeBackend(w, func(m *BackendManager) error { return m.Update(con) })
+}
+
+func (c *HTTPServerController) removeBackend(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.changeBackend(w, func(m *BackendManager) error { return m.Remove(ps.ByName("id")) })
+}
+
+func (c *HTTPServerController) pauseBackend(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.changeBackend(w, func(m *BackendManager) error { return m.Pause(ps.ByName("id")) })
+}
+
+func (c *HTTPServerController) resumeBackend(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	c.changeBackend(w, func(m *BackendManager) error { return m.Resume(ps.ByName("id")) })
+}
+
 func parseRequestDataToRequest(requestData map[string]interface{}) (req *Request, err error) {
 	// New request object for specified table
 	req = &Request{}
@@ -166,6 +229,16 @@ func parseRequestDataToRequest(requestData map[string]interface{}) (req *Request
 		req.ColumnsHeaders = val.(bool)
 	}
 
+	// Explain
+	if val, ok := requestData["explain"]; ok {
+		req.Explain = val.(bool)
+	}
+
+	// ChangedSince
+	if val, ok := requestData["changedsince"]; ok {
+		req.ChangedSince = int64(val.(float64))
+	}
+
 	// Offset
 	req.Offset = interface2int(requestData["offset"])
 
@@ -279,6 +352,11 @@ func initializeHTTPRouter() (handler http.Handler) {
 	router.POST("/table/:name", controller.table)
 	router.POST("/ping", controller.ping)
 	router.POST("/query", controller.query)
+	router.POST("/backends", controller.addBackend)
+	router.PUT("/backends/:id", controller.updateBackend)
+	router.DELETE("/backends/:id", controller.removeBackend)
+	router.POST("/backends/:id/pause", controller.pauseBackend)
+	router.POST("/backends/:id/resume", controller.resumeBackend)
 
 	handler = router
 	return
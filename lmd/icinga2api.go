@@ -0,0 +1,998 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// Icinga2APIPrefix is used for sources connecting to the icinga2 rest api by https
+	Icinga2APIPrefix = "icinga2api://"
+
+	// Icinga2APIHTTPPrefix is used for sources connecting to the icinga2 rest api by plain http
+	Icinga2APIHTTPPrefix = "icinga2api+http://"
+
+	// Icinga2APIDefaultPort is used if the source does not contain a port
+	Icinga2APIDefaultPort = "5665"
+
+	// Icinga2APIEventBufferSize sets the maximum size of a single event from the event stream
+	Icinga2APIEventBufferSize = 10 * 1024 * 1024
+
+	// Icinga2APIEventIdleTimeout sets the time after which a silent event stream is considered broken.
+	// The stream contains all check results, so it is never silent for long on working connections.
+	Icinga2APIEventIdleTimeout = 5 * time.Minute
+)
+
+// icinga2APIEventTypes contains the event types which trigger delta updates
+var icinga2APIEventTypes = []string{
+	"CheckResult",
+	"StateChange",
+	"Flapping",
+	"AcknowledgementSet",
+	"AcknowledgementCleared",
+	"CommentAdded",
+	"CommentRemoved",
+	"DowntimeAdded",
+	"DowntimeRemoved",
+	"DowntimeStarted",
+	"DowntimeTriggered",
+}
+
+// reIcinga2APIFilter matches equal filters only, the operator must be followed by a space or the end of the line
+var reIcinga2APIFilter = regexp.MustCompile(`^Filter:\s*(\S+)\s+=(?:\s+(.*))?$`)
+var reIcinga2APICommand = regexp.MustCompile(`^COMMAND\s+\[(\d+)\]\s+([A-Z_]+);?(.*)$`)
+
+// icinga2APIAddr converts icinga2api:// sources into http(s) urls.
+// It returns the url and true if the source is an icinga2 api source.
+func icinga2APIAddr(rawAddr string) (string, bool) {
+	var addr string
+	switch {
+	case strings.HasPrefix(rawAddr, Icinga2APIHTTPPrefix):
+		addr = "http://" + strings.TrimPrefix(rawAddr, Icinga2APIHTTPPrefix)
+	case strings.HasPrefix(rawAddr, Icinga2APIPrefix):
+		addr = "https://" + strings.TrimPrefix(rawAddr, Icinga2APIPrefix)
+	default:
+		return rawAddr, false
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	if uri, err := url.Parse(addr); err == nil && uri.Port() == "" {
+		uri.Host += ":" + Icinga2APIDefaultPort
+		addr = uri.String()
+	}
+	return addr, true
+}
+
+// isIcinga2API returns true if the current source of this peer uses the icinga2 rest api
+func (p *Peer) isIcinga2API() bool {
+	_, connType := extractConnType(p.StatusGet(PeerAddr).(string))
+	return connType == ConnTypeIcinga2API
+}
+
+// icinga2APIRequest sends a request to the icinga2 rest api and returns the response body.
+func (p *Peer) icinga2APIRequest(ctx context.Context, peerAddr string, method string, uri string, body interface{}) ([]byte, error) {
+	var postData []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("json error: %s", err.Error())
+		}
+		postData = data
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", peerAddr+uri, bytes.NewReader(postData))
+	if err != nil {
+		return nil, &PeerError{msg: err.Error(), kind: ConnectionError}
+	}
+	if method != "POST" {
+		req.Header.Set("X-HTTP-Method-Override", method)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if req.URL.User == nil && strings.Contains(p.Config.Auth, ":") {
+		auth := strings.SplitN(p.Config.Auth, ":", 2)
+		req.SetBasicAuth(auth[0], auth[1])
+	}
+	response, err := p.cache.HTTPClient.Do(req)
+	if err != nil {
+		return nil, &PeerError{msg: err.Error(), kind: ConnectionError}
+	}
+	defer response.Body.Close()
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &PeerError{msg: err.Error(), kind: ConnectionError}
+	}
+
+	p.Lock.Lock()
+	p.Status[Queries] = p.Status[Queries].(int64) + 1
+	p.Status[BytesSend] = p.Status[BytesSend].(int64) + int64(len(postData))
+	p.Status[BytesReceived] = p.Status[BytesReceived].(int64) + int64(len(contents))
+	totalBytesSend := p.Status[BytesSend].(int64)
+	totalBytesReceived := p.Status[BytesReceived].(int64)
+	p.Lock.Unlock()
+	promPeerQueries.WithLabelValues(p.Name).Inc()
+	promPeerBytesSend.WithLabelValues(p.Name).Set(float64(totalBytesSend))
+	promPeerBytesReceived.WithLabelValues(p.Name).Set(float64(totalBytesReceived))
+
+	if response.StatusCode != http.StatusOK {
+		var result struct {
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(contents, &result) != nil || result.Status == "" {
+			result.Status = response.Status
+		}
+		return nil, &PeerCommandError{err: fmt.Errorf("icinga2 api returned %d: %s", response.StatusCode, result.Status), code: response.StatusCode, peer: p}
+	}
+	return contents, nil
+}
+
+// icinga2APIQuery contains the objects fetched for a single livestatus query.
+// Related objects like services for the num_services columns are fetched once on demand.
+type icinga2APIQuery struct {
+	ctx        context.Context
+	peer       *Peer
+	addr       string
+	hostNames  []interface{} // restricts related services and notifications to these hosts, nil for all
+	related    map[string][]icinga2APIObject
+	contactIdx map[string][2][]interface{}
+	serviceIdx map[string][]icinga2APIObject
+	groupIdx   map[string]map[string][]icinga2APIObject
+	countCache map[string]map[string]float64
+	app        icinga2APIObject
+	err        error
+}
+
+// fetch returns all objects of the given type matching the filter
+func (q *icinga2APIQuery) fetch(objType string, filter string, filterVars map[string]interface{}) ([]icinga2APIObject, error) {
+	body := map[string]interface{}{}
+	if filter != "" {
+		body["filter"] = filter
+		body["filter_vars"] = filterVars
+	}
+	data, err := q.peer.icinga2APIRequest(q.ctx, q.addr, "GET", "/v1/objects/"+objType, body)
+	if err != nil {
+		if cErr, ok := err.(*PeerCommandError); ok && cErr.code == http.StatusNotFound && filter != "" {
+			// filters without any match result in a 404
+			return []icinga2APIObject{}, nil
+		}
+		return nil, err
+	}
+	var result struct {
+		Results []struct {
+			Attrs icinga2APIObject `json:"attrs"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, &PeerError{msg: fmt.Sprintf("failed to parse icinga2 api result: %s", err.Error()), kind: ResponseError, resBytes: data}
+	}
+	objects := make([]icinga2APIObject, len(result.Results))
+	for i := range result.Results {
+		objects[i] = result.Results[i].Attrs
+	}
+	return objects, nil
+}
+
+// objects returns the related objects of the given type, errors are stored in the query
+func (q *icinga2APIQuery) objects(objType string) []icinga2APIObject {
+	if objects, ok := q.related[objType]; ok {
+		return objects
+	}
+	filter := ""
+	var filterVars map[string]interface{}
+	if q.hostNames != nil && (objType == "services" || objType == "notifications") {
+		filter = "host.name in lmd_hosts"
+		filterVars = map[string]interface{}{"lmd_hosts": q.hostNames}
+	}
+	objects, err := q.fetch(objType, filter, filterVars)
+	if err != nil {
+		q.err = err
+		objects = []icinga2APIObject{}
+	}
+	q.related[objType] = objects
+	return objects
+}
+
+// application returns the status of the icinga application
+func (q *icinga2APIQuery) application() icinga2APIObject {
+	if q.app != nil {
+		return q.app
+	}
+	data, err := q.peer.icinga2APIRequest(q.ctx, q.addr, "GET", "/v1/status/IcingaApplication", nil)
+	if err != nil {
+		q.err = err
+		return nil
+	}
+	var result struct {
+		Results []struct {
+			Status struct {
+				Application struct {
+					App icinga2APIObject `json:"app"`
+				} `json:"icingaapplication"`
+			} `json:"status"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || len(result.Results) == 0 {
+		q.err = &PeerError{msg: "failed to parse icinga2 api status", kind: ResponseError, resBytes: data}
+		return nil
+	}
+	q.app = result.Results[0].Status.Application.App
+	return q.app
+}
+
+// hostServices returns all services of the given host
+func (q *icinga2APIQuery) hostServices(hostName string) []icinga2APIObject {
+	if q.serviceIdx == nil {
+		q.serviceIdx = make(map[string][]icinga2APIObject)
+		for _, svc := range q.objects("services") {
+			q.serviceIdx[svc.str("host_name")] = append(q.serviceIdx[svc.str("host_name")], svc)
+		}
+	}
+	return q.serviceIdx[hostName]
+}
+
+// groupMembers returns all objects of the given type which are member of the group
+func (q *icinga2APIQuery) groupMembers(objType string, group string) []icinga2APIObject {
+	if q.groupIdx == nil {
+		q.groupIdx = make(map[string]map[string][]icinga2APIObject)
+	}
+	idx, ok := q.groupIdx[objType]
+	if !ok {
+		idx = make(map[string][]icinga2APIObject)
+		for _, obj := range q.objects(objType) {
+			for _, g := range obj.list("groups") {
+				name := *interface2string(g)
+				idx[name] = append(idx[name], obj)
+			}
+		}
+		q.groupIdx[objType] = idx
+	}
+	return idx[group]
+}
+
+// counts returns the cached state summary for the given key
+func (q *icinga2APIQuery) counts(key string, fn func() map[string]float64) map[string]float64 {
+	if q.countCache == nil {
+		q.countCache = make(map[string]map[string]float64)
+	}
+	counts, ok := q.countCache[key]
+	if !ok {
+		counts = fn()
+		q.countCache[key] = counts
+	}
+	return counts
+}
+
+// contacts returns the contacts and contact groups of a host or service.
+// Icinga2 assigns users by notification objects, members of user groups are contacts as well.
+func (q *icinga2APIQuery) contacts(obj icinga2APIObject) (contacts []interface{}, groups []interface{}) {
+	if q.contactIdx == nil {
+		usersByGroup := make(map[string][]string)
+		for _, user := range q.objects("users") {
+			for _, g := range user.list("groups") {
+				name := *interface2string(g)
+				usersByGroup[name] = append(usersByGroup[name], user.str("name"))
+			}
+		}
+		contactSets := make(map[string]map[string]bool)
+		groupSets := make(map[string]map[string]bool)
+		for _, n := range q.objects("notifications") {
+			key := n.str("host_name") + ";" + n.str("service_name")
+			if contactSets[key] == nil {
+				contactSets[key] = make(map[string]bool)
+				groupSets[key] = make(map[string]bool)
+			}
+			for _, u := range n.list("users") {
+				contactSets[key][*interface2string(u)] = true
+			}
+			for _, g := range n.list("user_groups") {
+				name := *interface2string(g)
+				groupSets[key][name] = true
+				for _, u := range usersByGroup[name] {
+					contactSets[key][u] = true
+				}
+			}
+		}
+		q.contactIdx = make(map[string][2][]interface{})
+		for key := range contactSets {
+			q.contactIdx[key] = [2][]interface{}{icinga2SortedList(contactSets[key]), icinga2SortedList(groupSets[key])}
+		}
+	}
+	key := obj.str("host_name") + ";" + obj.str("name")
+	if obj.str("host_name") == "" {
+		// hosts do not have a host_name attribute
+		key = obj.str("name") + ";"
+	}
+	if c, ok := q.contactIdx[key]; ok {
+		return c[0], c[1]
+	}
+	return []interface{}{}, []interface{}{}
+}
+
+func icinga2SortedList(set map[string]bool) []interface{} {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	list := make([]interface{}, len(keys))
+	for i, k := range keys {
+		list[i] = k
+	}
+	return list
+}
+
+// icinga2APIFilter converts simple equal filters on primary keys into an icinga2 filter expression.
+// It returns false if the filter cannot be converted, all objects are fetched in that case.
+func icinga2APIFilter(table *icinga2APITable, filterStr string) (filter string, filterVars map[string]interface{}, ok bool) {
+	filterStr = strings.TrimSpace(filterStr)
+	if filterStr == "" {
+		return "", nil, true
+	}
+	expressions := []string{}
+	filterVars = make(map[string]interface{})
+	for i, line := range strings.Split(filterStr, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		matches := reIcinga2APIFilter.FindStringSubmatch(line)
+		if len(matches) < 3 {
+			return "", nil, false
+		}
+		attr, ok := table.filter[matches[1]]
+		if !ok {
+			return "", nil, false
+		}
+		name := fmt.Sprintf("lmd_filter%d", i)
+		expressions = append(expressions, fmt.Sprintf("%s==%s", attr, name))
+		if strings.HasSuffix(attr, "legacy_id") {
+			id, err := strconv.ParseFloat(matches[2], 64)
+			if err != nil {
+				return "", nil, false
+			}
+			filterVars[name] = id
+		} else {
+			filterVars[name] = matches[2]
+		}
+	}
+	return strings.Join(expressions, " && "), filterVars, true
+}
+
+// queryIcinga2API answers livestatus requests by fetching the objects from the icinga2 rest api.
+// Commands are translated into icinga2 actions.
+func (p *Peer) queryIcinga2API(req *Request, peerAddr string) (ResultSet, *ResultMetaData, error) {
+	addr, _ := icinga2APIAddr(peerAddr)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.GlobalConfig.NetTimeout)*time.Second)
+	defer cancel()
+
+	if req.Command != "" {
+		return nil, nil, p.sendIcinga2APICommands(ctx, addr, req.Command)
+	}
+
+	if len(req.Stats) > 0 || strings.Contains(req.FilterStr, "Stats:") {
+		return nil, nil, &PeerError{msg: "stats queries are not supported by icinga2 api connections", kind: ResponseError, req: req}
+	}
+
+	filterStr := req.FilterStr
+	for i := range req.Filter {
+		filterStr += req.Filter[i].String("")
+	}
+	filter, filterVars, ok := "", map[string]interface{}(nil), false
+	if table, exists := icinga2APITables[req.Table]; exists {
+		filter, filterVars, ok = icinga2APIFilter(table, filterStr)
+		if !ok {
+			logWith(p, req).Debugf("filter cannot be used with the icinga2 api, fetching all objects")
+			filter = ""
+		}
+	}
+	return p.fetchIcinga2APIResult(ctx, req, addr, filter, filterVars, nil)
+}
+
+// fetchIcinga2APIResult fetches the objects for the requested table and converts them into a livestatus result.
+// hostNames restricts related objects, like services for host summaries, to the given hosts.
+func (p *Peer) fetchIcinga2APIResult(ctx context.Context, req *Request, addr string, filter string, filterVars map[string]interface{}, hostNames []interface{}) (ResultSet, *ResultMetaData, error) {
+	t1 := time.Now()
+	p.Lock.Lock()
+	if p.GlobalConfig.SaveTempRequests {
+		p.last.Request = req
+		p.last.Response = nil
+	}
+	p.Lock.Unlock()
+
+	res := make(ResultSet, 0)
+	meta := &ResultMetaData{Request: req}
+	table, ok := icinga2APITables[req.Table]
+	if !ok {
+		// tables without icinga2 equivalent, ex.: the log table, are empty
+		logWith(p, req).Tracef("table %s is not supported by the icinga2 api", req.Table.String())
+		return res, meta, nil
+	}
+
+	q := &icinga2APIQuery{
+		ctx:       ctx,
+		peer:      p,
+		addr:      addr,
+		hostNames: hostNames,
+		related:   make(map[string][]icinga2APIObject),
+	}
+	var objects []icinga2APIObject
+	if table.status != nil {
+		if obj := table.status(q); obj != nil {
+			objects = append(objects, obj)
+		}
+	} else {
+		for _, objType := range table.types {
+			list, err := q.fetch(objType, filter, filterVars)
+			if err != nil {
+				return nil, nil, err
+			}
+			objects = append(objects, list...)
+		}
+		sort.SliceStable(objects, func(i, j int) bool { return table.less(objects[i], objects[j]) })
+		// related objects can be restricted to the fetched hosts if only some hosts were requested
+		if req.Table == TableHosts && filter != "" && q.hostNames == nil {
+			q.hostNames = make([]interface{}, len(objects))
+			for i := range objects {
+				q.hostNames[i] = objects[i].str("name")
+			}
+		}
+	}
+	if q.err != nil {
+		return nil, nil, q.err
+	}
+
+	columns := req.Columns
+	tableDef := Objects.Tables[req.Table]
+	if len(columns) == 0 && tableDef != nil {
+		for _, col := range tableDef.Columns {
+			if col.StorageType == LocalStore {
+				columns = append(columns, col.Name)
+			}
+		}
+	}
+	for _, obj := range objects {
+		row := make([]interface{}, len(columns))
+		for i, name := range columns {
+			if fn, ok := table.columns[name]; ok {
+				row[i] = fn(q, obj)
+			}
+			if row[i] == nil && tableDef != nil {
+				row[i] = icinga2DefaultValue(tableDef.ColumnsIndex[name])
+			}
+		}
+		res = append(res, row)
+	}
+	if q.err != nil {
+		return nil, nil, q.err
+	}
+
+	meta.Total = int64(len(res))
+	meta.Duration = time.Since(t1)
+	logWith(p, req).Tracef("fetched table: %15s - time: %8s - count: %8d", req.Table.String(), meta.Duration, len(res))
+	return res, meta, nil
+}
+
+// icinga2APIAction is a single action or object modification for the icinga2 rest api
+type icinga2APIAction struct {
+	uri  string
+	body map[string]interface{}
+}
+
+// icinga2APIModifyCommands maps livestatus commands to icinga2 object attributes
+var icinga2APIModifyCommands = map[string]struct {
+	objType string
+	attr    string
+	value   bool
+}{
+	"ENABLE_HOST_CHECK":           {"hosts", "enable_active_checks", true},
+	"DISABLE_HOST_CHECK":          {"hosts", "enable_active_checks", false},
+	"ENABLE_PASSIVE_HOST_CHECKS":  {"hosts", "enable_passive_checks", true},
+	"DISABLE_PASSIVE_HOST_CHECKS": {"hosts", "enable_passive_checks", false},
+	"ENABLE_HOST_NOTIFICATIONS":   {"hosts", "enable_notifications", true},
+	"DISABLE_HOST_NOTIFICATIONS":  {"hosts", "enable_notifications", false},
+	"ENABLE_HOST_EVENT_HANDLER":   {"hosts", "enable_event_handler", true},
+	"DISABLE_HOST_EVENT_HANDLER":  {"hosts", "enable_event_handler", false},
+	"ENABLE_HOST_FLAP_DETECTION":  {"hosts", "enable_flapping", true},
+	"DISABLE_HOST_FLAP_DETECTION": {"hosts", "enable_flapping", false},
+	"ENABLE_SVC_CHECK":            {"services", "enable_active_checks", true},
+	"DISABLE_SVC_CHECK":           {"services", "enable_active_checks", false},
+	"ENABLE_PASSIVE_SVC_CHECKS":   {"services", "enable_passive_checks", true},
+	"DISABLE_PASSIVE_SVC_CHECKS":  {"services", "enable_passive_checks", false},
+	"ENABLE_SVC_NOTIFICATIONS":    {"services", "enable_notifications", true},
+	"DISABLE_SVC_NOTIFICATIONS":   {"services", "enable_notifications", false},
+	"ENABLE_SVC_EVENT_HANDLER":    {"services", "enable_event_handler", true},
+	"DISABLE_SVC_EVENT_HANDLER":   {"services", "enable_event_handler", false},
+	"ENABLE_SVC_FLAP_DETECTION":   {"services", "enable_flapping", true},
+	"DISABLE_SVC_FLAP_DETECTION":  {"services", "enable_flapping", false},
+	"ENABLE_NOTIFICATIONS":        {"icingaapplications", "enable_notifications", true},
+	"DISABLE_NOTIFICATIONS":       {"icingaapplications", "enable_notifications", false},
+	"ENABLE_EVENT_HANDLERS":       {"icingaapplications", "enable_event_handlers", true},
+	"DISABLE_EVENT_HANDLERS":      {"icingaapplications", "enable_event_handlers", false},
+	"ENABLE_FLAP_DETECTION":       {"icingaapplications", "enable_flapping", true},
+	"DISABLE_FLAP_DETECTION":      {"icingaapplications", "enable_flapping", false},
+	"ENABLE_PERFORMANCE_DATA":     {"icingaapplications", "enable_perfdata", true},
+	"DISABLE_PERFORMANCE_DATA":    {"icingaapplications", "enable_perfdata", false},
+	"START_EXECUTING_HOST_CHECKS": {"icingaapplications", "enable_host_checks", true},
+	"STOP_EXECUTING_HOST_CHECKS":  {"icingaapplications", "enable_host_checks", false},
+	"START_EXECUTING_SVC_CHECKS":  {"icingaapplications", "enable_service_checks", true},
+	"STOP_EXECUTING_SVC_CHECKS":   {"icingaapplications", "enable_service_checks", false},
+}
+
+// icinga2APITarget adds the type and filter for a host or service to the action body.
+// It returns the number of consumed arguments.
+func icinga2APITarget(body map[string]interface{}, isService bool, args []string) (int, error) {
+	if isService {
+		if len(args) < 2 {
+			return 0, fmt.Errorf("missing host and service name")
+		}
+		body["type"] = "Service"
+		body["filter"] = "host.name==lmd_host && service.name==lmd_service"
+		body["filter_vars"] = map[string]interface{}{"lmd_host": args[0], "lmd_service": args[1]}
+		return 2, nil
+	}
+	if len(args) < 1 {
+		return 0, fmt.Errorf("missing host name")
+	}
+	body["type"] = "Host"
+	body["filter"] = "host.name==lmd_host"
+	body["filter_vars"] = map[string]interface{}{"lmd_host": args[0]}
+	return 1, nil
+}
+
+// parseIcinga2APICommand translates a single livestatus external command into an icinga2 api action
+func parseIcinga2APICommand(command string) (*icinga2APIAction, error) {
+	matches := reIcinga2APICommand.FindStringSubmatch(strings.TrimSpace(command))
+	if len(matches) < 4 {
+		return nil, fmt.Errorf("cannot parse command: %s", command)
+	}
+	name := matches[2]
+	args := []string{}
+	if matches[3] != "" {
+		args = strings.Split(matches[3], ";")
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	argNum := func(i int) float64 {
+		num, _ := strconv.ParseFloat(arg(i), 64)
+		return num
+	}
+
+	if modify, ok := icinga2APIModifyCommands[name]; ok {
+		target := "app"
+		switch modify.objType {
+		case "hosts":
+			target = arg(0)
+		case "services":
+			target = arg(0) + "!" + arg(1)
+		}
+		if target == "" || target == "!" {
+			return nil, fmt.Errorf("missing object name for %s", name)
+		}
+		return &icinga2APIAction{
+			uri:  "/v1/objects/" + modify.objType + "/" + url.PathEscape(target),
+			body: map[string]interface{}{"attrs": map[string]interface{}{modify.attr: modify.value}},
+		}, nil
+	}
+
+	isService := strings.Contains(name, "_SVC_") || strings.Contains(name, "_SERVICE_")
+	body := map[string]interface{}{}
+	action := &icinga2APIAction{body: body}
+	switch name {
+	case "ACKNOWLEDGE_HOST_PROBLEM", "ACKNOWLEDGE_SVC_PROBLEM":
+		n, err := icinga2APITarget(body, isService, args)
+		if err != nil {
+			return nil, err
+		}
+		action.uri = "/v1/actions/acknowledge-problem"
+		body["sticky"] = arg(n) == "2"
+		body["notify"] = arg(n+1) == "1"
+		body["persistent"] = arg(n+2) == "1"
+		body["author"] = arg(n + 3)
+		body["comment"] = arg(n + 4)
+	case "REMOVE_HOST_ACKNOWLEDGEMENT", "REMOVE_SVC_ACKNOWLEDGEMENT":
+		if _, err := icinga2APITarget(body, isService, args); err != nil {
+			return nil, err
+		}
+		action.uri = "/v1/actions/remove-acknowledgement"
+	case "ADD_HOST_COMMENT", "ADD_SVC_COMMENT":
+		n, err := icinga2APITarget(body, isService, args)
+		if err != nil {
+			return nil, err
+		}
+		action.uri = "/v1/actions/add-comment"
+		body["author"] = arg(n + 1)
+		body["comment"] = arg(n + 2)
+	case "DEL_HOST_COMMENT", "DEL_SVC_COMMENT":
+		action.uri = "/v1/actions/remove-comment"
+		body["type"] = "Comment"
+		body["filter"] = "comment.legacy_id==lmd_id"
+		body["filter_vars"] = map[string]interface{}{"lmd_id": argNum(0)}
+	case "SCHEDULE_HOST_DOWNTIME", "SCHEDULE_SVC_DOWNTIME":
+		n, err := icinga2APITarget(body, isService, args)
+		if err != nil {
+			return nil, err
+		}
+		action.uri = "/v1/actions/schedule-downtime"
+		body["start_time"] = argNum(n)
+		body["end_time"] = argNum(n + 1)
+		body["fixed"] = arg(n+2) == "1"
+		body["duration"] = argNum(n + 4)
+		body["author"] = arg(n + 5)
+		body["comment"] = arg(n + 6)
+	case "DEL_HOST_DOWNTIME", "DEL_SVC_DOWNTIME":
+		action.uri = "/v1/actions/remove-downtime"
+		body["type"] = "Downtime"
+		body["filter"] = "downtime.legacy_id==lmd_id"
+		body["filter_vars"] = map[string]interface{}{"lmd_id": argNum(0)}
+	case "SCHEDULE_HOST_CHECK", "SCHEDULE_FORCED_HOST_CHECK", "SCHEDULE_SVC_CHECK", "SCHEDULE_FORCED_SVC_CHECK":
+		n, err := icinga2APITarget(body, isService, args)
+		if err != nil {
+			return nil, err
+		}
+		action.uri = "/v1/actions/reschedule-check"
+		body["next_check"] = argNum(n)
+		body["force"] = strings.Contains(name, "_FORCED_")
+	case "PROCESS_HOST_CHECK_RESULT", "PROCESS_SERVICE_CHECK_RESULT":
+		n, err := icinga2APITarget(body, isService, args)
+		if err != nil {
+			return nil, err
+		}
+		action.uri = "/v1/actions/process-check-result"
+		body["exit_status"] = argNum(n)
+		output := ""
+		if len(args) > n+1 {
+			output = strings.Join(args[n+1:], ";")
+		}
+		if i := strings.Index(output, "|"); i >= 0 {
+			body["performance_data"] = strings.Fields(output[i+1:])
+			output = output[:i]
+		}
+		body["plugin_output"] = output
+	case "SEND_CUSTOM_HOST_NOTIFICATION", "SEND_CUSTOM_SVC_NOTIFICATION":
+		n, err := icinga2APITarget(body, isService, args)
+		if err != nil {
+			return nil, err
+		}
+		action.uri = "/v1/actions/send-custom-notification"
+		body["force"] = int(argNum(n))&2 != 0
+		body["author"] = arg(n + 1)
+		body["comment"] = arg(n + 2)
+	default:
+		return nil, fmt.Errorf("command %s is not supported by icinga2 api connections", name)
+	}
+	return action, nil
+}
+
+// sendIcinga2APICommands translates livestatus commands into icinga2 api actions and sends them
+func (p *Peer) sendIcinga2APICommands(ctx context.Context, addr string, commands string) error {
+	for _, command := range strings.Split(commands, "\n") {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		action, err := parseIcinga2APICommand(command)
+		if err != nil {
+			return &PeerCommandError{err: err, code: http.StatusBadRequest, peer: p}
+		}
+		logWith(p).Debugf("sending command to icinga2 api: %s", action.uri)
+		data, err := p.icinga2APIRequest(ctx, addr, "POST", action.uri, action.body)
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Results []struct {
+				Code   float64 `json:"code"`
+				Status string  `json:"status"`
+			} `json:"results"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return &PeerError{msg: fmt.Sprintf("failed to parse icinga2 api result: %s", err.Error()), kind: ResponseError, resBytes: data}
+		}
+		for _, r := range result.Results {
+			if r.Code >= 300 {
+				return &PeerCommandError{err: fmt.Errorf("%s", r.Status), code: int(r.Code), peer: p}
+			}
+		}
+	}
+	return nil
+}
+
+// Icinga2APIEvents collects the objects changed according to the icinga2 event stream.
+// The collected changes are fetched by the next delta update.
+type Icinga2APIEvents struct {
+	noCopy      noCopy
+	lock        *deadlock.Mutex
+	cancel      context.CancelFunc
+	running     bool
+	resync      bool          // events may have been missed, a full update is required
+	idleTimeout time.Duration // reconnect if no event has been received within this time
+	hosts       map[string]bool
+	services    map[string]bool // services by their icinga2 name: host!service
+	comments    bool
+	downtimes   bool
+}
+
+// icinga2APIEvent contains the attributes of a single event used to find the changed objects
+type icinga2APIEvent struct {
+	Type     string           `json:"type"`
+	Host     string           `json:"host"`
+	Service  string           `json:"service"`
+	Comment  icinga2APIObject `json:"comment"`
+	Downtime icinga2APIObject `json:"downtime"`
+}
+
+// NewIcinga2APIEvents creates a new, not yet started event collector
+func NewIcinga2APIEvents() *Icinga2APIEvents {
+	return &Icinga2APIEvents{
+		lock:        new(deadlock.Mutex),
+		resync:      true,
+		idleTimeout: Icinga2APIEventIdleTimeout,
+		hosts:       make(map[string]bool),
+		services:    make(map[string]bool),
+	}
+}
+
+// start connects to the event stream unless it is running already
+func (e *Icinga2APIEvents) start(p *Peer, addr string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.running {
+		return nil
+	}
+	tlsConfig, err := p.getTLSClientConfig()
+	if err != nil {
+		return err
+	}
+	client := NewLMDHTTPClient(tlsConfig, p.Config.Proxy)
+	client.Timeout = 0 // the stream stays open
+	body, err := json.Marshal(map[string]interface{}{
+		"queue": "lmd-" + p.ID,
+		"types": icinga2APIEventTypes,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "POST", addr+"/v1/events", bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if req.URL.User == nil && strings.Contains(p.Config.Auth, ":") {
+		auth := strings.SplitN(p.Config.Auth, ":", 2)
+		req.SetBasicAuth(auth[0], auth[1])
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return &PeerError{msg: err.Error(), kind: ConnectionError}
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		cancel()
+		return &PeerError{msg: fmt.Sprintf("icinga2 event stream returned: %s", response.Status), kind: ConnectionError}
+	}
+	e.cancel = cancel
+	e.running = true
+	idleTimeout := e.idleTimeout
+	logWith(p).Debugf("connected to icinga2 event stream")
+
+	go func() {
+		// make sure we log panics properly
+		defer logPanicExitPeer(p)
+
+		defer response.Body.Close()
+		// the client has no timeout, so half dead connections must be detected by missing events
+		idle := time.AfterFunc(idleTimeout, func() {
+			logWith(p).Debugf("no icinga2 events received within %s, reconnecting", idleTimeout.String())
+			cancel()
+		})
+		defer idle.Stop()
+		scanner := bufio.NewScanner(response.Body)
+		scanner.Buffer(make([]byte, 64*1024), Icinga2APIEventBufferSize)
+		for scanner.Scan() {
+			idle.Reset(idleTimeout)
+			event := icinga2APIEvent{}
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				logWith(p).Debugf("cannot parse icinga2 event: %s", err.Error())
+				continue
+			}
+			e.record(&event)
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			logWith(p).Debugf("icinga2 event stream closed: %s", err.Error())
+		}
+		e.lock.Lock()
+		e.running = false
+		e.resync = true
+		e.lock.Unlock()
+	}()
+	return nil
+}
+
+// stop closes the event stream
+func (e *Icinga2APIEvents) stop() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+}
+
+// record remembers the objects changed by this event
+func (e *Icinga2APIEvents) record(event *icinga2APIEvent) {
+	host, service := event.Host, event.Service
+	switch {
+	case event.Comment != nil:
+		host, service = event.Comment.str("host_name"), event.Comment.str("service_name")
+	case event.Downtime != nil:
+		host, service = event.Downtime.str("host_name"), event.Downtime.str("service_name")
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	switch {
+	case strings.HasPrefix(event.Type, "Comment"):
+		e.comments = true
+	case strings.HasPrefix(event.Type, "Downtime"):
+		e.downtimes = true
+	}
+	if host == "" {
+		return
+	}
+	// the service summary columns of the host change as well
+	e.hosts[host] = true
+	if service != "" {
+		e.services[host+"!"+service] = true
+	}
+}
+
+// drain returns and resets the collected changes
+func (e *Icinga2APIEvents) drain() (resync bool, hosts []interface{}, services []interface{}, comments bool, downtimes bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for name := range e.hosts {
+		hosts = append(hosts, name)
+	}
+	for name := range e.services {
+		services = append(services, name)
+	}
+	resync, comments, downtimes = e.resync, e.comments, e.downtimes
+	e.hosts = make(map[string]bool)
+	e.services = make(map[string]bool)
+	e.resync, e.comments, e.downtimes = false, false, false
+	return
+}
+
+// requireResync makes the next update a full update, ex.: if the drained changes could not be fetched
+func (e *Icinga2APIEvents) requireResync() {
+	e.lock.Lock()
+	e.resync = true
+	e.lock.Unlock()
+}
+
+// stopIcinga2APIEvents closes the event stream if there is one
+func (p *Peer) stopIcinga2APIEvents() {
+	p.Lock.RLock()
+	events := p.icinga2Events
+	p.Lock.RUnlock()
+	if events != nil {
+		events.stop()
+	}
+}
+
+// updateDeltaIcinga2API updates all hosts, services, comments and downtimes changed according to the event stream.
+// A full update is done if the event stream has just been (re)connected, because events might have been missed.
+func (ds *DataStoreSet) updateDeltaIcinga2API() (err error) {
+	p := ds.peer
+	addr, _ := icinga2APIAddr(p.StatusGet(PeerAddr).(string))
+	p.Lock.Lock()
+	if p.icinga2Events == nil {
+		p.icinga2Events = NewIcinga2APIEvents()
+	}
+	events := p.icinga2Events
+	p.Lock.Unlock()
+	err = events.start(p, addr)
+	if err != nil {
+		return
+	}
+
+	resync, hosts, services, comments, downtimes := events.drain()
+	defer func() {
+		// the drained changes would be lost otherwise
+		if err != nil {
+			events.requireResync()
+		}
+	}()
+	if resync {
+		logWith(p).Debugf("icinga2 event stream (re)connected, running full update")
+		err = ds.UpdateFullTablesList([]TableName{TableHosts, TableServices})
+		if err != nil {
+			return
+		}
+		hosts, services = nil, nil
+		comments, downtimes = true, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.GlobalConfig.NetTimeout)*time.Second)
+	defer cancel()
+	if len(hosts) > 0 {
+		err = ds.updateIcinga2APIObjects(ctx, addr, TableHosts, "host.name in lmd_names", hosts, hosts)
+		if err != nil {
+			return
+		}
+	}
+	if len(services) > 0 {
+		err = ds.updateIcinga2APIObjects(ctx, addr, TableServices, "service.__name in lmd_names", services, nil)
+		if err != nil {
+			return
+		}
+	}
+	if comments {
+		err = ds.replaceIcinga2APITable(TableComments)
+		if err != nil {
+			return
+		}
+	}
+	if downtimes {
+		err = ds.replaceIcinga2APITable(TableDowntimes)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// updateIcinga2APIObjects fetches the dynamic columns of the given objects and updates the store
+func (ds *DataStoreSet) updateIcinga2APIObjects(ctx context.Context, addr string, tableName TableName, filter string, names []interface{}, hostNames []interface{}) error {
+	store := ds.Get(tableName)
+	if store == nil {
+		return fmt.Errorf("peer not ready, either not initialized or went offline recently")
+	}
+	req := &Request{
+		Table:   tableName,
+		Columns: store.DynamicColumnNamesCache,
+	}
+	res, meta, err := ds.peer.fetchIcinga2APIResult(ctx, req, addr, filter, map[string]interface{}{"lmd_names": names}, hostNames)
+	if err != nil {
+		return err
+	}
+	return ds.insertDeltaDataResult(len(store.Table.PrimaryKey), res, meta, store)
+}
+
+// replaceIcinga2APITable fetches the whole table again and replaces the store
+func (ds *DataStoreSet) replaceIcinga2APITable(tableName TableName) (err error) {
+	store, err := ds.CreateObjectByType(Objects.Tables[tableName])
+	if err != nil {
+		return
+	}
+	err = store.SetReferences()
+	if err != nil {
+		return
+	}
+	ds.Set(tableName, store)
+	switch tableName {
+	case TableComments:
+		err = ds.RebuildCommentsList()
+	case TableDowntimes:
+		err = ds.RebuildDowntimesList()
+	}
+	return
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// icinga2APIObject contains the attributes of a single object from the icinga2 rest api
+type icinga2APIObject map[string]interface{}
+
+// str returns the attribute as string or an empty string
+func (o icinga2APIObject) str(key string) string {
+	if s, ok := o[key].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// num returns the attribute as number, booleans are converted to 0 or 1
+func (o icinga2APIObject) num(key string) float64 {
+	switch v := o[key].(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+// list returns the attribute as list of strings, command lines are returned as list as well
+func (o icinga2APIObject) list(key string) []interface{} {
+	switch v := o[key].(type) {
+	case []interface{}:
+		return v
+	case string:
+		if v != "" {
+			return []interface{}{v}
+		}
+	}
+	return []interface{}{}
+}
+
+// sub returns the nested object for the given attribute, ex.: last_check_result
+func (o icinga2APIObject) sub(key string) icinga2APIObject {
+	if m, ok := o[key].(map[string]interface{}); ok {
+		return icinga2APIObject(m)
+	}
+	return nil
+}
+
+// icinga2APIColumn returns the livestatus value for a single column
+type icinga2APIColumn func(q *icinga2APIQuery, obj icinga2APIObject) interface{}
+
+// icinga2APITable maps a livestatus table to icinga2 objects
+type icinga2APITable struct {
+	types   []string                                  // icinga2 object types, ex.: hosts
+	filter  map[string]string                         // maps primary key columns to the icinga2 filter attribute
+	less    func(a, b icinga2APIObject) bool          // sort order, must match the livestatus primary key order
+	columns map[string]icinga2APIColumn               // supported columns, all others are returned empty
+	status  func(q *icinga2APIQuery) icinga2APIObject // fetches a single object instead of the object types
+}
+
+// icinga2APITables contains all tables which can be filled from the icinga2 rest api
+var icinga2APITables = map[TableName]*icinga2APITable{
+	TableStatus: {
+		status: func(q *icinga2APIQuery) icinga2APIObject { return q.application() },
+		columns: map[string]icinga2APIColumn{
+			"program_start":                 icinga2Attr("program_start"),
+			"nagios_pid":                    icinga2Attr("pid"),
+			"program_version":               icinga2Attr("version"),
+			"livestatus_version":            func(_ *icinga2APIQuery, o icinga2APIObject) interface{} { return "icinga2api-" + o.str("version") },
+			"enable_notifications":          icinga2Attr("enable_notifications"),
+			"execute_host_checks":           icinga2Attr("enable_host_checks"),
+			"execute_service_checks":        icinga2Attr("enable_service_checks"),
+			"enable_event_handlers":         icinga2Attr("enable_event_handlers"),
+			"enable_flap_detection":         icinga2Attr("enable_flapping"),
+			"process_performance_data":      icinga2Attr("enable_perfdata"),
+			"accept_passive_host_checks":    icinga2Value(float64(1)),
+			"accept_passive_service_checks": icinga2Value(float64(1)),
+			"check_external_commands":       icinga2Value(float64(1)),
+			"interval_length":               icinga2Value(float64(60)),
+		},
+	},
+	TableHosts: {
+		types:   []string{"hosts"},
+		filter:  map[string]string{"name": "host.name"},
+		less:    icinga2LessByName,
+		columns: icinga2HostColumns(),
+	},
+	TableServices: {
+		types:  []string{"services"},
+		filter: map[string]string{"host_name": "host.name", "description": "service.name"},
+		less: func(a, b icinga2APIObject) bool {
+			if a.str("host_name") != b.str("host_name") {
+				return a.str("host_name") < b.str("host_name")
+			}
+			return a.str("name") < b.str("name")
+		},
+		columns: icinga2ServiceColumns(),
+	},
+	TableHostgroups: {
+		types:  []string{"hostgroups"},
+		filter: map[string]string{"name": "hostgroup.name"},
+		less:   icinga2LessByName,
+		columns: map[string]icinga2APIColumn{
+			"name":       icinga2Attr("name"),
+			"alias":      icinga2Attr("display_name"),
+			"notes":      icinga2Attr("notes"),
+			"notes_url":  icinga2Attr("notes_url"),
+			"action_url": icinga2Attr("action_url"),
+			"members": func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+				members := []interface{}{}
+				for _, host := range q.groupMembers("hosts", o.str("name")) {
+					members = append(members, host.str("name"))
+				}
+				return members
+			},
+			"num_hosts":                 icinga2HostgroupCount("num_hosts"),
+			"num_hosts_up":              icinga2HostgroupCount("num_hosts_up"),
+			"num_hosts_down":            icinga2HostgroupCount("num_hosts_down"),
+			"num_hosts_unreach":         icinga2HostgroupCount("num_hosts_unreach"),
+			"num_hosts_pending":         icinga2HostgroupCount("num_hosts_pending"),
+			"worst_host_state":          icinga2HostgroupCount("worst_host_state"),
+			"num_services":              icinga2HostgroupServiceCount("num_services"),
+			"num_services_ok":           icinga2HostgroupServiceCount("num_services_ok"),
+			"num_services_warn":         icinga2HostgroupServiceCount("num_services_warn"),
+			"num_services_crit":         icinga2HostgroupServiceCount("num_services_crit"),
+			"num_services_unknown":      icinga2HostgroupServiceCount("num_services_unknown"),
+			"num_services_pending":      icinga2HostgroupServiceCount("num_services_pending"),
+			"num_services_hard_ok":      icinga2HostgroupServiceCount("num_services_hard_ok"),
+			"num_services_hard_warn":    icinga2HostgroupServiceCount("num_services_hard_warn"),
+			"num_services_hard_crit":    icinga2HostgroupServiceCount("num_services_hard_crit"),
+			"num_services_hard_unknown": icinga2HostgroupServiceCount("num_services_hard_unknown"),
+			"worst_service_state":       icinga2HostgroupServiceCount("worst_service_state"),
+			"worst_service_hard_state":  icinga2HostgroupServiceCount("worst_service_hard_state"),
+		},
+	},
+	TableServicegroups: {
+		types:  []string{"servicegroups"},
+		filter: map[string]string{"name": "servicegroup.name"},
+		less:   icinga2LessByName,
+		columns: map[string]icinga2APIColumn{
+			"name":       icinga2Attr("name"),
+			"alias":      icinga2Attr("display_name"),
+			"notes":      icinga2Attr("notes"),
+			"notes_url":  icinga2Attr("notes_url"),
+			"action_url": icinga2Attr("action_url"),
+			"members": func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+				members := []interface{}{}
+				for _, svc := range q.groupMembers("services", o.str("name")) {
+					members = append(members, []interface{}{svc.str("host_name"), svc.str("name")})
+				}
+				return members
+			},
+			"num_services":              icinga2ServicegroupCount("num_services"),
+			"num_services_ok":           icinga2ServicegroupCount("num_services_ok"),
+			"num_services_warn":         icinga2ServicegroupCount("num_services_warn"),
+			"num_services_crit":         icinga2ServicegroupCount("num_services_crit"),
+			"num_services_unknown":      icinga2ServicegroupCount("num_services_unknown"),
+			"num_services_pending":      icinga2ServicegroupCount("num_services_pending"),
+			"num_services_hard_ok":      icinga2ServicegroupCount("num_services_hard_ok"),
+			"num_services_hard_warn":    icinga2ServicegroupCount("num_services_hard_warn"),
+			"num_services_hard_crit":    icinga2ServicegroupCount("num_services_hard_crit"),
+			"num_services_hard_unknown": icinga2ServicegroupCount("num_services_hard_unknown"),
+			"worst_service_state":       icinga2ServicegroupCount("worst_service_state"),
+		},
+	},
+	TableContacts: {
+		types:  []string{"users"},
+		filter: map[string]string{"name": "user.name"},
+		less:   icinga2LessByName,
+		columns: map[string]icinga2APIColumn{
+			"name":                          icinga2Attr("name"),
+			"alias":                         icinga2Attr("display_name"),
+			"email":                         icinga2Attr("email"),
+			"pager":                         icinga2Attr("pager"),
+			"host_notification_period":      icinga2Attr("period"),
+			"service_notification_period":   icinga2Attr("period"),
+			"host_notifications_enabled":    icinga2Attr("enable_notifications"),
+			"service_notifications_enabled": icinga2Attr("enable_notifications"),
+			"can_submit_commands":           icinga2Value(float64(1)),
+			"custom_variable_names":         icinga2CustomVariableNames,
+			"custom_variable_values":        icinga2CustomVariableValues,
+		},
+	},
+	TableContactgroups: {
+		types:  []string{"usergroups"},
+		filter: map[string]string{"name": "usergroup.name"},
+		less:   icinga2LessByName,
+		columns: map[string]icinga2APIColumn{
+			"name":  icinga2Attr("name"),
+			"alias": icinga2Attr("display_name"),
+			"members": func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+				members := []interface{}{}
+				for _, user := range q.groupMembers("users", o.str("name")) {
+					members = append(members, user.str("name"))
+				}
+				return members
+			},
+		},
+	},
+	TableCommands: {
+		types: []string{"checkcommands", "eventcommands", "notificationcommands"},
+		less:  icinga2LessByName,
+		columns: map[string]icinga2APIColumn{
+			"name": icinga2Attr("name"),
+			"line": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+				line := []string{}
+				for _, arg := range o.list("command") {
+					line = append(line, *interface2string(arg))
+				}
+				return strings.Join(line, " ")
+			},
+		},
+	},
+	TableTimeperiods: {
+		types:  []string{"timeperiods"},
+		filter: map[string]string{"name": "timeperiod.name"},
+		less:   icinga2LessByName,
+		columns: map[string]icinga2APIColumn{
+			"name":  icinga2Attr("name"),
+			"alias": icinga2Attr("display_name"),
+			"in":    icinga2Attr("is_inside"),
+		},
+	},
+	TableComments: {
+		types:   []string{"comments"},
+		filter:  map[string]string{"id": "comment.legacy_id"},
+		less:    icinga2LessByID,
+		columns: icinga2CommentColumns(),
+	},
+	TableDowntimes: {
+		types:   []string{"downtimes"},
+		filter:  map[string]string{"id": "downtime.legacy_id"},
+		less:    icinga2LessByID,
+		columns: icinga2DowntimeColumns(),
+	},
+}
+
+// icinga2Attr returns the attribute unchanged
+func icinga2Attr(key string) icinga2APIColumn {
+	return func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+		switch v := o[key].(type) {
+		case bool:
+			return o.num(key)
+		case nil:
+			return nil
+		default:
+			return v
+		}
+	}
+}
+
+// icinga2Value returns a fixed value
+func icinga2Value(val interface{}) icinga2APIColumn {
+	return func(_ *icinga2APIQuery, _ icinga2APIObject) interface{} {
+		return val
+	}
+}
+
+// icinga2Minutes converts intervals from seconds into minutes
+func icinga2Minutes(key string) icinga2APIColumn {
+	return func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return o.num(key) / 60
+	}
+}
+
+func icinga2LessByName(a, b icinga2APIObject) bool {
+	return a.str("name") < b.str("name")
+}
+
+func icinga2LessByID(a, b icinga2APIObject) bool {
+	return a.num("legacy_id") < b.num("legacy_id")
+}
+
+func icinga2CustomVariableNames(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+	vars := o.sub("vars")
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]interface{}, len(names))
+	for i, name := range names {
+		list[i] = strings.ToUpper(name)
+	}
+	return list
+}
+
+func icinga2CustomVariableValues(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+	vars := o.sub("vars")
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]interface{}, len(names))
+	for i, name := range names {
+		if s, ok := vars[name].(string); ok {
+			list[i] = s
+		} else {
+			list[i] = interface2jsonstring(vars[name])
+		}
+	}
+	return list
+}
+
+// icinga2Output splits the plugin output into the first line and the long output
+func icinga2Output(o icinga2APIObject) (output string, long string) {
+	output = o.sub("last_check_result").str("output")
+	if i := strings.Index(output, "\n"); i >= 0 {
+		return output[:i], output[i+1:]
+	}
+	return output, ""
+}
+
+// icinga2HostState returns the livestatus host state, unreachable hosts are not a separate state in icinga2
+func icinga2HostState(o icinga2APIObject) float64 {
+	state := o.num("state")
+	if state != 0 && o["last_reachable"] == false {
+		return 2
+	}
+	return state
+}
+
+// icinga2HardState returns the current hard state
+func icinga2HardState(o icinga2APIObject, state float64) float64 {
+	if o.num("state_type") == 1 {
+		return state
+	}
+	return o.num("last_hard_state")
+}
+
+// icinga2CheckableColumns returns the columns shared by hosts and services
+func icinga2CheckableColumns() map[string]icinga2APIColumn {
+	return map[string]icinga2APIColumn{
+		"display_name":        icinga2Attr("display_name"),
+		"check_command":       icinga2Attr("check_command"),
+		"check_interval":      icinga2Minutes("check_interval"),
+		"retry_interval":      icinga2Minutes("retry_interval"),
+		"max_check_attempts":  icinga2Attr("max_check_attempts"),
+		"check_period":        icinga2Attr("check_period"),
+		"notes":               icinga2Attr("notes"),
+		"notes_expanded":      icinga2Attr("notes"),
+		"notes_url":           icinga2Attr("notes_url"),
+		"notes_url_expanded":  icinga2Attr("notes_url"),
+		"action_url":          icinga2Attr("action_url"),
+		"action_url_expanded": icinga2Attr("action_url"),
+		"icon_image":          icinga2Attr("icon_image"),
+		"icon_image_expanded": icinga2Attr("icon_image"),
+		"icon_image_alt":      icinga2Attr("icon_image_alt"),
+		"event_handler":       icinga2Attr("event_command"),
+		"groups": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			return o.list("groups")
+		},
+		"custom_variable_names":  icinga2CustomVariableNames,
+		"custom_variable_values": icinga2CustomVariableValues,
+		"state_type":             icinga2Attr("state_type"),
+		"current_attempt":        icinga2Attr("check_attempt"),
+		"last_check":             icinga2Attr("last_check"),
+		"next_check":             icinga2Attr("next_check"),
+		"last_state_change":      icinga2Attr("last_state_change"),
+		"last_hard_state_change": icinga2Attr("last_hard_state_change"),
+		"has_been_checked": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			if o.sub("last_check_result") != nil {
+				return float64(1)
+			}
+			return float64(0)
+		},
+		"plugin_output": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			output, _ := icinga2Output(o)
+			return output
+		},
+		"long_plugin_output": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			_, long := icinga2Output(o)
+			return long
+		},
+		"perf_data": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			perf := []string{}
+			for _, p := range o.sub("last_check_result").list("performance_data") {
+				perf = append(perf, *interface2string(p))
+			}
+			return strings.Join(perf, " ")
+		},
+		"execution_time": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			cr := o.sub("last_check_result")
+			return cr.num("execution_end") - cr.num("execution_start")
+		},
+		"latency": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			cr := o.sub("last_check_result")
+			latency := (cr.num("schedule_end") - cr.num("schedule_start")) - (cr.num("execution_end") - cr.num("execution_start"))
+			if latency < 0 {
+				return float64(0)
+			}
+			return latency
+		},
+		"check_type": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			if cr := o.sub("last_check_result"); cr != nil && cr["active"] == false {
+				return float64(1)
+			}
+			return float64(0)
+		},
+		"check_source": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			return o.sub("last_check_result").str("check_source")
+		},
+		"acknowledged": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			if o.num("acknowledgement") > 0 {
+				return float64(1)
+			}
+			return float64(0)
+		},
+		"acknowledgement_type":     icinga2Attr("acknowledgement"),
+		"scheduled_downtime_depth": icinga2Attr("downtime_depth"),
+		"is_flapping":              icinga2Attr("flapping"),
+		"percent_state_change":     icinga2Attr("flapping_current"),
+		"active_checks_enabled":    icinga2Attr("enable_active_checks"),
+		"checks_enabled":           icinga2Attr("enable_active_checks"),
+		"accept_passive_checks":    icinga2Attr("enable_passive_checks"),
+		"notifications_enabled":    icinga2Attr("enable_notifications"),
+		"event_handler_enabled":    icinga2Attr("enable_event_handler"),
+		"flap_detection_enabled":   icinga2Attr("enable_flapping"),
+		"process_performance_data": icinga2Attr("enable_perfdata"),
+		"high_flap_threshold":      icinga2Attr("flapping_threshold_high"),
+		"low_flap_threshold":       icinga2Attr("flapping_threshold_low"),
+		"in_check_period":          icinga2Value(float64(1)),
+		"in_notification_period":   icinga2Value(float64(1)),
+		"last_state":               icinga2Attr("last_state"),
+		"last_hard_state":          icinga2Attr("last_hard_state"),
+		"contacts": func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+			contacts, _ := q.contacts(o)
+			return contacts
+		},
+		"contact_groups": func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+			_, groups := q.contacts(o)
+			return groups
+		},
+	}
+}
+
+func icinga2HostColumns() map[string]icinga2APIColumn {
+	columns := icinga2CheckableColumns()
+	columns["name"] = icinga2Attr("name")
+	columns["alias"] = icinga2Attr("display_name")
+	columns["address"] = icinga2Attr("address")
+	columns["address6"] = icinga2Attr("address6")
+	columns["state"] = func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return icinga2HostState(o)
+	}
+	columns["hard_state"] = func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return icinga2HardState(o, icinga2HostState(o))
+	}
+	columns["last_time_up"] = icinga2Attr("last_state_up")
+	columns["last_time_down"] = icinga2Attr("last_state_down")
+	columns["last_time_unreachable"] = icinga2Attr("last_state_unreachable")
+	columns["services"] = func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+		services := []interface{}{}
+		for _, svc := range q.hostServices(o.str("name")) {
+			services = append(services, svc.str("name"))
+		}
+		return services
+	}
+	for _, name := range icinga2ServiceCountColumns {
+		columns[name] = icinga2HostServiceCount(name)
+	}
+	return columns
+}
+
+func icinga2ServiceColumns() map[string]icinga2APIColumn {
+	columns := icinga2CheckableColumns()
+	columns["host_name"] = icinga2Attr("host_name")
+	columns["description"] = icinga2Attr("name")
+	columns["state"] = icinga2Attr("state")
+	columns["hard_state"] = func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return icinga2HardState(o, o.num("state"))
+	}
+	columns["last_time_ok"] = icinga2Attr("last_state_ok")
+	columns["last_time_warning"] = icinga2Attr("last_state_warning")
+	columns["last_time_critical"] = icinga2Attr("last_state_critical")
+	columns["last_time_unknown"] = icinga2Attr("last_state_unknown")
+	return columns
+}
+
+func icinga2CommentColumns() map[string]icinga2APIColumn {
+	return map[string]icinga2APIColumn{
+		"id":                  icinga2Attr("legacy_id"),
+		"author":              icinga2Attr("author"),
+		"comment":             icinga2Attr("text"),
+		"entry_time":          icinga2Attr("entry_time"),
+		"entry_type":          icinga2Attr("entry_type"),
+		"expire_time":         icinga2Attr("expire_time"),
+		"persistent":          icinga2Attr("persistent"),
+		"host_name":           icinga2Attr("host_name"),
+		"service_description": icinga2Attr("service_name"),
+		"source":              icinga2Value(float64(1)),
+		"expires": func(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+			if o.num("expire_time") > 0 {
+				return float64(1)
+			}
+			return float64(0)
+		},
+		"is_service": icinga2IsService,
+		"type":       icinga2ObjectType,
+	}
+}
+
+func icinga2DowntimeColumns() map[string]icinga2APIColumn {
+	return map[string]icinga2APIColumn{
+		"id":                  icinga2Attr("legacy_id"),
+		"author":              icinga2Attr("author"),
+		"comment":             icinga2Attr("comment"),
+		"entry_time":          icinga2Attr("entry_time"),
+		"start_time":          icinga2Attr("start_time"),
+		"end_time":            icinga2Attr("end_time"),
+		"duration":            icinga2Attr("duration"),
+		"fixed":               icinga2Attr("fixed"),
+		"host_name":           icinga2Attr("host_name"),
+		"service_description": icinga2Attr("service_name"),
+		"triggered_by":        icinga2Value(float64(0)),
+		"is_service":          icinga2IsService,
+		"type":                icinga2ObjectType,
+	}
+}
+
+func icinga2IsService(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+	if o.str("service_name") != "" {
+		return float64(1)
+	}
+	return float64(0)
+}
+
+// icinga2ObjectType returns 1 for host and 2 for service comments and downtimes
+func icinga2ObjectType(_ *icinga2APIQuery, o icinga2APIObject) interface{} {
+	if o.str("service_name") != "" {
+		return float64(2)
+	}
+	return float64(1)
+}
+
+// icinga2ServiceCountColumns contains the service summary columns of the hosts table
+var icinga2ServiceCountColumns = []string{
+	"num_services",
+	"num_services_ok",
+	"num_services_warn",
+	"num_services_crit",
+	"num_services_unknown",
+	"num_services_pending",
+	"num_services_hard_ok",
+	"num_services_hard_warn",
+	"num_services_hard_crit",
+	"num_services_hard_unknown",
+	"worst_service_state",
+	"worst_service_hard_state",
+}
+
+// icinga2ServiceStateOrder sorts service states by severity: ok, warning, unknown, critical
+var icinga2ServiceStateOrder = map[float64]int{0: 0, 1: 1, 3: 2, 2: 3}
+
+// icinga2HostStateOrder sorts host states by severity: up, unreachable, down
+var icinga2HostStateOrder = map[float64]int{0: 0, 2: 1, 1: 2}
+
+// icinga2ServiceCounts summarizes the states of the given services
+func icinga2ServiceCounts(services []icinga2APIObject) map[string]float64 {
+	counts := make(map[string]float64)
+	names := []string{"ok", "warn", "crit", "unknown"}
+	for _, svc := range services {
+		counts["num_services"]++
+		state := svc.num("state")
+		hardState := icinga2HardState(svc, state)
+		if svc.sub("last_check_result") == nil {
+			counts["num_services_pending"]++
+		} else if int(state) < len(names) {
+			counts["num_services_"+names[int(state)]]++
+		}
+		if int(hardState) < len(names) {
+			counts["num_services_hard_"+names[int(hardState)]]++
+		}
+		if icinga2ServiceStateOrder[state] > icinga2ServiceStateOrder[counts["worst_service_state"]] {
+			counts["worst_service_state"] = state
+		}
+		if icinga2ServiceStateOrder[hardState] > icinga2ServiceStateOrder[counts["worst_service_hard_state"]] {
+			counts["worst_service_hard_state"] = hardState
+		}
+	}
+	return counts
+}
+
+// icinga2HostCounts summarizes the states of the given hosts
+func icinga2HostCounts(hosts []icinga2APIObject) map[string]float64 {
+	counts := make(map[string]float64)
+	names := []string{"up", "down", "unreach"}
+	for _, host := range hosts {
+		counts["num_hosts"]++
+		state := icinga2HostState(host)
+		if host.sub("last_check_result") == nil {
+			counts["num_hosts_pending"]++
+		} else if int(state) < len(names) {
+			counts["num_hosts_"+names[int(state)]]++
+		}
+		if icinga2HostStateOrder[state] > icinga2HostStateOrder[counts["worst_host_state"]] {
+			counts["worst_host_state"] = state
+		}
+	}
+	return counts
+}
+
+func icinga2HostServiceCount(name string) icinga2APIColumn {
+	return func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return q.counts("host;"+o.str("name"), func() map[string]float64 {
+			return icinga2ServiceCounts(q.hostServices(o.str("name")))
+		})[name]
+	}
+}
+
+func icinga2HostgroupCount(name string) icinga2APIColumn {
+	return func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return q.counts("hostgroup;"+o.str("name"), func() map[string]float64 {
+			return icinga2HostCounts(q.groupMembers("hosts", o.str("name")))
+		})[name]
+	}
+}
+
+func icinga2HostgroupServiceCount(name string) icinga2APIColumn {
+	return func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return q.counts("hostgroupservices;"+o.str("name"), func() map[string]float64 {
+			services := []icinga2APIObject{}
+			for _, host := range q.groupMembers("hosts", o.str("name")) {
+				services = append(services, q.hostServices(host.str("name"))...)
+			}
+			return icinga2ServiceCounts(services)
+		})[name]
+	}
+}
+
+func icinga2ServicegroupCount(name string) icinga2APIColumn {
+	return func(q *icinga2APIQuery, o icinga2APIObject) interface{} {
+		return q.counts("servicegroup;"+o.str("name"), func() map[string]float64 {
+			return icinga2ServiceCounts(q.groupMembers("services", o.str("name")))
+		})[name]
+	}
+}
+
+// icinga2DefaultValue returns the empty value for columns without icinga2 equivalent
+func icinga2DefaultValue(col *Column) interface{} {
+	if col == nil {
+		return nil
+	}
+	switch col.DataType {
+	case StringCol, StringLargeCol, JSONCol:
+		return ""
+	case IntCol, Int64Col, FloatCol:
+		return float64(0)
+	default:
+		return []interface{}{}
+	}
+}
@@ -140,6 +140,18 @@ func importPeerFromFile(peers []*Peer, filename string, localConfig *Config, wai
 
 // importPeersFromTar imports all peers from tarball
 func importPeersFromTar(localConfig *Config, waitGroupPeers *sync.WaitGroup, shutdownChannel chan bool, tarFile string) (peers []*Peer, err error) {
+	err = readTarball(tarFile, func(header *tar.Header, tarReader io.Reader) (err error) {
+		peers, err = importPeerFromTar(peers, header, tarReader, localConfig, waitGroupPeers, shutdownChannel)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// readTarball calls fn for each regular file in the given gzipped tarball
+func readTarball(tarFile string, fn func(header *tar.Header, tarReader io.Reader) error) (err error) {
 	f, err := os.Open(tarFile)
 	if err != nil {
 		err = fmt.Errorf("cannot read %s: %s", tarFile, err)
@@ -162,18 +174,18 @@ func importPeersFromTar(localConfig *Config, waitGroupPeers *sync.WaitGroup, shu
 		}
 
 		if err != nil {
-			return nil, fmt.Errorf("gzip/tarball error %s: %s", tarFile, err)
+			return fmt.Errorf("gzip/tarball error %s: %s", tarFile, err)
 		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
 		case tar.TypeReg:
-			peers, err = importPeerFromTar(peers, header, tarReader, localConfig, waitGroupPeers, shutdownChannel)
+			err = fn(header, tarReader)
 			if err != nil {
-				return nil, fmt.Errorf("gzip/tarball error %s in file %s: %s", tarFile, header.Name, err)
+				return fmt.Errorf("gzip/tarball error %s in file %s: %s", tarFile, header.Name, err)
 			}
 		default:
-			return nil, fmt.Errorf("gzip/tarball error %s: unsupported type in file %s: %c", tarFile, header.Name, header.Typeflag)
+			return fmt.Errorf("gzip/tarball error %s: unsupported type in file %s: %c", tarFile, header.Name, header.Typeflag)
 		}
 	}
 
@@ -0,0 +1,825 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// LogCacheSyncInterval sets the interval in which new log entries are fetched in the background.
+	LogCacheSyncInterval = 60 * time.Second
+
+	// LogCacheMaxLag sets the maximum age of the last synchronization for a log store to answer queries.
+	// Stores lagging behind, ex. after a restart, will pass queries through until they caught up.
+	LogCacheMaxLag = 3 * LogCacheSyncInterval
+
+	// logCacheChunkSize sets the time range in seconds fetched with a single query, which
+	// is also the time range of a single segment file.
+	logCacheChunkSize = 86400
+)
+
+// logCache is the local log table cache, it is nil if the cache is disabled
+var logCache *LogCache
+
+// logCacheSyncRunning is set while all log stores are synchronized to prevent overlapping runs
+var logCacheSyncRunning int32
+
+// LogCache stores the log entries of all peers on disk and answers log table
+// queries locally instead of passing them through to the backends.
+type LogCache struct {
+	noCopy    noCopy
+	lock      *deadlock.Mutex
+	dir       string
+	retention int64 // retention in seconds
+	stores    map[string]*LogStore
+}
+
+// LogStore contains the cached log entries of a single peer. Entries are appended to
+// one segment file per day along with an index file, which contains the time, host and
+// service of each entry and its position in the segment file.
+type LogStore struct {
+	noCopy    noCopy
+	lock      *deadlock.RWMutex
+	syncLock  *deadlock.Mutex // serializes synchronizations
+	syncing   int32           // set while a background synchronization is running
+	verify    bool            // segments might contain entries after the saved state, ex. after a crash
+	peer      *Peer
+	dir       string
+	retention int64
+	state     LogStoreState
+	indexLock *deadlock.Mutex // protects the segments map, the indexes itself are protected by lock
+	segments  map[string]*logSegmentIndex
+}
+
+// LogStoreState contains the synchronization state of a log store.
+type LogStoreState struct {
+	Start int64 `json:"start"` // log entries are complete starting at this timestamp
+	Last  int64 `json:"last"`  // log entries are complete up to this timestamp (exclusive)
+}
+
+// logIndexEntry contains the index values of a single log entry.
+type logIndexEntry struct {
+	time    int64
+	offset  int64
+	length  int
+	host    string
+	service string
+}
+
+// logSegmentIndex contains the index entries of a single segment in time order along with
+// the positions of the entries of each host and service.
+type logSegmentIndex struct {
+	entries  []logIndexEntry
+	hosts    map[string][]int // entry positions by host name
+	services map[string][]int // entry positions by host name and service description
+}
+
+// logCacheCondition contains the time range, host and service a request is limited to.
+type logCacheCondition struct {
+	from    int64 // inclusive
+	to      int64 // exclusive
+	host    string
+	service string
+}
+
+// NewLogCache creates a new log cache storing entries for retention days in dir.
+// It returns nil if dir is empty.
+func NewLogCache(dir string, retention int) *LogCache {
+	if dir == "" {
+		return nil
+	}
+	return &LogCache{
+		lock:      new(deadlock.Mutex),
+		dir:       dir,
+		retention: int64(retention) * 86400,
+		stores:    make(map[string]*LogStore),
+	}
+}
+
+// Store returns the log store of the given peer, it will be created on first use.
+func (c *LogCache) Store(p *Peer) *LogStore {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	store, ok := c.stores[p.ID]
+	if ok && store.peer == p {
+		return store
+	}
+	store = &LogStore{
+		lock:      new(deadlock.RWMutex),
+		syncLock:  new(deadlock.Mutex),
+		peer:      p,
+		dir:       filepath.Join(c.dir, strings.ReplaceAll(p.ID, string(os.PathSeparator), "_")),
+		retention: c.retention,
+		verify:    true,
+		indexLock: new(deadlock.Mutex),
+		segments:  make(map[string]*logSegmentIndex),
+	}
+	if err := store.loadState(); err != nil {
+		logWith(p).Warnf("failed to read log cache state: %s", err.Error())
+	}
+	c.stores[p.ID] = store
+	return store
+}
+
+// SyncAll fetches new log entries for all online peers and removes expired segments.
+func (c *LogCache) SyncAll() {
+	if !atomic.CompareAndSwapInt32(&logCacheSyncRunning, 0, 1) {
+		log.Debugf("skipping log cache sync, previous sync is still running")
+		return
+	}
+	defer atomic.StoreInt32(&logCacheSyncRunning, 0)
+
+	peers := make([]*Peer, 0)
+	PeerMapLock.RLock()
+	for _, id := range PeerMapOrder {
+		p := PeerMap[id]
+		if p.HasFlag(MultiBackend) {
+			continue
+		}
+		if nodeAccessor == nil || !nodeAccessor.IsOurBackend(p.ID) {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	PeerMapLock.RUnlock()
+
+	for _, p := range peers {
+		if !p.isOnline() {
+			continue
+		}
+		store := c.Store(p)
+		t1 := time.Now()
+		if err := store.Sync(); err != nil {
+			logWith(p).Warnf("failed to sync log cache: %s", err.Error())
+			continue
+		}
+		if err := store.Prune(); err != nil {
+			logWith(p).Warnf("failed to remove expired log cache segments: %s", err.Error())
+		}
+		logWith(p).Debugf("log cache synced in %s", time.Since(t1).String())
+	}
+}
+
+// Ready returns true if the store has been synchronized recently enough to answer queries.
+func (s *LogStore) Ready() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.state.Last > 0 && s.state.Last >= time.Now().Add(-LogCacheMaxLag).Unix()
+}
+
+// SyncBackground starts a synchronization in the background unless there is one running already.
+func (s *LogStore) SyncBackground() {
+	if !atomic.CompareAndSwapInt32(&s.syncing, 0, 1) {
+		return
+	}
+	go func() {
+		defer logPanicExitPeer(s.peer)
+		defer atomic.StoreInt32(&s.syncing, 0)
+		if err := s.Sync(); err != nil {
+			logWith(s.peer).Warnf("failed to sync log cache: %s", err.Error())
+		}
+	}()
+}
+
+// Sync fetches all log entries since the last synchronization. The initial synchronization
+// fetches all entries within the retention period day by day.
+func (s *LogStore) Sync() error {
+	s.syncLock.Lock()
+	defer s.syncLock.Unlock()
+
+	now := time.Now().Unix()
+	s.lock.Lock()
+	if s.state.Last < now-s.retention {
+		// initial synchronization or outage longer than the retention period
+		s.state.Start = now - s.retention
+		s.state.Last = s.state.Start
+	}
+	if s.verify {
+		// remove entries which have been written without saving the state afterwards, they
+		// would be fetched again otherwise and result in duplicate log entries
+		if err := s.truncate(s.state.Last); err != nil {
+			s.lock.Unlock()
+			return err
+		}
+		s.verify = false
+	}
+	last := s.state.Last
+	s.lock.Unlock()
+
+	// entries of the current second might still be incomplete, so fetch up to now exclusively
+	for last < now {
+		to := last + logCacheChunkSize
+		if to > now {
+			to = now
+		}
+		rows, err := s.fetch(last, to)
+		if err != nil {
+			return err
+		}
+		s.lock.Lock()
+		err = s.append(rows)
+		if err == nil {
+			s.state.Last = to
+			err = s.saveState()
+		}
+		if err != nil {
+			s.verify = true
+		}
+		s.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		last = to
+	}
+	return nil
+}
+
+// Prune removes all segments which are older than the retention period.
+func (s *LogStore) Prune() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	files, err := filepath.Glob(filepath.Join(s.dir, "log-*.idx"))
+	if err != nil {
+		return err
+	}
+	expired := logSegmentName(time.Now().Unix() - s.retention)
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".idx")
+		if name >= expired {
+			continue
+		}
+		for _, f := range []string{file, strings.TrimSuffix(file, ".idx") + ".json"} {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	s.indexLock.Lock()
+	for segment := range s.segments {
+		if segment < expired {
+			delete(s.segments, segment)
+		}
+	}
+	s.indexLock.Unlock()
+	return nil
+}
+
+// DataStore returns a temporary data store containing all log entries possibly matching the filter.
+// It returns false if the store does not contain all entries for the requested time range.
+func (s *LogStore) DataStore(filter []*Filter) (store *DataStore, ok bool, err error) {
+	data, err := s.peer.GetDataStoreSet()
+	if err != nil {
+		return
+	}
+
+	cond := newLogCacheCondition(filter)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	start := s.state.Start
+	if start < time.Now().Unix()-s.retention {
+		start = time.Now().Unix() - s.retention
+	}
+	if s.state.Last == 0 || cond.from < start {
+		return
+	}
+	if cond.to > s.state.Last {
+		cond.to = s.state.Last
+	}
+
+	rows, err := s.read(cond)
+	if err != nil {
+		return
+	}
+	store = NewDataStore(Objects.Tables[TableLog], s.peer)
+	store.DataSet = data
+	err = store.InsertData(rows, logCacheColumns(), false)
+	if err != nil {
+		return
+	}
+	return store, true, nil
+}
+
+// fetch queries all log entries within the given time range from the backend.
+func (s *LogStore) fetch(from, to int64) (ResultSet, error) {
+	columns := logCacheColumns()
+	req := &Request{
+		Table:     TableLog,
+		Columns:   make([]string, 0, len(columns)),
+		FilterStr: fmt.Sprintf("Filter: time >= %d\nFilter: time < %d\n", from, to),
+	}
+	for _, col := range columns {
+		req.Columns = append(req.Columns, col.Name)
+	}
+	s.peer.setQueryOptions(req)
+	// do not use Query here, log queries should not be logged as slow queries
+	res, _, err := s.peer.query(req)
+	return res, err
+}
+
+// append writes the log entries to their segment files and updates the index, lock must be held.
+func (s *LogStore) append(rows ResultSet) (err error) {
+	if len(rows) == 0 {
+		return
+	}
+	err = os.MkdirAll(s.dir, DefaultDirPerm)
+	if err != nil {
+		return
+	}
+	table := Objects.Tables[TableLog]
+	timeIndex := logCacheColumnIndex(table.GetColumn("time"))
+	hostIndex := logCacheColumnIndex(table.GetColumn("host_name"))
+	serviceIndex := logCacheColumnIndex(table.GetColumn("service_description"))
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return interface2int64(rows[i][timeIndex]) < interface2int64(rows[j][timeIndex])
+	})
+
+	for len(rows) > 0 {
+		segment := logSegmentName(interface2int64(rows[0][timeIndex]))
+		num := sort.Search(len(rows), func(i int) bool {
+			return logSegmentName(interface2int64(rows[i][timeIndex])) != segment
+		})
+		entries := make([]logIndexEntry, 0, num)
+		for _, row := range rows[:num] {
+			entries = append(entries, logIndexEntry{
+				time:    interface2int64(row[timeIndex]),
+				host:    interface2stringNoDedup(row[hostIndex]),
+				service: interface2stringNoDedup(row[serviceIndex]),
+			})
+		}
+		err = s.appendSegment(segment, rows[:num], entries)
+		if err != nil {
+			return
+		}
+		rows = rows[num:]
+	}
+	return
+}
+
+// appendSegment appends the rows to a single segment file. The index is written after the data, so
+// an interrupted write never leads to index entries pointing to incomplete data.
+func (s *LogStore) appendSegment(segment string, rows ResultSet, entries []logIndexEntry) (err error) {
+	dataFile, err := os.OpenFile(filepath.Join(s.dir, segment+".json"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, DefaultFilePerm)
+	if err != nil {
+		return
+	}
+	defer dataFile.Close()
+	stat, err := dataFile.Stat()
+	if err != nil {
+		return
+	}
+	offset := stat.Size()
+	writer := bufio.NewWriter(dataFile)
+	for i, row := range rows {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if _, err = writer.Write(line); err != nil {
+			return err
+		}
+		entries[i].offset = offset
+		entries[i].length = len(line)
+		offset += int64(len(line))
+	}
+	if err = writer.Flush(); err != nil {
+		return
+	}
+	if err = dataFile.Close(); err != nil {
+		return
+	}
+
+	indexFile, err := os.OpenFile(filepath.Join(s.dir, segment+".idx"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, DefaultFilePerm)
+	if err != nil {
+		return
+	}
+	defer indexFile.Close()
+	writer = bufio.NewWriter(indexFile)
+	for i := range entries {
+		e := &entries[i]
+		line, err := json.Marshal([]interface{}{e.time, e.offset, e.length, e.host, e.service})
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if _, err = writer.Write(line); err != nil {
+			return err
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		return
+	}
+	if err = indexFile.Close(); err != nil {
+		return
+	}
+
+	// keep already loaded indexes up to date
+	s.indexLock.Lock()
+	idx, ok := s.segments[segment]
+	s.indexLock.Unlock()
+	if ok {
+		idx.add(entries)
+	}
+	return
+}
+
+// truncate removes all entries starting at the given timestamp from the segment files, lock must be held.
+func (s *LogStore) truncate(from int64) error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "log-*.idx"))
+	if err != nil {
+		return err
+	}
+	first := logSegmentName(from)
+	for _, file := range files {
+		segment := strings.TrimSuffix(filepath.Base(file), ".idx")
+		if segment < first {
+			continue
+		}
+		if err := s.truncateSegment(segment, from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncateSegment removes all entries starting at the given timestamp from a single segment along
+// with incomplete entries from interrupted writes, lock must be held.
+func (s *LogStore) truncateSegment(segment string, from int64) error {
+	indexFile, err := os.Open(filepath.Join(s.dir, segment+".idx"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	indexSize := int64(0)
+	dataSize := int64(0)
+	reader := bufio.NewReader(indexFile)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// incomplete last line or end of file
+			break
+		}
+		var raw []interface{}
+		if json.Unmarshal(line, &raw) != nil || len(raw) != 5 || interface2int64(raw[0]) >= from {
+			break
+		}
+		indexSize += int64(len(line))
+		dataSize = interface2int64(raw[1]) + interface2int64(raw[2])
+	}
+	indexFile.Close()
+
+	s.indexLock.Lock()
+	delete(s.segments, segment)
+	s.indexLock.Unlock()
+
+	for _, f := range []struct {
+		name string
+		size int64
+	}{
+		{segment + ".idx", indexSize},
+		{segment + ".json", dataSize},
+	} {
+		file := filepath.Join(s.dir, f.name)
+		if indexSize == 0 {
+			err = os.Remove(file)
+		} else {
+			err = os.Truncate(file, f.size)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns all log entries matching the condition in time order, lock must be held.
+func (s *LogStore) read(cond *logCacheCondition) (rows ResultSet, err error) {
+	rows = make(ResultSet, 0)
+	for day := cond.from - cond.from%logCacheChunkSize; day < cond.to; day += logCacheChunkSize {
+		segment := logSegmentName(day)
+		idx, err := s.segmentIndex(segment)
+		if err != nil {
+			return nil, err
+		}
+		entries := idx.find(cond)
+		if len(entries) == 0 {
+			continue
+		}
+		dataFile, err := os.Open(filepath.Join(s.dir, segment+".json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			line := make([]byte, e.length)
+			if _, err = dataFile.ReadAt(line, e.offset); err != nil {
+				dataFile.Close()
+				return nil, fmt.Errorf("failed to read %s: %s", segment, err.Error())
+			}
+			var row []interface{}
+			if err = json.Unmarshal(line, &row); err != nil {
+				dataFile.Close()
+				return nil, fmt.Errorf("failed to parse %s: %s", segment, err.Error())
+			}
+			rows = append(rows, row)
+		}
+		dataFile.Close()
+	}
+	return
+}
+
+// segmentIndex returns the index of a segment, it is read from the index file on first use, lock must be held.
+func (s *LogStore) segmentIndex(segment string) (*logSegmentIndex, error) {
+	s.indexLock.Lock()
+	defer s.indexLock.Unlock()
+	if idx, ok := s.segments[segment]; ok {
+		return idx, nil
+	}
+	entries, err := s.readIndex(segment)
+	if err != nil {
+		return nil, err
+	}
+	idx := newLogSegmentIndex()
+	idx.add(entries)
+	s.segments[segment] = idx
+	return idx, nil
+}
+
+// readIndex returns all index entries of a segment file.
+func (s *LogStore) readIndex(segment string) (entries []logIndexEntry, err error) {
+	indexFile, err := os.Open(filepath.Join(s.dir, segment+".idx"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer indexFile.Close()
+	scanner := bufio.NewScanner(indexFile)
+	for scanner.Scan() {
+		var raw []interface{}
+		if json.Unmarshal(scanner.Bytes(), &raw) != nil || len(raw) != 5 {
+			// skip incomplete entries from interrupted writes
+			continue
+		}
+		e := logIndexEntry{
+			time:    interface2int64(raw[0]),
+			offset:  interface2int64(raw[1]),
+			length:  interface2int(raw[2]),
+			host:    interface2stringNoDedup(raw[3]),
+			service: interface2stringNoDedup(raw[4]),
+		}
+		entries = append(entries, e)
+	}
+	err = scanner.Err()
+	return
+}
+
+func newLogSegmentIndex() *logSegmentIndex {
+	return &logSegmentIndex{
+		hosts:    make(map[string][]int),
+		services: make(map[string][]int),
+	}
+}
+
+// add adds the entries to the index. Entries are usually appended in time order, otherwise
+// the index will be rebuilt.
+func (idx *logSegmentIndex) add(entries []logIndexEntry) {
+	num := len(idx.entries)
+	idx.entries = append(idx.entries, entries...)
+	for i := num; i < len(idx.entries); i++ {
+		if i > 0 && idx.entries[i].time < idx.entries[i-1].time {
+			sort.SliceStable(idx.entries, func(i, j int) bool {
+				return idx.entries[i].time < idx.entries[j].time
+			})
+			idx.hosts = make(map[string][]int)
+			idx.services = make(map[string][]int)
+			num = 0
+			break
+		}
+	}
+	for i := num; i < len(idx.entries); i++ {
+		e := &idx.entries[i]
+		idx.hosts[e.host] = append(idx.hosts[e.host], i)
+		if e.service != "" {
+			key := e.host + ";" + e.service
+			idx.services[key] = append(idx.services[key], i)
+		}
+	}
+}
+
+// find returns all entries matching the condition in time order.
+func (idx *logSegmentIndex) find(cond *logCacheCondition) (entries []logIndexEntry) {
+	var positions []int
+	switch {
+	case cond.host != "" && cond.service != "":
+		positions = idx.services[cond.host+";"+cond.service]
+	case cond.host != "":
+		positions = idx.hosts[cond.host]
+	default:
+		from := sort.Search(len(idx.entries), func(i int) bool { return idx.entries[i].time >= cond.from })
+		to := sort.Search(len(idx.entries), func(i int) bool { return idx.entries[i].time >= cond.to })
+		for _, e := range idx.entries[from:to] {
+			if cond.service != "" && e.service != cond.service {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		return
+	}
+	start := sort.Search(len(positions), func(i int) bool { return idx.entries[positions[i]].time >= cond.from })
+	for _, pos := range positions[start:] {
+		e := idx.entries[pos]
+		if e.time >= cond.to {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+// loadState reads the synchronization state from disk.
+func (s *LogStore) loadState() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "state.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &s.state)
+}
+
+// saveState writes the synchronization state to disk, lock must be held.
+func (s *LogStore) saveState() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(s.dir, DefaultDirPerm)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(s.dir, "state.json")
+	err = ioutil.WriteFile(file+".tmp", data, DefaultFilePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// logSegmentName returns the name of the segment containing the given timestamp
+func logSegmentName(timestamp int64) string {
+	return "log-" + time.Unix(timestamp, 0).UTC().Format("20060102")
+}
+
+// logCacheColumns returns the columns stored in the log cache
+func logCacheColumns() ColumnList {
+	table := Objects.Tables[TableLog]
+	columns := make(ColumnList, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		if col.StorageType == LocalStore {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// logCacheColumnIndex returns the position of the column in stored log entries
+func logCacheColumnIndex(col *Column) int {
+	for i, c := range logCacheColumns() {
+		if c == col {
+			return i
+		}
+	}
+	return -1
+}
+
+// newLogCacheCondition extracts the time range, host and service from the request filter. The
+// condition only narrows down the entries to read, the filter still has to be applied to each row.
+func newLogCacheCondition(filter []*Filter) *logCacheCondition {
+	cond := &logCacheCondition{from: 0, to: math.MaxInt64}
+	cond.add(filter)
+	return cond
+}
+
+func (cond *logCacheCondition) add(filter []*Filter) {
+	for _, f := range filter {
+		if f.Negate {
+			continue
+		}
+		if len(f.Filter) > 0 {
+			if f.GroupOperator == And {
+				cond.add(f.Filter)
+			}
+			continue
+		}
+		if f.Column == nil || f.IsEmpty {
+			continue
+		}
+		switch f.Column.Name {
+		case "time":
+			cond.addTime(f.Operator, f.FloatValue)
+		case "host_name":
+			if f.Operator == Equal {
+				cond.host = f.StrValue
+			}
+		case "service_description":
+			if f.Operator == Equal {
+				cond.service = f.StrValue
+			}
+		}
+	}
+}
+
+func (cond *logCacheCondition) addTime(op Operator, value float64) {
+	from := int64(math.MinInt64)
+	to := int64(math.MaxInt64)
+	switch op {
+	case Equal:
+		from = int64(math.Ceil(value))
+		to = int64(math.Floor(value)) + 1
+	case Greater:
+		from = int64(math.Floor(value)) + 1
+	case GreaterThan:
+		from = int64(math.Ceil(value))
+	case Less:
+		to = int64(math.Ceil(value))
+	case LessThan:
+		to = int64(math.Floor(value)) + 1
+	}
+	if from > cond.from {
+		cond.from = from
+	}
+	if to < cond.to {
+		cond.to = to
+	}
+}
+
+// BuildLogCacheResult answers a log table request from the local log cache. It returns false if
+// the log cache does not contain all requested entries for all selected peers.
+// New log entries are fetched in the background, so the result contains the entries
+// cached so far.
+func (res *Response) BuildLogCacheResult() bool {
+	req := res.Request
+	stores := make([]*DataStore, 0, len(res.SelectedPeers))
+	// failed peers are only reported if the request is answered from the cache
+	failed := make(map[string]string)
+	for _, p := range res.SelectedPeers {
+		if !p.isOnline() {
+			failed[p.ID] = fmt.Sprintf("%v", p.StatusGet(LastError))
+			continue
+		}
+		logStore := logCache.Store(p)
+		if !logStore.Ready() {
+			return false
+		}
+		logStore.SyncBackground()
+		store, ok, err := logStore.DataStore(req.Filter)
+		if err != nil {
+			failed[p.ID] = err.Error()
+			continue
+		}
+		if !ok {
+			return false
+		}
+		stores = append(stores, store)
+	}
+	res.Lock.Lock()
+	for id, msg := range failed {
+		res.Failed[id] = msg
+	}
+	res.Lock.Unlock()
+
+	res.RawResults = &RawResultSet{}
+	res.RawResults.Sort = req.Sort
+	var resultcollector chan *PeerResponse
+	if len(req.Stats) == 0 {
+		resultcollector = make(chan *PeerResponse, len(stores))
+	}
+	for _, store := range stores {
+		res.BuildLocalResponseData(store, resultcollector)
+	}
+	if resultcollector != nil {
+		close(resultcollector)
+		for subRes := range resultcollector {
+			res.RawResults.Total += subRes.Total
+			res.RawResults.RowsScanned += subRes.RowsScanned
+			res.RawResults.DataResult = append(res.RawResults.DataResult, subRes.Rows...)
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLogCache(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	dir, err := ioutil.TempDir("", "lmd-logcache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logCache = NewLogCache(dir, 2)
+	defer func() { logCache = nil }()
+
+	PeerMapLock.RLock()
+	p := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+
+	// initial sync fills the cache for the retention period
+	store := logCache.Store(p)
+	if err = assertEq(false, store.Ready()); err != nil {
+		t.Error(err)
+	}
+	if err = store.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(true, store.Ready()); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now().Unix()
+	columns := logCacheColumns()
+	rows := make(ResultSet, 0)
+	for i := 0; i < 30; i++ {
+		row := make([]interface{}, len(columns))
+		for j, col := range columns {
+			switch col.DataType {
+			case StringCol:
+				row[j] = ""
+			case StringListCol:
+				row[j] = []interface{}{}
+			default:
+				row[j] = float64(0)
+			}
+		}
+		row[logCacheColumnIndex(Objects.Tables[TableLog].GetColumn("time"))] = float64(now - 86400 + int64(i)*2000)
+		row[logCacheColumnIndex(Objects.Tables[TableLog].GetColumn("host_name"))] = fmt.Sprintf("testhost_%d", i%3+1)
+		row[logCacheColumnIndex(Objects.Tables[TableLog].GetColumn("service_description"))] = fmt.Sprintf("testsvc_%d", i%2+1)
+		row[logCacheColumnIndex(Objects.Tables[TableLog].GetColumn("message"))] = fmt.Sprintf("message %d", i)
+		rows = append(rows, row)
+	}
+	store.lock.Lock()
+	err = store.append(rows)
+	store.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(q string) *Response {
+		req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString(q)), ParseOptimize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = req.ExpandRequestedBackends(); err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewResponse(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res := query(fmt.Sprintf("GET log\nColumns: time host_name message\nFilter: time >= %d\nFilter: host_name = testhost_2\nSort: time desc\n\n", now-86400))
+	if err = assertEq(true, res.RawResults != nil); err != nil {
+		t.Fatal(err)
+	}
+	result := res.RawResults.DataResult
+	if err = assertEq(10, len(result)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("message 28", result[0].GetStringByName("message")); err != nil {
+		t.Error(err)
+	}
+
+	res = query(fmt.Sprintf("GET log\nFilter: time > %d\nFilter: time <= %d\nStats: state = 0\n\n", now-86400, now-86400+5*2000))
+	if err = assertEq(float64(5), res.Result[0][0]); err != nil {
+		t.Error(err)
+	}
+
+	// host and service lookups use the index
+	res = query(fmt.Sprintf("GET log\nColumns: message\nFilter: time >= %d\nFilter: host_name = testhost_2\nFilter: service_description = testsvc_2\n\n", now-86400))
+	if err = assertEq(5, len(res.RawResults.DataResult)); err != nil {
+		t.Error(err)
+	}
+
+	// entries added out of order are sorted by time
+	idx := newLogSegmentIndex()
+	idx.add([]logIndexEntry{{time: 30, host: "host1", service: "svc1"}, {time: 40, host: "host2"}})
+	idx.add([]logIndexEntry{{time: 10, host: "host1", service: "svc2"}, {time: 20, host: "host1", service: "svc1"}})
+	entries := idx.find(&logCacheCondition{from: 15, to: 50, host: "host1"})
+	if err = assertEq(2, len(entries)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq([]int64{20, 30}, []int64{entries[0].time, entries[1].time}); err != nil {
+		t.Error(err)
+	}
+	entries = idx.find(&logCacheCondition{from: 0, to: 30, host: "host1", service: "svc1"})
+	if err = assertEq(1, len(entries)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(int64(20), entries[0].time); err != nil {
+		t.Error(err)
+	}
+	entries = idx.find(&logCacheCondition{from: 20, to: 41})
+	if err = assertEq(3, len(entries)); err != nil {
+		t.Error(err)
+	}
+
+	// time ranges outside the retention period are passed through
+	res = query(fmt.Sprintf("GET log\nColumns: time\nFilter: time >= %d\n\n", now-3*86400))
+	if err = assertEq(true, res.RawResults == nil); err != nil {
+		t.Error(err)
+	}
+
+	// entries written without saving the state afterwards are removed before the next sync
+	store.lock.Lock()
+	last := store.state.Last
+	segment := logSegmentName(last)
+	idx, err = store.segmentIndex(segment)
+	if err != nil {
+		store.lock.Unlock()
+		t.Fatal(err)
+	}
+	num := len(idx.entries)
+	uncommitted := make(ResultSet, 0)
+	for i := 0; i < 2; i++ {
+		row := make([]interface{}, len(rows[0]))
+		copy(row, rows[0])
+		row[logCacheColumnIndex(Objects.Tables[TableLog].GetColumn("time"))] = float64(last)
+		uncommitted = append(uncommitted, row)
+	}
+	err = store.append(uncommitted)
+	store.verify = true
+	store.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(num+2, len(idx.entries)); err != nil {
+		t.Error(err)
+	}
+	if err = store.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	store.lock.Lock()
+	idx, err = store.segmentIndex(segment)
+	store.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(num, len(idx.entries)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(false, store.verify); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
@@ -216,6 +216,10 @@ func mainLoop(mainSignalChannel chan os.Signal, initChannel chan bool) (exitCode
 
 	CompressionLevel = localConfig.CompressionLevel
 	CompressionMinimumSize = localConfig.CompressionMinimumSize
+	setCompressionCodec(localConfig.CompressionCodec, localConfig.CompressionDictionary)
+	stringContainerCache = NewStringContainerCache(localConfig.CompressionCacheSize)
+	ParallelFilterThreshold = localConfig.ParallelFilterThreshold
+	ParallelFilterWorkers = localConfig.ParallelFilterWorkers
 
 	// put some configuration settings into metrics
 	promPeerUpdateInterval.Set(float64(localConfig.Updateinterval))
@@ -258,6 +262,9 @@ func mainLoop(mainSignalChannel chan os.Signal, initChannel chan bool) (exitCode
 		qStat = NewQueryStats()
 	}
 
+	resultCache = NewResultCache(localConfig.ResultCacheSize)
+	logCache = NewLogCache(localConfig.LogCacheDir, localConfig.LogCacheRetention)
+
 	// start local listeners
 	initializeListeners(localConfig, waitGroupListener, waitGroupInit, qStat)
 
@@ -280,6 +287,30 @@ func mainLoop(mainSignalChannel chan os.Signal, initChannel chan bool) (exitCode
 		debug.SetGCPercent(GCPercentage)
 	}
 
+	// persist peer data periodically for warm restarts
+	var snapshotTimer <-chan time.Time
+	if localConfig.StateDir != "" {
+		ticker := time.NewTicker(time.Duration(localConfig.SnapshotInterval) * time.Second)
+		defer ticker.Stop()
+		snapshotTimer = ticker.C
+	}
+
+	// fetch new log entries periodically to keep the log cache up to date
+	var logCacheTimer <-chan time.Time
+	if logCache != nil {
+		ticker := time.NewTicker(LogCacheSyncInterval)
+		defer ticker.Stop()
+		logCacheTimer = ticker.C
+	}
+
+	// calculate the memory usage of all backends in the background
+	var memoryTimer <-chan time.Time
+	if localConfig.MemoryStatisticsInterval > 0 {
+		ticker := time.NewTicker(time.Duration(localConfig.MemoryStatisticsInterval) * time.Second)
+		defer ticker.Stop()
+		memoryTimer = ticker.C
+	}
+
 	// just wait till someone hits ctrl+c or we have to reload
 	statsTimer := time.NewTicker(StatsTimerInterval)
 	for {
@@ -292,6 +323,12 @@ func mainLoop(mainSignalChannel chan os.Signal, initChannel chan bool) (exitCode
 			return mainSignalHandler(sig, shutdownChannel, waitGroupPeers, waitGroupListener, prometheusListener, qStat)
 		case <-statsTimer.C:
 			updateStatistics(qStat)
+		case <-snapshotTimer:
+			go writeSnapshots(localConfig.StateDir)
+		case <-logCacheTimer:
+			go logCache.SyncAll()
+		case <-memoryTimer:
+			go updateMemoryStatistics()
 		}
 	}
 }
@@ -432,7 +469,7 @@ func initializePeers(localConfig *Config, waitGroupPeers *sync.WaitGroup, waitGr
 				p.Lock.Lock()
 				p.waitGroup = waitGroupPeers
 				p.shutdownChannel = shutdownChannel
-				p.GlobalConfig = localConfig
+				p.GlobalConfig = localConfig.ForConnection(&c)
 				p.SetHTTPClient()
 				p.Lock.Unlock()
 			}
@@ -442,6 +479,16 @@ func initializePeers(localConfig *Config, waitGroupPeers *sync.WaitGroup, waitGr
 		// Create new peer otherwise
 		if p == nil {
 			p = NewPeer(localConfig, &c, waitGroupPeers, shutdownChannel)
+
+			// serve data from last snapshot until the initial synchronization is done
+			if localConfig.StateDir != "" {
+				if _, err := restoreSnapshot(p, localConfig.StateDir); err != nil {
+					logWith(p).Warnf("failed to restore snapshot: %s", err.Error())
+				}
+				if err := restoreStateChanges(p, localConfig.StateDir); err != nil {
+					logWith(p).Warnf("failed to restore state changes: %s", err.Error())
+				}
+			}
 		}
 
 		// Check for duplicate id
@@ -468,6 +515,8 @@ func initializePeers(localConfig *Config, waitGroupPeers *sync.WaitGroup, waitGr
 	nodeAccessor = NewNodes(localConfig, nodeAddresses, nodeListenAddress, waitGroupInit, shutdownChannel)
 	nodeAccessor.Initialize() // starts peers in single mode
 	nodeAccessor.Start()      // nodes loop starts/stops peers in cluster mode
+
+	backendManager = NewBackendManager(localConfig, waitGroupPeers, shutdownChannel)
 }
 
 func checkFlags() {
@@ -804,6 +853,9 @@ func PeerMapRemove(peerID string) {
 			break
 		}
 	}
+	if p, ok := PeerMap[peerID]; ok {
+		p.deleteMemoryUsage()
+	}
 	delete(PeerMap, peerID)
 }
 
@@ -355,3 +355,65 @@ func TestMainWaitTimeout(t *testing.T) {
 		t.Errorf("timeout too small: %s", duration)
 	}
 }
+
+func TestMainConfigConnectionOverrides(t *testing.T) {
+	testConfig := `
+Updateinterval = 7
+SyncIsExecuting = true
+
+[[Connections]]
+name = "default"
+id = "id1"
+source = ["test1.sock"]
+
+[[Connections]]
+name = "override"
+id = "id2"
+source = ["test2.sock"]
+UpdateInterval = 30
+SyncIsExecuting = false
+NetTimeout = -1
+`
+	err := ioutil.WriteFile("test1.ini", []byte(testConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("test1.ini")
+
+	conf := NewConfig([]string{"test1.ini"})
+	conf.ValidateConfig()
+	if err = assertEq(2, len(conf.Connections)); err != nil {
+		t.Fatal(err)
+	}
+
+	// connections without overrides share the global config
+	if conf.ForConnection(&conf.Connections[0]) != conf {
+		t.Error("expected global config for connection without overrides")
+	}
+
+	effective := conf.ForConnection(&conf.Connections[1])
+	if err = assertEq(int64(30), effective.Updateinterval); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(false, effective.SyncIsExecuting); err != nil {
+		t.Error(err)
+	}
+	// invalid overrides fall back to the global value
+	if err = assertEq(conf.NetTimeout, effective.NetTimeout); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(int64(7), conf.Updateinterval); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(true, conf.SyncIsExecuting); err != nil {
+		t.Error(err)
+	}
+
+	// changed overrides require a new peer on reload
+	other := conf.Connections[1]
+	interval := int64(60)
+	other.Updateinterval = &interval
+	if err = assertEq(false, conf.Connections[1].Equals(&other)); err != nil {
+		t.Error(err)
+	}
+}
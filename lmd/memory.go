@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+)
+
+// memoryStatisticsRunning is set while the memory usage is calculated to prevent overlapping runs
+var memoryStatisticsRunning int32
+
+// MemoryUsage contains the approximate memory usage of a DataStore.
+type MemoryUsage struct {
+	Rows            int64 `json:"rows"`
+	StringBytes     int64 `json:"string_bytes"`     // size of all strings, shared strings are counted once
+	CompressedBytes int64 `json:"compressed_bytes"` // size of compressed large strings
+	DedupSavings    int64 `json:"dedup_savings"`    // bytes saved by sharing identical strings
+	TotalBytes      int64 `json:"total_bytes"`      // strings, compressed data and row overhead
+}
+
+// Add adds the usage of another store.
+func (m *MemoryUsage) Add(o *MemoryUsage) {
+	m.Rows += o.Rows
+	m.StringBytes += o.StringBytes
+	m.CompressedBytes += o.CompressedBytes
+	m.DedupSavings += o.DedupSavings
+	m.TotalBytes += o.TotalBytes
+}
+
+const (
+	sizeDataRow         = int64(unsafe.Sizeof(DataRow{}))
+	sizeString          = int64(unsafe.Sizeof(""))
+	sizeSlice           = int64(unsafe.Sizeof([]string{}))
+	sizeWord            = int64(unsafe.Sizeof(int(0)))
+	sizeStringContainer = int64(unsafe.Sizeof(StringContainer{}))
+	sizeServiceMember   = int64(unsafe.Sizeof(ServiceMember{}))
+	sizeMapEntry        = 2 * sizeWord // rough size of a map entry pointing to a row
+)
+
+// memoryStringCounter counts string bytes and detects strings sharing the same memory
+type memoryStringCounter struct {
+	usage *MemoryUsage
+	seen  map[uintptr]bool
+}
+
+func (c *memoryStringCounter) add(s string) {
+	if s == "" {
+		return
+	}
+	ptr := (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+	if c.seen[ptr] {
+		c.usage.DedupSavings += int64(len(s))
+		return
+	}
+	c.seen[ptr] = true
+	c.usage.StringBytes += int64(len(s))
+}
+
+// MemoryUsage returns the approximate memory usage of this store.
+// The caller has to hold the read lock of the DataStoreSet.
+func (d *DataStore) MemoryUsage() *MemoryUsage {
+	usage := &MemoryUsage{Rows: int64(len(d.Data))}
+	counter := &memoryStringCounter{usage: usage, seen: make(map[uintptr]bool)}
+	seenLists := make(map[*string]bool)
+	overhead := int64(0)
+	for _, row := range d.Data {
+		overhead += sizeDataRow
+		overhead += int64(len(row.dataString)) * sizeString
+		for _, s := range row.dataString {
+			counter.add(s)
+		}
+		overhead += int64(len(row.dataInt)+len(row.dataInt64)+len(row.dataFloat)) * sizeWord
+		overhead += int64(len(row.dataStringList)) * sizeSlice
+		for _, list := range row.dataStringList {
+			if len(list) == 0 {
+				continue
+			}
+			// static lists are deduplicated per store
+			if seenLists[&list[0]] {
+				for _, s := range list {
+					usage.DedupSavings += sizeString + int64(len(s))
+				}
+				continue
+			}
+			seenLists[&list[0]] = true
+			overhead += int64(len(list)) * sizeString
+			for _, s := range list {
+				counter.add(s)
+			}
+		}
+		overhead += int64(len(row.dataInt64List)) * sizeSlice
+		for _, list := range row.dataInt64List {
+			overhead += int64(len(list)) * sizeWord
+		}
+		overhead += int64(len(row.dataServiceMemberList)) * sizeSlice
+		for _, list := range row.dataServiceMemberList {
+			overhead += int64(len(list)) * sizeServiceMember
+			for i := range list {
+				counter.add(list[i][0])
+				counter.add(list[i][1])
+			}
+		}
+		overhead += int64(len(row.dataStringLarge)) * sizeStringContainer
+		for i := range row.dataStringLarge {
+			counter.add(row.dataStringLarge[i].StringData)
+			usage.CompressedBytes += int64(len(row.dataStringLarge[i].CompressedData))
+		}
+		overhead += int64(len(row.dataInterfaceList)) * sizeSlice
+		overhead += int64(len(row.Refs)) * sizeMapEntry
+	}
+	overhead += int64(len(d.Data)) * sizeWord
+	overhead += int64(len(d.Index)) * sizeMapEntry
+	for _, services := range d.Index2 {
+		overhead += int64(len(services)) * sizeMapEntry
+	}
+	usage.TotalBytes = usage.StringBytes + usage.CompressedBytes + overhead
+	return usage
+}
+
+// updateMemoryUsage calculates the memory usage of all tables of this peer and
+// stores the result in the peer status and the prometheus metrics.
+func (p *Peer) updateMemoryUsage() {
+	total := &MemoryUsage{}
+	tables := make(map[string]*MemoryUsage)
+	ds, err := p.GetDataStoreSet()
+	if err == nil {
+		// lock each table separately, so updates are not blocked for the whole calculation
+		for name := range Objects.Tables {
+			ds.Lock.RLock()
+			store, ok := ds.tables[name]
+			if !ok {
+				ds.Lock.RUnlock()
+				continue
+			}
+			usage := store.MemoryUsage()
+			ds.Lock.RUnlock()
+			tables[name.String()] = usage
+			total.Add(usage)
+		}
+	}
+	// metrics of removed peers must not be created again
+	PeerMapLock.RLock()
+	if PeerMap[p.ID] == p {
+		for name, usage := range tables {
+			promPeerMemoryRows.WithLabelValues(p.Name, name).Set(float64(usage.Rows))
+			promPeerMemoryStringBytes.WithLabelValues(p.Name, name).Set(float64(usage.StringBytes))
+			promPeerMemoryCompressedBytes.WithLabelValues(p.Name, name).Set(float64(usage.CompressedBytes))
+			promPeerMemoryDedupSavings.WithLabelValues(p.Name, name).Set(float64(usage.DedupSavings))
+			promPeerMemoryTotalBytes.WithLabelValues(p.Name, name).Set(float64(usage.TotalBytes))
+		}
+	}
+	PeerMapLock.RUnlock()
+	tablesJSON, err := json.Marshal(tables)
+	if err != nil {
+		logWith(p).Debugf("failed to encode memory usage: %s", err.Error())
+		tablesJSON = []byte("{}")
+	}
+
+	p.Lock.Lock()
+	p.Status[MemoryRows] = total.Rows
+	p.Status[MemoryStringBytes] = total.StringBytes
+	p.Status[MemoryCompressedBytes] = total.CompressedBytes
+	p.Status[MemoryDedupSavings] = total.DedupSavings
+	p.Status[MemoryTotalBytes] = total.TotalBytes
+	p.Status[MemoryTables] = string(tablesJSON)
+	p.Lock.Unlock()
+}
+
+// deleteMemoryUsage removes the prometheus metrics of this peer, the caller must hold the PeerMapLock.
+func (p *Peer) deleteMemoryUsage() {
+	for name := range Objects.Tables {
+		promPeerMemoryRows.DeleteLabelValues(p.Name, name.String())
+		promPeerMemoryStringBytes.DeleteLabelValues(p.Name, name.String())
+		promPeerMemoryCompressedBytes.DeleteLabelValues(p.Name, name.String())
+		promPeerMemoryDedupSavings.DeleteLabelValues(p.Name, name.String())
+		promPeerMemoryTotalBytes.DeleteLabelValues(p.Name, name.String())
+	}
+}
+
+// updateMemoryStatistics updates the memory usage of all peers. It is run in the background
+// every MemoryStatisticsInterval seconds, since it has to walk through all rows of all tables.
+func updateMemoryStatistics() {
+	if !atomic.CompareAndSwapInt32(&memoryStatisticsRunning, 0, 1) {
+		log.Debugf("skipping memory statistics, previous run is still running")
+		return
+	}
+	defer atomic.StoreInt32(&memoryStatisticsRunning, 0)
+
+	PeerMapLock.RLock()
+	peers := make([]*Peer, 0, len(PeerMap))
+	for _, id := range PeerMapOrder {
+		peers = append(peers, PeerMap[id])
+	}
+	PeerMapLock.RUnlock()
+	for _, p := range peers {
+		p.updateMemoryUsage()
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	PeerMapLock.RLock()
+	p := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+
+	ds, err := p.GetDataStoreSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := ds.Get(TableHosts)
+	ds.Lock.RLock()
+	usage := hosts.MemoryUsage()
+	ds.Lock.RUnlock()
+	if err = assertEq(int64(10), usage.Rows); err != nil {
+		t.Error(err)
+	}
+	if usage.StringBytes <= 0 || usage.TotalBytes <= usage.StringBytes {
+		t.Errorf("unexpected memory usage: %#v", usage)
+	}
+
+	updateMemoryStatistics()
+
+	res, _, err := peer.QueryString("GET backends\nColumns: mem_rows mem_total mem_tables\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	rows := interface2int64(res[0][0])
+	if rows <= usage.Rows {
+		t.Errorf("expected more rows than the hosts table, got %d", rows)
+	}
+	if interface2int64(res[0][1]) < usage.TotalBytes {
+		t.Errorf("expected total memory to include the hosts table, got %v", res[0][1])
+	}
+
+	tables := map[string]*MemoryUsage{}
+	raw, err := json.Marshal(res[0][2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(raw, &tables); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(usage, tables["hosts"]); err != nil {
+		t.Error(err)
+	}
+
+	// metrics are removed along with the peer
+	PeerMapLock.Lock()
+	p.deleteMemoryUsage()
+	PeerMapLock.Unlock()
+	if err = assertEq(false, promPeerMemoryRows.DeleteLabelValues(p.Name, "hosts")); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/sasha-s/go-deadlock"
 )
 
 var reNodeAddress = regexp.MustCompile(`^(https?)?(://)?(.*?)(:(\d+))?(/.*)?$`)
@@ -26,6 +28,7 @@ type Nodes struct {
 	ShutdownChannel  chan bool
 	loopInterval     int
 	heartbeatTimeout int
+	lock             *deadlock.RWMutex // protects backends and assignedBackends
 	backends         []string
 	thisNode         *NodeAddress
 	nodeAddresses    NodeAddressList
@@ -74,6 +77,7 @@ func NewNodes(localConfig *Config, addresses []string, listen string, waitGroupI
 		ShutdownChannel: shutdownChannel,
 		stopChannel:     make(chan bool),
 		nodeBackends:    make(map[string][]string),
+		lock:            new(deadlock.RWMutex),
 	}
 	tlsConfig := getMinimalTLSConfig(localConfig)
 	n.HTTPClient = NewLMDHTTPClient(tlsConfig, "")
@@ -282,7 +286,10 @@ func (n *Nodes) checkNodeAvailability() {
 // It starts peers assigned to this node and stops other peers.
 func (n *Nodes) redistribute() {
 	// Nodes and backends
-	numberBackends := len(n.backends)
+	n.lock.RLock()
+	backends := n.backends
+	n.lock.RUnlock()
+	numberBackends := len(backends)
 	ownIndex, nodeOnline, numberAllNodes, numberAvailableNodes := n.getOnlineNodes()
 	allNodes := n.nodeAddresses
 	log.Infof("redistributing peers within cluster, %d/%d nodes online", numberAvailableNodes, numberAllNodes)
@@ -320,9 +327,9 @@ func (n *Nodes) redistribute() {
 		}
 		list := make([]string, 0)
 		for j := 0; j < number; j++ {
-			if len(n.backends) > distributedCount+j {
-				if n.backends[distributedCount+j] != "" {
-					list = append(list, n.backends[distributedCount+j])
+			if len(backends) > distributedCount+j {
+				if backends[distributedCount+j] != "" {
+					list = append(list, backends[distributedCount+j])
 				}
 			}
 		}
@@ -357,6 +364,7 @@ func (n *Nodes) updateBackends(ourBackends []string) {
 	// Determine backends this node is now (not anymore) responsible for
 	var addBackends []string
 	var rmvBackends []string
+	n.lock.Lock()
 	for _, backend := range n.backends {
 		// Check if assigned now
 		assignedNow := false
@@ -384,6 +392,7 @@ func (n *Nodes) updateBackends(ourBackends []string) {
 
 	// Store assigned backends
 	n.assignedBackends = ourBackends
+	n.lock.Unlock()
 
 	// Start/stop backends
 	PeerMapLock.RLock()
@@ -428,8 +437,9 @@ func (n *Nodes) IsOurBackend(backend string) bool {
 	if !nodeAccessor.IsClustered() {
 		return true
 	}
-	ourBackends := n.assignedBackends
-	for _, ourBackend := range ourBackends {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	for _, ourBackend := range n.assignedBackends {
 		if ourBackend == backend {
 			return true
 		}
@@ -437,6 +447,37 @@ func (n *Nodes) IsOurBackend(backend string) bool {
 	return false
 }
 
+// AssignedBackends returns the ids of all backends managed by this node.
+func (n *Nodes) AssignedBackends() []string {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return append([]string{}, n.assignedBackends...)
+}
+
+// AssignBackend adds a sub peer to the backends managed by this node.
+func (n *Nodes) AssignBackend(id string) {
+	n.lock.Lock()
+	n.assignedBackends = append(n.assignedBackends, id)
+	n.lock.Unlock()
+}
+
+// AddBackend adds a backend which has been added at runtime.
+// Backends cannot be changed at runtime in cluster mode, so it is assigned to this node.
+func (n *Nodes) AddBackend(id string) {
+	n.lock.Lock()
+	n.backends = append(n.backends, id)
+	n.assignedBackends = append(n.assignedBackends, id)
+	n.lock.Unlock()
+}
+
+// RemoveBackend removes a backend which has been removed at runtime.
+func (n *Nodes) RemoveBackend(id string) {
+	n.lock.Lock()
+	n.backends = removeFromList(n.backends, id)
+	n.assignedBackends = removeFromList(n.assignedBackends, id)
+	n.lock.Unlock()
+}
+
 // SendQuery sends a query to a node.
 // It will be sent as http request; name is the api function to be called.
 // The returned data will be passed to the callback.
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"testing"
 )
 
@@ -71,6 +76,42 @@ func TestNodeManager(t *testing.T) {
 		t.Error(err)
 	}
 
+	// test service percentile stats request
+	res, _, err = peer.QueryString("GET services\nStats: percentile90 current_attempt\nStats: median current_attempt\nStats: stddev current_attempt\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(3), res[0][0]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(1), res[0][1]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("0.8000", fmt.Sprintf("%.4f", res[0][2])); err != nil {
+		t.Error(err)
+	}
+
+	// test service count distinct stats request
+	res, _, err = peer.QueryString("GET services\nFilter: state = 1\nStats: count_distinct host_name\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(2), res[0][0]); err != nil {
+		t.Error(err)
+	}
+
+	// test service top n grouped stats request
+	res, _, err = peer.QueryString("GET services\nColumns: host_name\nStats: state = 1\nStats: sum execution_time\nStatsHaving: 1 >= 1\nSort: stats_2 desc\nLimit: 1\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("testhost_2", res[0][0]); err != nil {
+		t.Error(err)
+	}
+
 	// test host empty stats request
 	res, _, err = peer.QueryString("GET hosts\nFilter: check_type = 15\nStats: sum percent_state_change\nStats: min percent_state_change\n\n")
 	if err != nil {
@@ -83,6 +124,36 @@ func TestNodeManager(t *testing.T) {
 		t.Error(err)
 	}
 
+	// test explain request
+	req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString("GET hosts\nColumns: name\nExplain: on\n\n")), ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = req.ExpandRequestedBackends(); err != nil {
+		t.Fatal(err)
+	}
+	response, err := req.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := response.Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := make(map[string]interface{})
+	if err = json.Unmarshal(buf.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("distributed", plan["mode"]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(4, len(plan["peers"].([]interface{}))); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(40), plan["total_count"]); err != nil {
+		t.Error(err)
+	}
+
 	if err := StopTestPeer(peer); err != nil {
 		panic(err.Error())
 	}
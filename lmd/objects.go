@@ -56,6 +56,7 @@ func InitObjects() {
 	Objects.AddTable(TableHostsbygroup, NewHostsByGroupTable())
 	Objects.AddTable(TableServicesbygroup, NewServicesByGroupTable())
 	Objects.AddTable(TableServicesbyhostgroup, NewServicesByHostgroupTable())
+	Objects.AddTable(TableStatechanges, NewStatechangesTable())
 }
 
 // AddTable appends a table object to the Objects and verifies that no table is added twice.
@@ -93,6 +94,7 @@ func NewBackendsTable() (t *Table) {
 	t.AddPeerInfoColumn("last_online", Int64Col, "Timestamp when peer was last online")
 	t.AddPeerInfoColumn("response_time", FloatCol, "Duration of last update in seconds")
 	t.AddPeerInfoColumn("idling", IntCol, "Idle status of this backend (0 - Not idling, 1 - idling)")
+	t.AddPeerInfoColumn("paused", IntCol, "Paused status of this backend (0 - Not paused, 1 - paused)")
 	t.AddPeerInfoColumn("last_query", Int64Col, "Timestamp of the last incoming request")
 	t.AddPeerInfoColumn("section", StringCol, "Section information when having cascaded LMDs")
 	t.AddPeerInfoColumn("parent", StringCol, "Parent id when having cascaded LMDs")
@@ -103,6 +105,24 @@ func NewBackendsTable() (t *Table) {
 	t.AddPeerInfoColumn("federation_name", StringListCol, "original names when using nested federation")
 	t.AddPeerInfoColumn("federation_addr", StringListCol, "original addresses when using nested federation")
 	t.AddPeerInfoColumn("federation_type", StringListCol, "original types when using nested federation")
+	t.AddPeerInfoColumn("mem_rows", Int64Col, "Number of cached rows of this peer")
+	t.AddPeerInfoColumn("mem_string_bytes", Int64Col, "Approximate bytes used by cached strings")
+	t.AddPeerInfoColumn("mem_compressed_bytes", Int64Col, "Approximate bytes used by compressed large strings")
+	t.AddPeerInfoColumn("mem_dedup_savings", Int64Col, "Approximate bytes saved by string deduplication")
+	t.AddPeerInfoColumn("mem_total", Int64Col, "Approximate total bytes used by the cache of this peer")
+	t.AddPeerInfoColumn("mem_tables", JSONCol, "Approximate memory usage for each table of this peer")
+	t.AddPeerInfoColumn("circuit_state", IntCol, "Circuit breaker state (0 - closed, 1 - open, 2 - half-open)")
+	t.AddPeerInfoColumn("circuit_opens", IntCol, "Number of consecutive circuit breaker openings")
+	t.AddPeerInfoColumn("circuit_retry", Int64Col, "Timestamp of the next connection attempt while the circuit breaker is open")
+	t.AddPeerInfoColumn("sources", JSONCol, "Health status, latency and errors of each source of this peer")
+	t.AddPeerInfoColumn("update_interval", Int64Col, "Effective update interval in seconds")
+	t.AddPeerInfoColumn("full_update_interval", Int64Col, "Effective full update interval in seconds")
+	t.AddPeerInfoColumn("idle_timeout", Int64Col, "Effective idle timeout in seconds")
+	t.AddPeerInfoColumn("idle_interval", Int64Col, "Effective update interval in seconds while idling")
+	t.AddPeerInfoColumn("net_timeout", IntCol, "Effective network timeout in seconds")
+	t.AddPeerInfoColumn("connect_timeout", IntCol, "Effective connect timeout in seconds")
+	t.AddPeerInfoColumn("sync_is_executing", IntCol, "Effective sync is executing setting (0 - disabled, 1 - enabled)")
+	t.AddPeerInfoColumn("max_parallel_connections", IntCol, "Effective maximum number of parallel connections for cascaded LMDs")
 	t.AddExtraColumn("localtime", VirtualStore, None, FloatCol, NoFlags, "The unix timestamp of the local lmd host.")
 	return
 }
@@ -698,3 +718,22 @@ func NewServicesByHostgroupTable() (t *Table) {
 	t.AddPeerInfoColumn("peer_name", StringCol, "Name of this peer")
 	return
 }
+
+// NewStatechangesTable returns a new statechanges table
+func NewStatechangesTable() (t *Table) {
+	t = &Table{Virtual: GetStatechangesStore, DefaultSort: []string{"time"}}
+	t.AddColumn("time", Static, Int64Col, "Time of the state change (UNIX timestamp)")
+	t.AddColumn("host_name", Static, StringCol, "Host name")
+	t.AddColumn("service_description", Static, StringCol, "Service description (empty for hosts)")
+	t.AddColumn("old_state", Static, IntCol, "The state before the change")
+	t.AddColumn("state", Static, IntCol, "The state after the change")
+	t.AddColumn("old_state_type", Static, IntCol, "The state type before the change (0: soft, 1: hard)")
+	t.AddColumn("state_type", Static, IntCol, "The state type after the change (0: soft, 1: hard)")
+	t.AddColumn("old_acknowledged", Static, IntCol, "Whether the problem has been acknowledged before the change (0/1)")
+	t.AddColumn("acknowledged", Static, IntCol, "Whether the problem has been acknowledged after the change (0/1)")
+	t.AddColumn("plugin_output", Static, StringCol, "Output of the check after the change")
+
+	t.AddPeerInfoColumn("peer_key", StringCol, "Id of this peer")
+	t.AddPeerInfoColumn("peer_name", StringCol, "Name of this peer")
+	return
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// DefaultParallelFilterThreshold sets the default minimum number of rows before a store is filtered in parallel
+const DefaultParallelFilterThreshold = 50000
+
+// ParallelFilterThreshold sets the minimum number of rows to filter a single store in parallel, 0 disables parallel filtering
+var ParallelFilterThreshold = DefaultParallelFilterThreshold
+
+// ParallelFilterWorkers sets the number of chunks a large store is split into, 0 uses the number of cpus
+var ParallelFilterWorkers = 0
+
+// splitRows splits the rows into chunks which can be filtered in parallel. It returns a single chunk
+// if the rows are below the ParallelFilterThreshold or the store is virtual.
+func splitRows(store *DataStore, rows []*DataRow) [][]*DataRow {
+	workers := ParallelFilterWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if ParallelFilterThreshold <= 0 || len(rows) < ParallelFilterThreshold || workers < 2 || store.Table.Virtual != nil || store.Peer == nil {
+		return [][]*DataRow{rows}
+	}
+	size := (len(rows) + workers - 1) / workers
+	chunks := make([][]*DataRow, 0, workers)
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunks = append(chunks, rows[start:end])
+	}
+	return chunks
+}
+
+// processChunks calls fn for each chunk in a separate goroutine and waits till all chunks are done.
+func processChunks(store *DataStore, chunks [][]*DataRow, fn func(num int, rows []*DataRow)) {
+	waitgroup := &sync.WaitGroup{}
+	for i := range chunks {
+		waitgroup.Add(1)
+		go func(num int, peer *Peer, wg *sync.WaitGroup) {
+			// make sure we log panics properly
+			defer logPanicExitPeer(peer)
+
+			defer wg.Done()
+
+			fn(num, chunks[num])
+		}(i, store.Peer, waitgroup)
+	}
+	waitgroup.Wait()
+}
+
+// mergeChunkRows merges the filtered rows of all chunks into result. The rows are appended in
+// chunk order, so the order of the store is kept and the limit cuts off the same rows as a serial scan.
+func mergeChunkRows(result *PeerResponse, chunkResults []*PeerResponse, limit int) {
+	for _, chunk := range chunkResults {
+		result.Total += chunk.Total
+		result.RowsScanned += chunk.RowsScanned
+		if missing := limit - len(result.Rows); missing > 0 {
+			if len(chunk.Rows) > missing {
+				result.Rows = append(result.Rows, chunk.Rows[:missing]...)
+			} else {
+				result.Rows = append(result.Rows, chunk.Rows...)
+			}
+		}
+	}
+}
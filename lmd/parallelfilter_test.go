@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParallelFilter(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	defer func(threshold, workers int) {
+		ParallelFilterThreshold = threshold
+		ParallelFilterWorkers = workers
+	}(ParallelFilterThreshold, ParallelFilterWorkers)
+
+	queries := []string{
+		"GET services\nColumns: host_name description state\nSort: host_name asc\nSort: description asc\n\n",
+		"GET services\nColumns: host_name description\nFilter: state = 0\nLimit: 7\nOutputFormat: wrapped_json\nColumnHeaders: on\n\n",
+		"GET hosts\nColumns: name\nLimit: 3\n\n",
+		"GET services\nColumns: host_name\nStats: state = 0\nStats: avg latency\nStats: min latency\nStats: max latency\nStats: median latency\n\n",
+		"GET services\nStats: sum latency\nStats: state != 0\n\n",
+	}
+	for _, query := range queries {
+		ParallelFilterThreshold = 0
+		expect, expectMeta, err := peer.QueryString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ParallelFilterThreshold = 1
+		ParallelFilterWorkers = 3
+		res, meta, err := peer.QueryString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = assertEq(expect, res); err != nil {
+			t.Errorf("parallel result differs for query %q: %s", query, err)
+		}
+		if err = assertEq(expectMeta.Total, meta.Total); err != nil {
+			t.Errorf("parallel total differs for query %q: %s", query, err)
+		}
+	}
+
+	ParallelFilterWorkers = 4
+	PeerMapLock.RLock()
+	p := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+	store, err := p.GetDataStore(TableServices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := splitRows(store, store.Data)
+	if err = assertEq(4, len(chunks)); err != nil {
+		t.Error(err)
+	}
+	num := 0
+	for _, chunk := range chunks {
+		num += len(chunk)
+	}
+	if err = assertEq(len(store.Data), num); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
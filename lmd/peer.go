@@ -58,6 +58,7 @@ const (
 // Peer is the object which handles collecting and updating data and connections.
 type Peer struct {
 	noCopy          noCopy
+	revision        int64                         // incremented on each data update, used to invalidate cached results
 	Name            string                        // Name of this peer, aka peer_name
 	ID              string                        // ID for this peer, aka peer_key
 	ParentID        string                        // ID of parent Peer
@@ -73,6 +74,7 @@ type Peer struct {
 	stopChannel     chan bool                     // channel to stop this peer
 	Config          *Connection                   // reference to the peer configuration from the config file
 	GlobalConfig    *Config                       // reference to global config object
+	stateChanges    *StateChangeHistory           // latest state changes of hosts and services
 	last            struct {
 		Request  *Request // reference to last query (used in error reports)
 		Response []byte   // reference to last response
@@ -81,6 +83,8 @@ type Peer struct {
 		HTTPClient *http.Client  // cached http client for http backends
 		connection chan net.Conn // tcp connection get stored here for reuse
 	}
+	icinga2Events *Icinga2APIEvents // event stream of icinga2 api backends
+	balancer      *SourceBalancer   // health of all sources, selects the source for load balanced peers
 }
 
 // PeerStatus contains the different states a peer can have
@@ -128,6 +132,9 @@ const (
 
 	// RestartRequiredError is used when the remote site needs to be reinitialized
 	RestartRequiredError
+
+	// CircuitOpenError is used when a request fails fast because the circuit breaker is open
+	CircuitOpenError
 )
 
 // PeerStatusKey contains the different keys for the Peer.Status map
@@ -167,6 +174,16 @@ const (
 	SubPeerStatus
 	ConfigTool
 	ForceFull
+	SnapshotData
+	MemoryRows
+	MemoryStringBytes
+	MemoryCompressedBytes
+	MemoryDedupSavings
+	MemoryTotalBytes
+	MemoryTables
+	CircuitBreakerState
+	CircuitBreakerOpens
+	CircuitBreakerRetry
 )
 
 // PeerConnType contains the different connection types
@@ -180,6 +197,7 @@ const (
 	ConnTypeUnix
 	ConnTypeTLS
 	ConnTypeHTTP
+	ConnTypeIcinga2API
 )
 
 // HTTPResult contains the livestatus result as long with some meta data.
@@ -246,13 +264,15 @@ func NewPeer(globalConfig *Config, config *Connection, waitGroup *sync.WaitGroup
 		stopChannel:     make(chan bool),
 		Lock:            new(deadlock.RWMutex),
 		Config:          config,
-		GlobalConfig:    globalConfig,
+		GlobalConfig:    globalConfig.ForConnection(config),
 		Flags:           uint32(NoFlags),
+		stateChanges:    NewStateChangeHistory(globalConfig.StateChangeHistorySize),
 	}
 	p.cache.connection = make(chan net.Conn, ConnectionPoolCacheSize)
 	if len(p.Source) == 0 {
 		logWith(&p).Fatalf("peer requires at least one source")
 	}
+	p.balancer = NewSourceBalancer(p.Source)
 	p.Status[PeerKey] = p.ID
 	p.Status[PeerName] = p.Name
 	p.Status[CurPeerAddrNum] = 0
@@ -267,6 +287,7 @@ func NewPeer(globalConfig *Config, config *Connection, waitGroup *sync.WaitGroup
 	p.Status[LastOnline] = int64(0)
 	p.Status[LastTimeperiodUpdateMinute] = 0
 	p.Status[ForceFull] = false
+	p.Status[SnapshotData] = false
 	p.Status[ProgramStart] = int64(0)
 	p.Status[LastPid] = 0
 	p.Status[BytesSend] = int64(0)
@@ -282,6 +303,15 @@ func NewPeer(globalConfig *Config, config *Connection, waitGroup *sync.WaitGroup
 	p.Status[SubName] = []string{}
 	p.Status[SubAddr] = []string{}
 	p.Status[SubType] = []string{}
+	p.Status[MemoryRows] = int64(0)
+	p.Status[MemoryStringBytes] = int64(0)
+	p.Status[MemoryCompressedBytes] = int64(0)
+	p.Status[MemoryDedupSavings] = int64(0)
+	p.Status[MemoryTotalBytes] = int64(0)
+	p.Status[MemoryTables] = "{}"
+	p.Status[CircuitBreakerState] = CircuitClosed
+	p.Status[CircuitBreakerOpens] = 0
+	p.Status[CircuitBreakerRetry] = int64(0)
 
 	/* initialize http client if there are any http(s) connections */
 	p.SetHTTPClient()
@@ -321,7 +351,7 @@ func (p *Peer) Stop() {
 func (p *Peer) SetHTTPClient() {
 	hasHTTP := false
 	for _, addr := range p.Source {
-		if strings.HasPrefix(addr, "http") {
+		if _, connType := extractConnType(addr); connType == ConnTypeHTTP || connType == ConnTypeIcinga2API {
 			hasHTTP = true
 			break
 		}
@@ -361,6 +391,7 @@ func (p *Peer) updateLoop() {
 	shutdownStop := func(peer *Peer, ticker *time.Ticker) {
 		logWith(peer).Debugf("stopping...")
 		ticker.Stop()
+		peer.stopIcinga2APIEvents()
 		peer.clearLastRequest()
 	}
 
@@ -377,6 +408,8 @@ func (p *Peer) updateLoop() {
 			return
 		case <-ticker.C:
 			switch {
+			case !p.circuitAllowUpdate(t1.Unix()):
+				// do not retry failing peers before the circuit breaker backoff passed
 			case p.HasFlag(MultiBackend):
 				err = p.periodicUpdateMultiBackends(nil, false)
 			default:
@@ -407,6 +440,7 @@ func (p *Peer) periodicUpdate() (err error) {
 	lastQuery := p.Status[LastQuery].(int64)
 	idling := p.Status[Idling].(bool)
 	forceFull := p.Status[ForceFull].(bool)
+	snapshotData := p.Status[SnapshotData].(bool)
 	data := p.data
 	p.Lock.RUnlock()
 
@@ -415,7 +449,7 @@ func (p *Peer) periodicUpdate() (err error) {
 	currentMinute, _ := strconv.Atoi(time.Now().Format("4"))
 
 	// update timeperiods every full minute except when idling
-	if !idling && lastTimeperiodUpdateMinute != currentMinute && data != nil {
+	if !idling && !snapshotData && lastTimeperiodUpdateMinute != currentMinute && data != nil {
 		p.StatusSet(LastTimeperiodUpdateMinute, currentMinute)
 		err = p.periodicTimeperiodsUpdate(data)
 		if err != nil {
@@ -437,6 +471,12 @@ func (p *Peer) periodicUpdate() (err error) {
 	// of the update interval
 	p.StatusSet(LastUpdate, now)
 
+	// data restored from a snapshot has to be replaced completely, a delta or
+	// full update would only refresh the dynamic columns
+	if snapshotData && lastStatus != PeerStatusBroken {
+		return p.InitAllTables()
+	}
+
 	switch lastStatus {
 	case PeerStatusBroken:
 		return p.handleBrokenPeer()
@@ -456,6 +496,11 @@ func (p *Peer) periodicUpdate() (err error) {
 		}
 		// full update interval
 		if !idling && p.GlobalConfig.FullUpdateInterval > 0 && now > lastFullUpdate+p.GlobalConfig.FullUpdateInterval {
+			p.selectUpdateSource()
+			return data.UpdateFull(Objects.UpdateTables)
+		}
+		// load balanced peers move their updates to the best source
+		if p.selectUpdateSource() {
 			return data.UpdateFull(Objects.UpdateTables)
 		}
 		if forceFull {
@@ -567,7 +612,7 @@ func (p *Peer) periodicUpdateLMD(data *DataStoreSet, force bool) (err error) {
 				subPeer.StatusSet(Section, section)
 			}
 
-			nodeAccessor.assignedBackends = append(nodeAccessor.assignedBackends, subID)
+			nodeAccessor.AssignBackend(subID)
 			if !p.StatusGet(Paused).(bool) {
 				subPeer.Start()
 			}
@@ -678,7 +723,7 @@ func (p *Peer) periodicUpdateMultiBackends(data *DataStoreSet, force bool) (err
 			subPeer.setFederationInfo(site, SubType, "type")
 			PeerMap[subID] = subPeer
 			PeerMapOrder = append(PeerMapOrder, c.ID)
-			nodeAccessor.assignedBackends = append(nodeAccessor.assignedBackends, subID)
+			nodeAccessor.AssignBackend(subID)
 			if !p.StatusGet(Paused).(bool) {
 				subPeer.Start()
 			}
@@ -817,6 +862,7 @@ func (p *Peer) InitAllTables() (err error) {
 	duration := time.Since(t1)
 	p.Lock.Lock()
 	p.SetDataStoreSet(data, false)
+	p.Status[SnapshotData] = false
 	p.Status[ResponseTime] = duration.Seconds()
 	peerStatus := p.Status[PeerState].(PeerStatus)
 	logWith(p).Infof("objects created in: %s", duration.String())
@@ -993,21 +1039,49 @@ func (p *Peer) resetErrors() {
 	p.ErrorCount = 0
 	p.ErrorLogged = false
 	p.Status[PeerState] = PeerStatusUp
+	p.circuitSuccess()
 }
 
-// query sends the request to a remote livestatus.
+// query sends the request to a remote livestatus using the current source.
 // It returns the unmarshaled result and any error encountered.
 func (p *Peer) query(req *Request) (ResultSet, *ResultMetaData, error) {
-	conn, connType, err := p.GetConnection()
+	return p.querySelectedSource(req, false)
+}
+
+// queryBalanced sends the request to the best source of load balanced peers and
+// to the current source otherwise. Only requests which do not update the local
+// data may be balanced, since the sources may differ slightly. Updates move to
+// another source by selectUpdateSource followed by a full update instead.
+func (p *Peer) queryBalanced(req *Request) (ResultSet, *ResultMetaData, error) {
+	return p.querySelectedSource(req, p.isLoadBalanced())
+}
+
+func (p *Peer) querySelectedSource(req *Request, balanced bool) (ResultSet, *ResultMetaData, error) {
+	if err := p.circuitError(); err != nil {
+		logWith(p, req).Debugf("%s", err)
+		return nil, nil, err
+	}
+	conn, connType, sourceNum, err := p.getSourceConnection(balanced)
 	if err != nil {
 		logWith(p, req).Debugf("connection failed: %s", err)
 		return nil, nil, err
 	}
-	if connType == ConnTypeHTTP {
+	t1 := time.Now()
+	p.balancer.Start(sourceNum)
+	res, meta, err := p.querySource(req, conn, connType, p.Source[sourceNum], balanced)
+	p.balancer.Done(sourceNum, true, time.Since(t1), err)
+	return res, meta, err
+}
+
+// querySource sends the request to the given source using the already opened connection.
+func (p *Peer) querySource(req *Request, conn net.Conn, connType PeerConnType, peerAddr string, balanced bool) (ResultSet, *ResultMetaData, error) {
+	var err error
+	if connType == ConnTypeHTTP || connType == ConnTypeIcinga2API || balanced {
+		// cached connections are not bound to a source, so they cannot be used with load balancing
 		req.KeepAlive = false
 	}
 	defer func() {
-		if req.KeepAlive && err != nil && connType != ConnTypeHTTP {
+		if req.KeepAlive && err != nil && connType != ConnTypeHTTP && connType != ConnTypeIcinga2API {
 			// give back connection
 			logWith(p, req).Tracef("put cached connection back")
 			p.cache.connection <- conn
@@ -1016,6 +1090,10 @@ func (p *Peer) query(req *Request) (ResultSet, *ResultMetaData, error) {
 		}
 	}()
 
+	if connType == ConnTypeIcinga2API {
+		return p.queryIcinga2API(req, peerAddr)
+	}
+
 	if p.HasFlag(LMDSub) {
 		// add backends filter for lmd sub peers
 		req.Backends = []string{p.ID}
@@ -1034,7 +1112,6 @@ func (p *Peer) query(req *Request) (ResultSet, *ResultMetaData, error) {
 	p.Status[Queries] = p.Status[Queries].(int64) + 1
 	totalBytesSend := p.Status[BytesSend].(int64) + int64(len(query))
 	p.Status[BytesSend] = totalBytesSend
-	peerAddr := p.Status[PeerAddr].(string)
 	p.Lock.Unlock()
 	promPeerBytesSend.WithLabelValues(p.Name).Set(float64(totalBytesSend))
 	promPeerQueries.WithLabelValues(p.Name).Inc()
@@ -1307,45 +1384,7 @@ func (p *Peer) GetConnection() (conn net.Conn, connType PeerConnType, err error)
 			}
 			conn.Close()
 		}
-		switch connType {
-		case ConnTypeTCP:
-			conn, err = net.DialTimeout("tcp", peerAddr, time.Duration(p.GlobalConfig.ConnectTimeout)*time.Second)
-		case ConnTypeUnix:
-			conn, err = net.DialTimeout("unix", peerAddr, time.Duration(p.GlobalConfig.ConnectTimeout)*time.Second)
-		case ConnTypeTLS:
-			tlsConfig, cErr := p.getTLSClientConfig()
-			if cErr != nil {
-				err = cErr
-			} else {
-				dialer := new(net.Dialer)
-				dialer.Timeout = time.Duration(p.GlobalConfig.ConnectTimeout) * time.Second
-				conn, err = tls.DialWithDialer(dialer, "tcp", peerAddr, tlsConfig)
-			}
-		case ConnTypeHTTP:
-			// test at least basic tcp connect
-			uri, uErr := url.Parse(peerAddr)
-			if uErr != nil {
-				err = uErr
-				return
-			}
-			host := uri.Host
-			if !strings.Contains(host, ":") {
-				switch uri.Scheme {
-				case "http":
-					host += ":80"
-				case "https":
-					host += ":443"
-				default:
-					err = &PeerError{msg: fmt.Sprintf("unknown scheme: %s", uri.Scheme), kind: ConnectionError}
-					return
-				}
-			}
-			conn, err = net.DialTimeout("tcp", host, time.Duration(p.GlobalConfig.ConnectTimeout)*time.Second)
-			if conn != nil {
-				conn.Close()
-			}
-			conn = nil
-		}
+		conn, err = p.openConnection(peerAddr, connType)
 		// connection successful
 		if err == nil {
 			promPeerConnections.WithLabelValues(p.Name).Inc()
@@ -1357,12 +1396,96 @@ func (p *Peer) GetConnection() (conn net.Conn, connType PeerConnType, err error)
 		}
 
 		// connection error
+		p.balancer.Done(p.StatusGet(CurPeerAddrNum).(int), false, 0, err)
 		p.setNextAddrFromErr(err)
 	}
 
 	return nil, ConnTypeUnix, &PeerError{msg: err.Error(), kind: ConnectionError}
 }
 
+// getSourceConnection returns a connection along with the number of the used source.
+// Balanced queries select the source by latency and running queries and skip
+// failed sources, all other queries use the current source and switch on errors.
+func (p *Peer) getSourceConnection(balanced bool) (conn net.Conn, connType PeerConnType, sourceNum int, err error) {
+	if !balanced {
+		conn, connType, err = p.GetConnection()
+		sourceNum = p.StatusGet(CurPeerAddrNum).(int)
+		return
+	}
+
+	tried := make(map[int]bool)
+	for {
+		sourceNum = p.balancer.Pick(tried)
+		if sourceNum == -1 {
+			break
+		}
+		tried[sourceNum] = true
+		var peerAddr string
+		peerAddr, connType = extractConnType(p.Source[sourceNum])
+		conn, err = p.openConnection(peerAddr, connType)
+		if err == nil {
+			promPeerConnections.WithLabelValues(p.Name).Inc()
+			return
+		}
+		logWith(p).Debugf("connection error %s: %s", p.Source[sourceNum], err)
+		promPeerFailedConnections.WithLabelValues(p.Name).Inc()
+		p.balancer.Done(sourceNum, false, 0, err)
+	}
+
+	return nil, ConnTypeUnix, -1, &PeerError{msg: err.Error(), kind: ConnectionError}
+}
+
+// openConnection connects to the given address.
+// In case of a http connection, it just tries a tcp connect, but does not
+// return anything.
+func (p *Peer) openConnection(peerAddr string, connType PeerConnType) (conn net.Conn, err error) {
+	switch connType {
+	case ConnTypeTCP:
+		conn, err = net.DialTimeout("tcp", peerAddr, time.Duration(p.GlobalConfig.ConnectTimeout)*time.Second)
+	case ConnTypeUnix:
+		conn, err = net.DialTimeout("unix", peerAddr, time.Duration(p.GlobalConfig.ConnectTimeout)*time.Second)
+	case ConnTypeTLS:
+		tlsConfig, cErr := p.getTLSClientConfig()
+		if cErr != nil {
+			err = cErr
+		} else {
+			dialer := new(net.Dialer)
+			dialer.Timeout = time.Duration(p.GlobalConfig.ConnectTimeout) * time.Second
+			conn, err = tls.DialWithDialer(dialer, "tcp", peerAddr, tlsConfig)
+		}
+	case ConnTypeHTTP, ConnTypeIcinga2API:
+		// test at least basic tcp connect
+		uri, uErr := url.Parse(peerAddr)
+		if uErr != nil {
+			err = uErr
+			return
+		}
+		host := uri.Host
+		if !strings.Contains(host, ":") {
+			switch uri.Scheme {
+			case "http":
+				host += ":80"
+			case "https":
+				host += ":443"
+			default:
+				err = &PeerError{msg: fmt.Sprintf("unknown scheme: %s", uri.Scheme), kind: ConnectionError}
+				return
+			}
+		}
+		conn, err = net.DialTimeout("tcp", host, time.Duration(p.GlobalConfig.ConnectTimeout)*time.Second)
+		if conn != nil {
+			conn.Close()
+		}
+		conn = nil
+	}
+	return
+}
+
+// isLoadBalanced returns true if queries and updates are spread across all sources
+func (p *Peer) isLoadBalanced() bool {
+	return p.Config.LoadBalance && len(p.Source) > 1
+}
+
 // GetCachedConnection returns the next free cached connection or nil of none found
 func (p *Peer) GetCachedConnection() (conn net.Conn) {
 	select {
@@ -1377,6 +1500,9 @@ func (p *Peer) GetCachedConnection() (conn net.Conn) {
 
 func extractConnType(rawAddr string) (string, PeerConnType) {
 	connType := ConnTypeUnix
+	if addr, ok := icinga2APIAddr(rawAddr); ok {
+		return addr, ConnTypeIcinga2API
+	}
 	switch {
 	case strings.HasPrefix(rawAddr, "http"):
 		connType = ConnTypeHTTP
@@ -1394,6 +1520,10 @@ func (p *Peer) setNextAddrFromErr(err error) {
 		// client errors do not affect remote site status
 		return
 	}
+	if peerErr, ok := err.(*PeerError); ok && peerErr.kind == CircuitOpenError {
+		// no connection has been tried
+		return
+	}
 	promPeerFailedConnections.WithLabelValues(p.Name).Inc()
 
 	p.Lock.Lock()
@@ -1416,8 +1546,23 @@ func (p *Peer) setNextAddrFromErr(err error) {
 	p.Status[CurPeerAddrNum] = nextNum
 	p.Status[PeerAddr] = p.Source[nextNum]
 	peerAddr = p.Source[nextNum]
+	p.resetConnectionCache()
+
+	if p.Status[PeerState].(PeerStatus) == PeerStatusUp || p.Status[PeerState].(PeerStatus) == PeerStatusPending {
+		p.Status[PeerState] = PeerStatusWarning
+	}
+	logWith(p).Debugf("last online: %s", timeOrNever(p.Status[LastOnline].(int64)))
+	p.setStaleStatus(err.Error())
+	p.circuitFailure(err)
+
+	if numSources > 1 {
+		logWith(p).Debugf("trying next one: %s", peerAddr)
+	}
+}
 
-	// invalidate connection cache
+// resetConnectionCache closes all cached connections, ex.: after the source has changed.
+// The caller must hold the write lock.
+func (p *Peer) resetConnectionCache() {
 cache:
 	for {
 		select {
@@ -1428,25 +1573,42 @@ cache:
 		}
 	}
 	p.cache.connection = make(chan net.Conn, ConnectionPoolCacheSize)
+}
 
-	if p.Status[PeerState].(PeerStatus) == PeerStatusUp || p.Status[PeerState].(PeerStatus) == PeerStatusPending {
-		p.Status[PeerState] = PeerStatusWarning
+// selectUpdateSource moves the updates of load balanced peers to the best healthy source.
+// It returns true if the source has changed, the data has to be updated completely then,
+// since the sources may differ slightly.
+func (p *Peer) selectUpdateSource() bool {
+	if !p.isLoadBalanced() {
+		return false
+	}
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	current := p.Status[CurPeerAddrNum].(int)
+	next := p.balancer.PickUpdateSource(current)
+	if next == -1 || next == current {
+		return false
 	}
+	p.Status[CurPeerAddrNum] = next
+	p.Status[PeerAddr] = p.Source[next]
+	p.resetConnectionCache()
+	logWith(p).Infof("update source changed to %s", p.Source[next])
+	return true
+}
+
+// setStaleStatus sets the peer down and clears its data if it has not been online for StaleBackendTimeout.
+// The caller must hold the write lock.
+func (p *Peer) setStaleStatus(reason string) {
 	now := time.Now().Unix()
 	lastOnline := p.Status[LastOnline].(int64)
-	logWith(p).Debugf("last online: %s", timeOrNever(lastOnline))
-	if lastOnline < now-int64(p.GlobalConfig.StaleBackendTimeout) || (p.ErrorCount > numSources && lastOnline <= 0) {
+	if lastOnline < now-int64(p.GlobalConfig.StaleBackendTimeout) || (p.ErrorCount > len(p.Source) && lastOnline <= 0) {
 		if p.Status[PeerState].(PeerStatus) != PeerStatusDown {
-			logWith(p).Infof("site went offline: %s", err.Error())
+			logWith(p).Infof("site went offline: %s", reason)
 		}
 		// clear existing data from memory
 		p.Status[PeerState] = PeerStatusDown
 		p.ClearData(false)
 	}
-
-	if numSources > 1 {
-		logWith(p).Debugf("trying next one: %s", peerAddr)
-	}
 }
 
 func (p *Peer) checkStatusFlags(store *DataStoreSet) (err error) {
@@ -1622,6 +1784,10 @@ func (p *Peer) fetchRemotePeers(store *DataStoreSet) (sites []interface{}, err e
 	if p.Config.RemoteName != "" {
 		return
 	}
+	// icinga2 api connections do not have remote sites
+	if p.isIcinga2API() {
+		return
+	}
 	if p.StatusGet(ThrukVersion).(float64) < ThrukMultiBackendMinVersion {
 		logWith(p).Warnf("remote thruk version too old (%.2f < %.2f) cannot fetch all sites.", p.StatusGet(ThrukVersion).(float64), ThrukMultiBackendMinVersion)
 		return
@@ -2015,11 +2181,13 @@ func ExtractHTTPResponse(response *http.Response) (contents []byte, err error) {
 func (p *Peer) PassThroughQuery(res *Response, passthroughRequest *Request, virtualColumns []*Column, columnsIndex map[*Column]int) {
 	req := res.Request
 	// do not use Query here, might be a log query with log
-	result, _, queryErr := p.query(passthroughRequest)
+	result, _, queryErr := p.queryBalanced(passthroughRequest)
 	logWith(p, req).Tracef("req done")
 	if queryErr != nil {
 		if peerErr, ok := queryErr.(*PeerError); ok && peerErr.kind == ResponseError {
 			// no connection issue, no need to reset current connection
+		} else if p.isLoadBalanced() {
+			// failed sources are skipped by the balancer, the peer status is maintained by the updates
 		} else {
 			p.setNextAddrFromErr(queryErr)
 		}
@@ -2121,6 +2289,7 @@ func createLocalStatsCopy(stats []*Filter) []*Filter {
 	for i, s := range stats {
 		localStats[i] = &Filter{}
 		localStats[i].StatsType = s.StatsType
+		localStats[i].StatsPercentile = s.StatsPercentile
 		if s.StatsType == Min {
 			localStats[i].Stats = -1
 		}
@@ -2237,6 +2406,10 @@ func (p *Peer) SendCommandsWithRetry(ctx context.Context, commands []string) (er
 			logWith(ctx).Debugf("cannot send command, peer is down")
 			return fmt.Errorf("%s", p.StatusGet(LastError))
 		case PeerStatusWarning, PeerStatusPending:
+			if err = p.circuitError(); err != nil {
+				logWith(ctx).Debugf("cannot send command, circuit breaker is open")
+				return
+			}
 			// wait till we get either a up or down
 			time.Sleep(1 * time.Second)
 		case PeerStatusUp:
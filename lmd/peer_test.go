@@ -314,3 +314,37 @@ func TestPeerLog(t *testing.T) {
 		panic(err.Error())
 	}
 }
+
+func TestPeerConfigOverrides(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	interval := int64(30)
+	overridePeer := NewPeer(GlobalTestConfig, &Connection{Source: []string{"test.sock"}, Name: "Override", ID: "overrideid", Updateinterval: &interval}, TestPeerWaitGroup, make(chan bool))
+	if err := assertEq(int64(30), overridePeer.GlobalConfig.Updateinterval); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(GlobalTestConfig.NetTimeout, overridePeer.GlobalConfig.NetTimeout); err != nil {
+		t.Error(err)
+	}
+	if err := assertNeq(int64(30), GlobalTestConfig.Updateinterval); err != nil {
+		t.Error(err)
+	}
+
+	// backends table contains the effective settings
+	res, _, err := peer.QueryString("GET backends\nColumns: update_interval net_timeout sync_is_executing\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncIsExecuting := 0.0
+	if GlobalTestConfig.SyncIsExecuting {
+		syncIsExecuting = 1
+	}
+	if err = assertEq([]interface{}{float64(GlobalTestConfig.Updateinterval), float64(GlobalTestConfig.NetTimeout), syncIsExecuting}, res[0]); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
@@ -61,6 +61,23 @@ var (
 		},
 	)
 
+	promResultCacheHits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: NAME,
+			Subsystem: "result_cache",
+			Name:      "hits",
+			Help:      "Number of queries answered from the result cache",
+		},
+	)
+	promResultCacheMisses = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: NAME,
+			Subsystem: "result_cache",
+			Name:      "misses",
+			Help:      "Number of cacheable queries not found in the result cache",
+		},
+	)
+
 	promFrontendConnections = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: NAME,
@@ -186,6 +203,24 @@ var (
 		},
 		[]string{"peer"},
 	)
+	promPeerCircuitState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "circuit_state",
+			Help:      "Peer Circuit Breaker State (0 - closed, 1 - open, 2 - half-open)",
+		},
+		[]string{"peer"},
+	)
+	promPeerCircuitOpens = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "circuit_opens",
+			Help:      "Peer Circuit Breaker Open Counter",
+		},
+		[]string{"peer"},
+	)
 
 	promObjectCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -197,6 +232,56 @@ var (
 		[]string{"peer", "type"},
 	)
 
+	promPeerMemoryRows = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "memory_rows",
+			Help:      "Number of cached rows",
+		},
+		[]string{"peer", "table"},
+	)
+
+	promPeerMemoryStringBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "memory_string_bytes",
+			Help:      "Approximate bytes used by cached strings",
+		},
+		[]string{"peer", "table"},
+	)
+
+	promPeerMemoryCompressedBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "memory_compressed_bytes",
+			Help:      "Approximate bytes used by compressed large strings",
+		},
+		[]string{"peer", "table"},
+	)
+
+	promPeerMemoryDedupSavings = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "memory_dedup_savings_bytes",
+			Help:      "Approximate bytes saved by string deduplication",
+		},
+		[]string{"peer", "table"},
+	)
+
+	promPeerMemoryTotalBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NAME,
+			Subsystem: "peer",
+			Name:      "memory_total_bytes",
+			Help:      "Approximate total bytes used by the cache",
+		},
+		[]string{"peer", "table"},
+	)
+
 	promObjectUpdate = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: NAME,
@@ -266,6 +351,8 @@ func initPrometheus(localConfig *Config) (prometheusListener io.Closer) {
 	prometheus.MustRegister(promFrontendConnections)
 	prometheus.MustRegister(promFrontendQueries)
 	prometheus.MustRegister(promFrontendBytesSend)
+	prometheus.MustRegister(promResultCacheHits)
+	prometheus.MustRegister(promResultCacheMisses)
 	prometheus.MustRegister(promFrontendBytesReceived)
 	prometheus.MustRegister(promFrontendOpenConnections)
 	prometheus.MustRegister(promPeerUpdateInterval)
@@ -277,8 +364,15 @@ func initPrometheus(localConfig *Config) (prometheusListener io.Closer) {
 	prometheus.MustRegister(promPeerBytesReceived)
 	prometheus.MustRegister(promPeerUpdates)
 	prometheus.MustRegister(promPeerUpdateDuration)
+	prometheus.MustRegister(promPeerCircuitState)
+	prometheus.MustRegister(promPeerCircuitOpens)
 	prometheus.MustRegister(promObjectUpdate)
 	prometheus.MustRegister(promObjectCount)
+	prometheus.MustRegister(promPeerMemoryRows)
+	prometheus.MustRegister(promPeerMemoryStringBytes)
+	prometheus.MustRegister(promPeerMemoryCompressedBytes)
+	prometheus.MustRegister(promPeerMemoryDedupSavings)
+	prometheus.MustRegister(promPeerMemoryTotalBytes)
 	prometheus.MustRegister(promStringDedupCount)
 	prometheus.MustRegister(promStringDedupBytes)
 	prometheus.MustRegister(promStringDedupIndexBytes)
@@ -14,6 +14,7 @@ type RawResultSet struct {
 	DataResult  []*DataRow     // references to the data rows required for the result
 	StatsResult ResultSetStats // intermediate result of stats query
 	Sort        []*SortField   // columns required for sorting
+	TieBreak    bool           // sort equal rows by peer and id to get a stable order
 }
 
 // PostProcessing does all the post processing required for a request like sorting
@@ -31,13 +32,16 @@ func (raw *RawResultSet) PostProcessing(res *Response) {
 	}
 
 	// sort our result
-	if len(res.Request.Sort) > 0 {
+	if len(res.Request.Sort) > 0 || raw.TieBreak {
 		// skip sorting if there is only one backend requested and we want the default sort order
-		if len(res.Request.BackendsMap) >= 1 || !res.Request.IsDefaultSortOrder() {
+		if len(res.Request.BackendsMap) >= 1 || !res.Request.IsDefaultSortOrder() || raw.TieBreak {
 			t1 := time.Now()
 			sort.Sort(raw)
 			duration := time.Since(t1)
 			log.Debugf("sorting result took %s", duration.String())
+			if res.Plan != nil {
+				res.Plan.SortDuration = duration
+			}
 		}
 	}
 
@@ -49,6 +53,11 @@ func (raw *RawResultSet) PostProcessing(res *Response) {
 	// apply request limit
 	if res.Request.Limit != nil && *res.Request.Limit >= 0 && *res.Request.Limit < len(raw.DataResult) {
 		raw.DataResult = raw.DataResult[0:*res.Request.Limit]
+
+		// remaining rows will be returned on the next page
+		if res.Request.Cursor != nil && len(raw.DataResult) > 0 {
+			res.NextCursor = NewRowCursor(raw.DataResult[len(raw.DataResult)-1], res.Request.Sort)
+		}
 	}
 }
 
@@ -99,6 +108,9 @@ func (raw *RawResultSet) Less(i, j int) bool {
 		}
 		panic(fmt.Sprintf("sorting not implemented for type %s", s.Column.DataType))
 	}
+	if raw.TieBreak {
+		return compareRowIdentity(raw.DataResult[i], raw.DataResult[j]) < 0
+	}
 	return true
 }
 
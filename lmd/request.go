@@ -9,9 +9,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net"
-	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -34,11 +34,13 @@ type Request struct {
 	Stats               []*Filter
 	StatsGrouped        []*Filter // optimized stats groups
 	StatsResult         *ResultSetStats
+	StatsHaving         []*StatsHaving // filter on aggregated stats results
 	Limit               *int
 	Offset              int
 	Sort                []*SortField
 	ResponseFixed16     bool
 	OutputFormat        OutputFormat
+	Separators          *Separators // separators used for csv output
 	Backends            []string
 	BackendsMap         map[string]string
 	BackendErrors       map[string]string
@@ -51,6 +53,10 @@ type Request struct {
 	WaitConditionNegate bool
 	KeepAlive           bool
 	AuthUser            string
+	LocaltimeOffset     int64      // timezone offset in seconds calculated from the Localtime header
+	Cursor              *RowCursor // position for cursor based pagination
+	Explain             bool       // return the query plan instead of the result
+	ChangedSince        int64      // only return rows with a higher revision
 }
 
 // SortDirection can be either Asc or Desc
@@ -98,6 +104,8 @@ const (
 	OutputFormatJSON
 	OutputFormatWrappedJSON
 	OutputFormatPython
+	OutputFormatCSV
+	OutputFormatNDJSON
 )
 
 // String converts a SortDirection back to the original string.
@@ -109,11 +117,42 @@ func (o *OutputFormat) String() string {
 		return "wrapped_json"
 	case OutputFormatPython:
 		return "python"
+	case OutputFormatCSV:
+		return "csv"
+	case OutputFormatNDJSON:
+		return "ndjson"
 	}
 	log.Panicf("not implemented")
 	return ""
 }
 
+// HasMetaData returns true if the output format contains meta data like the total count
+func (o *OutputFormat) HasMetaData() bool {
+	return *o == OutputFormatWrappedJSON || *o == OutputFormatNDJSON
+}
+
+// Separators defines the separators used for csv output
+type Separators struct {
+	noCopy      noCopy
+	Dataset     byte
+	Column      byte
+	List        byte
+	HostService byte
+}
+
+// DefaultSeparators contains the livestatus default separators
+var DefaultSeparators = Separators{
+	Dataset:     '\n',
+	Column:      ';',
+	List:        ',',
+	HostService: '|',
+}
+
+// String converts the separators back to its string representation
+func (s *Separators) String() string {
+	return fmt.Sprintf("Separators: %d %d %d %d\n", s.Dataset, s.Column, s.List, s.HostService)
+}
+
 // SortField defines a single sort entry
 type SortField struct {
 	noCopy    noCopy
@@ -121,10 +160,45 @@ type SortField struct {
 	Direction SortDirection
 	Index     int
 	Group     bool
+	Stats     bool // sort by aggregated stats result
 	Args      string
 	Column    *Column
 }
 
+// StatsHaving defines a filter which is applied to the final stats result
+type StatsHaving struct {
+	noCopy   noCopy
+	Index    int // stats index, starts with 1
+	Operator Operator
+	Value    float64
+	raw      string // header value as requested, used in error messages
+}
+
+// String converts the stats having filter back to its string representation
+func (h *StatsHaving) String() string {
+	return fmt.Sprintf("StatsHaving: %d %s %s\n", h.Index, h.Operator.String(), strconv.FormatFloat(h.Value, 'f', -1, 64))
+}
+
+// Match returns true if the given stats result row matches this filter
+func (h *StatsHaving) Match(stats []interface{}) bool {
+	value := interface2float64(stats[h.Index-1])
+	switch h.Operator {
+	case Equal:
+		return value == h.Value
+	case Unequal:
+		return value != h.Value
+	case Less:
+		return value < h.Value
+	case LessThan:
+		return value <= h.Value
+	case Greater:
+		return value > h.Value
+	case GreaterThan:
+		return value >= h.Value
+	}
+	return false
+}
+
 // GroupOperator is the operator used to combine multiple filter or stats header.
 type GroupOperator uint8
 
@@ -152,6 +226,9 @@ type ResultMetaData struct {
 	Total       int64         // total number of result rows
 	RowsScanned int64         // total number of scanned rows for this result
 	Columns     []string      // list of requested columns
+	NextCursor  string        // cursor for the next page when using cursor based pagination
+	Revision    int64         // data revision of the result
+	Resync      bool          // result contains all rows because rows have been removed since the requested revision
 	Duration    time.Duration // response time in seconds
 	Size        int           // result size in bytes
 	Request     *Request      // the request itself
@@ -223,6 +300,9 @@ func (req *Request) String() (str string) {
 	if req.OutputFormat != OutputFormatDefault {
 		str += fmt.Sprintf("OutputFormat: %s\n", req.OutputFormat.String())
 	}
+	if req.Separators != nil {
+		str += req.Separators.String()
+	}
 	if len(req.Columns) > 0 {
 		str += "Columns: " + strings.Join(req.Columns, " ") + "\n"
 	}
@@ -241,6 +321,9 @@ func (req *Request) String() (str string) {
 	if req.KeepAlive {
 		str += "KeepAlive: on\n"
 	}
+	if req.Explain {
+		str += "Explain: on\n"
+	}
 	for i := range req.Filter {
 		str += req.Filter[i].String("")
 	}
@@ -250,6 +333,9 @@ func (req *Request) String() (str string) {
 	for i := range req.Stats {
 		str += req.Stats[i].String("Stats")
 	}
+	for i := range req.StatsHaving {
+		str += req.StatsHaving[i].String()
+	}
 	if req.WaitTrigger != "" {
 		str += fmt.Sprintf("WaitTrigger: %s\n", req.WaitTrigger)
 	}
@@ -260,7 +346,7 @@ func (req *Request) String() (str string) {
 		str += fmt.Sprintf("WaitTimeout: %d\n", req.WaitTimeout)
 	}
 	if req.WaitConditionNegate {
-		str += "WaitConditionNegate\n"
+		str += "WaitConditionNegate:\n"
 	}
 	if req.AuthUser != "" {
 		str += fmt.Sprintf("AuthUser: %s\n", req.AuthUser)
@@ -271,6 +357,12 @@ func (req *Request) String() (str string) {
 	for i := range req.Sort {
 		str += fmt.Sprintf("Sort: %s %s\n", req.Sort[i].Name, req.Sort[i].Direction.String())
 	}
+	if req.Cursor != nil {
+		str += strings.TrimSpace(fmt.Sprintf("Cursor: %s", req.Cursor.String())) + "\n"
+	}
+	if req.ChangedSince > 0 {
+		str += fmt.Sprintf("ChangedSince: %d\n", req.ChangedSince)
+	}
 	str += "\n"
 	return
 }
@@ -330,6 +422,13 @@ func NewRequest(ctx context.Context, b *bufio.Reader, options ParseOptions) (req
 		}
 	}
 
+	// convert timestamp filters from client time into server time
+	if req.LocaltimeOffset != 0 {
+		shiftTimestampFilter(req.Filter, -req.LocaltimeOffset)
+		shiftTimestampFilter(req.Stats, -req.LocaltimeOffset)
+		shiftTimestampFilter(req.WaitCondition, -req.LocaltimeOffset)
+	}
+
 	// remove unnecessary filter indentation
 	if options&ParseOptimize != 0 {
 		req.optimizeFilterIndentation()
@@ -338,6 +437,22 @@ func NewRequest(ctx context.Context, b *bufio.Reader, options ParseOptions) (req
 
 	req.SetRequestColumns()
 	err = req.SetSortColumns()
+	if err != nil {
+		return
+	}
+	err = req.validateStatsHaving()
+	if err != nil {
+		return
+	}
+	if req.Cursor != nil {
+		err = req.validateCursor()
+		if err != nil {
+			return
+		}
+	}
+	if req.ChangedSince > 0 && req.Command == "" && Objects.Tables[req.Table].PassthroughOnly {
+		err = fmt.Errorf("bad request: changedsince is not supported for table %s", req.Table.String())
+	}
 	return
 }
 
@@ -395,7 +510,27 @@ func (req *Request) ParseRequestAction(firstLine *string) (valid bool, err error
 
 // GetResponse builds the response for a given request.
 // It returns the Response object and any error encountered.
-func (req *Request) GetResponse() (*Response, error) {
+func (req *Request) GetResponse() (res *Response, err error) {
+	if resultCache != nil && req.IsCacheable() {
+		return resultCache.GetResponse(req, req.buildResponse)
+	}
+	return req.buildResponse()
+}
+
+func (req *Request) buildResponse() (res *Response, err error) {
+	res, err = req.getResponse()
+	if err != nil {
+		return
+	}
+	if req.Explain && res.Plan == nil {
+		res.Plan = NewQueryPlan("distributed")
+	}
+	// shift timestamps into client time once the final result is available
+	res.ApplyLocaltimeOffset()
+	return
+}
+
+func (req *Request) getResponse() (*Response, error) {
 	// Run single request if possible
 	if nodeAccessor == nil || !nodeAccessor.IsClustered() {
 		// Single mode (send request and return response)
@@ -418,6 +553,16 @@ func (req *Request) GetResponse() (*Response, error) {
 		return NewResponse(req)
 	}
 
+	// cursor positions refer to local data rows and cannot be merged across nodes
+	if req.Cursor != nil {
+		return nil, fmt.Errorf("bad request: cursor is not supported in cluster mode")
+	}
+
+	// revisions are counted separately on each node
+	if req.ChangedSince > 0 {
+		return nil, fmt.Errorf("bad request: changedsince is not supported in cluster mode")
+	}
+
 	// Distribute request
 	return req.getDistributedResponse()
 }
@@ -431,6 +576,11 @@ func (req *Request) getDistributedResponse() (*Response, error) {
 	var wg sync.WaitGroup
 	collectedDatasets := make(chan ResultSet, len(nodeAccessor.nodeBackends))
 	collectedFailedHashes := make(chan map[string]string, len(nodeAccessor.nodeBackends))
+	// other nodes return their query plan instead of the result
+	var plan *QueryPlan
+	if req.Explain {
+		plan = NewQueryPlan("distributed")
+	}
 	for nodeID, nodeBackends := range nodeAccessor.nodeBackends {
 		node := nodeAccessor.Node(nodeID)
 		// limit to requested backends if necessary
@@ -455,6 +605,11 @@ func (req *Request) getDistributedResponse() (*Response, error) {
 			if res.Result == nil {
 				res.SetResultData()
 			}
+			if plan != nil {
+				for _, peer := range res.Plan.Peers {
+					plan.AddPeer(peer)
+				}
+			}
 			collectedDatasets <- res.Result
 			collectedFailedHashes <- res.Failed
 			continue
@@ -472,6 +627,13 @@ func (req *Request) getDistributedResponse() (*Response, error) {
 				return
 			}
 
+			if plan != nil {
+				plan.AddRemotePlan(node.String(), hash)
+				collectedDatasets <- ResultSet{}
+				collectedFailedHashes <- map[string]string{}
+				return
+			}
+
 			// Hash containing error messages
 			failedHash, ok := hash["failed"].(map[string]interface{})
 			if !ok {
@@ -529,6 +691,15 @@ func (req *Request) getDistributedResponse() (*Response, error) {
 		res.PostProcessing()
 	}
 
+	if plan != nil {
+		res.Plan = plan
+		res.RowsScanned += plan.RemoteScanned
+		// grouped stats from other nodes are merged with the local groups, so only rows can be summed up
+		if len(req.Stats) == 0 {
+			res.ResultTotal += plan.RemoteTotal
+		}
+	}
+
 	return res, nil
 }
 
@@ -625,6 +796,11 @@ func (req *Request) buildDistributedRequestData(subBackends []string) (requestDa
 	// Get hash with metadata in addition to table rows
 	requestData["outputformat"] = OutputFormatWrappedJSON
 
+	// Get query plan instead of rows
+	if req.Explain {
+		requestData["explain"] = true
+	}
+
 	return
 }
 
@@ -662,10 +838,7 @@ func (req *Request) mergeDistributedResponse(collectedDatasets chan ResultSet, c
 					row = row[hasColumns:]
 				}
 				for i := range row {
-					data := reflect.ValueOf(row[i])
-					value := data.Index(0).Interface()
-					count := data.Index(1).Interface()
-					req.StatsResult.Stats[key][i].ApplyValue(interface2float64(value), int(interface2float64(count)))
+					req.StatsResult.Stats[key][i].ApplyStatsData(row[i])
 				}
 			}
 		} else {
@@ -710,6 +883,12 @@ func (req *Request) ParseRequestHeaderLine(line []byte, options ParseOptions) (e
 	case "statsor":
 		err = parseStatsOp(Or, args, req.Table, &req.Stats, options)
 		return
+	case "statsnegate":
+		err = parseStatsNegate(req.Stats)
+		return
+	case "statshaving":
+		err = parseStatsHaving(&req.StatsHaving, args)
+		return
 	case "sort":
 		err = parseSortHeader(&req.Sort, args)
 		return
@@ -732,6 +911,9 @@ func (req *Request) ParseRequestHeaderLine(line []byte, options ParseOptions) (e
 	case "outputformat":
 		err = parseOutputFormat(&req.OutputFormat, args)
 		return
+	case "separators":
+		err = parseSeparators(&req.Separators, args)
+		return
 	case "waittimeout":
 		err = parseIntHeader(&req.WaitTimeout, args, 1)
 		return
@@ -762,10 +944,17 @@ func (req *Request) ParseRequestHeaderLine(line []byte, options ParseOptions) (e
 	case "columnheaders":
 		err = parseOnOff(&req.ColumnsHeaders, args)
 		return
+	case "explain":
+		err = parseOnOff(&req.Explain, args)
+		return
 	case "localtime":
-		if log.IsV(LogVerbosityDebug) {
-			logWith(req).Debugf("Ignoring %s as LMD works on unix timestamps only.", matched[0])
-		}
+		err = parseLocaltime(&req.LocaltimeOffset, args)
+		return
+	case "cursor":
+		err = parseCursor(&req.Cursor, args)
+		return
+	case "changedsince":
+		err = parseInt64Header(&req.ChangedSince, args)
 		return
 	case "authuser":
 		err = parseAuthUser(&req.AuthUser, args)
@@ -776,11 +965,31 @@ func (req *Request) ParseRequestHeaderLine(line []byte, options ParseOptions) (e
 }
 
 func parseResponseHeader(field *bool, value []byte) (err error) {
-	if !bytes.Equal(value, []byte("fixed16")) {
-		err = errors.New("unrecognized responseformat, only fixed16 is supported")
+	switch string(value) {
+	case "fixed16":
+		*field = true
+	case "off":
+		*field = false
+	default:
+		err = errors.New("unrecognized responseformat, choose from fixed16 and off")
+	}
+	return
+}
+
+// parseLocaltime parses the client timestamp from the Localtime header
+// and sets the offset rounded to full half hours like livestatus does.
+func parseLocaltime(field *int64, value []byte) (err error) {
+	clientTime, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		err = fmt.Errorf("expecting a unix timestamp")
+		return
+	}
+	offset := int64(math.Round(float64(clientTime-time.Now().Unix())/1800)) * 1800
+	if offset >= 86400 || offset <= -86400 {
+		err = errors.New("timezone difference greater than or equal to 24 hours")
 		return
 	}
-	*field = true
+	*field = offset
 	return
 }
 
@@ -794,6 +1003,16 @@ func parseIntHeader(field *int, value []byte, minValue int) (err error) {
 	return
 }
 
+func parseInt64Header(field *int64, value []byte) (err error) {
+	intVal, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil || intVal < 0 {
+		err = fmt.Errorf("expecting a positive number")
+		return
+	}
+	*field = intVal
+	return
+}
+
 func parseSortHeader(field *[]*SortField, value []byte) (err error) {
 	if len(value) == 0 {
 		err = errors.New("invalid sort header, must be 'Sort: <field> <asc|desc>' or 'Sort: custom_variables <name> <asc|desc>'")
@@ -830,6 +1049,66 @@ func parseSortHeader(field *[]*SortField, value []byte) (err error) {
 	return
 }
 
+// parseStatsHaving parses a StatsHaving header, the index is validated by validateStatsHaving
+// once all stats headers are known.
+func parseStatsHaving(field *[]*StatsHaving, value []byte) (err error) {
+	tmp := bytes.SplitN(value, []byte(" "), 3)
+	if len(tmp) < 3 {
+		err = errors.New("invalid statshaving header, must be 'StatsHaving: <statsindex> <operator> <value>'")
+		return
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(string(tmp[0])), "stats_"))
+	if err != nil || index < 1 {
+		err = fmt.Errorf("invalid stats index %s, must be a number greater than 0", tmp[0])
+		return
+	}
+	op, isRegex, err := parseFilterOp(tmp[1])
+	if err != nil {
+		return
+	}
+	switch op {
+	case Equal, Unequal, Less, LessThan, Greater, GreaterThan:
+	default:
+		isRegex = true
+	}
+	if isRegex {
+		err = fmt.Errorf("unsupported statshaving operator %s, must be one of =, !=, <, <=, > or >=", tmp[1])
+		return
+	}
+	val, err := strconv.ParseFloat(string(bytes.TrimSpace(tmp[2])), 64)
+	if err != nil {
+		err = fmt.Errorf("could not convert %s to number", tmp[2])
+		return
+	}
+	*field = append(*field, &StatsHaving{
+		Index:    index,
+		Operator: op,
+		Value:    val,
+		raw:      string(value),
+	})
+	return
+}
+
+// parseStatsIndex parses a stats result column reference which is either the
+// plain stats number or the column name from the columns header, ex.: 1 or stats_1
+func parseStatsIndex(name string, numStats int) (index int, ok bool) {
+	index, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(name), "stats_"))
+	if err != nil || index < 1 || index > numStats {
+		return 0, false
+	}
+	return index, true
+}
+
+// parseStatsNegate negates the last stats counter on the stack
+func parseStatsNegate(stats []*Filter) (err error) {
+	if len(stats) > 0 && stats[len(stats)-1].StatsType != Counter {
+		err = errors.New("only stats counter can be negated")
+		return
+	}
+	err = ParseFilterNegate(stats)
+	return
+}
+
 func parseStatsOp(op GroupOperator, value []byte, table TableName, stats *[]*Filter, options ParseOptions) (err error) {
 	num, cerr := strconv.Atoi(string(value))
 	if cerr == nil && num == 0 {
@@ -852,13 +1131,42 @@ func parseOutputFormat(field *OutputFormat, value []byte) (err error) {
 		*field = OutputFormatJSON
 	case "python":
 		*field = OutputFormatPython
+	case "csv":
+		*field = OutputFormatCSV
+	case "ndjson":
+		*field = OutputFormatNDJSON
 	default:
-		err = errors.New("unrecognized outputformat, choose from json, wrapped_json and python")
+		err = errors.New("unrecognized outputformat, choose from csv, json, ndjson, wrapped_json and python")
 		return
 	}
 	return
 }
 
+func parseSeparators(field **Separators, value []byte) (err error) {
+	values := bytes.Fields(value)
+	if len(values) == 0 || len(values) > 4 {
+		err = errors.New("invalid separators header, must be 'Separators: <dataset> <column> <list> <host/service>'")
+		return
+	}
+	sep := &Separators{
+		Dataset:     DefaultSeparators.Dataset,
+		Column:      DefaultSeparators.Column,
+		List:        DefaultSeparators.List,
+		HostService: DefaultSeparators.HostService,
+	}
+	targets := []*byte{&sep.Dataset, &sep.Column, &sep.List, &sep.HostService}
+	for i := range values {
+		num, cerr := strconv.Atoi(string(values[i]))
+		if cerr != nil || num < 0 || num > 255 {
+			err = fmt.Errorf("invalid separator %s, must be an ascii code between 0 and 255", values[i])
+			return
+		}
+		*targets[i] = byte(num)
+	}
+	*field = sep
+	return
+}
+
 // parseOnOff parses a on/off header
 // It returns any error encountered.
 func parseOnOff(field *bool, value []byte) (err error) {
@@ -873,6 +1181,15 @@ func parseOnOff(field *bool, value []byte) (err error) {
 	return
 }
 
+func parseCursor(field **RowCursor, value []byte) (err error) {
+	cursor, err := ParseRowCursor(string(value))
+	if err != nil {
+		return
+	}
+	*field = cursor
+	return
+}
+
 func parseAuthUser(field *string, value []byte) (err error) {
 	if string(value) != "" {
 		*field = string(value)
@@ -920,6 +1237,20 @@ func (req *Request) SetSortColumns() (err error) {
 	}
 	table := Objects.Tables[req.Table]
 
+	if len(req.Stats) > 0 {
+		// other columns do not exist in stats results, so they are ignored
+		sort := make([]*SortField, 0, len(req.Sort))
+		for _, field := range req.Sort {
+			if !req.setStatsSortField(field) {
+				logWith(req).Debugf("ignoring sort column %s, stats requests can only be sorted by grouping columns or stats results", field.Name)
+				continue
+			}
+			sort = append(sort, field)
+		}
+		req.Sort = sort
+		return
+	}
+
 	// build array of requested columns as ResultColumn objects list
 	for j := range req.Sort {
 		col := table.GetColumn(req.Sort[j].Name)
@@ -932,6 +1263,25 @@ func (req *Request) SetSortColumns() (err error) {
 	return
 }
 
+// setStatsSortField sets the result index for sort fields of stats requests which
+// either sort by one of the grouping columns or by a stats result, ex.: stats_1
+// It returns false if the sort field is no stats sort field.
+func (req *Request) setStatsSortField(sortField *SortField) bool {
+	for i := range req.Columns {
+		if req.Columns[i] == sortField.Name {
+			sortField.Index = i
+			sortField.Group = true
+			return true
+		}
+	}
+	if index, ok := parseStatsIndex(sortField.Name, len(req.Stats)); ok {
+		sortField.Index = len(req.Columns) + index - 1
+		sortField.Stats = true
+		return true
+	}
+	return false
+}
+
 // parseResult parses the result bytes and returns the data table and optional meta data for wrapped_json requests
 func (req *Request) parseResult(resBytes []byte) (ResultSet, *ResultMetaData, error) {
 	var err error
@@ -955,7 +1305,7 @@ func (req *Request) parseResult(resBytes []byte) (ResultSet, *ResultMetaData, er
 
 func (req *Request) parseWrappedJSONMeta(resBytes []byte, meta *ResultMetaData) ([]byte, error) {
 	var dataBytes []byte
-	err := jsonparser.ObjectEach(resBytes, func(keyBytes []byte, valueBytes []byte, _ jsonparser.ValueType, _ int) error {
+	err := jsonparser.ObjectEach(resBytes, func(keyBytes []byte, valueBytes []byte, valueType jsonparser.ValueType, _ int) error {
 		key := string(keyBytes)
 		switch key {
 		case "total_count":
@@ -977,6 +1327,18 @@ func (req *Request) parseWrappedJSONMeta(resBytes []byte, meta *ResultMetaData)
 				return &PeerError{msg: fmt.Sprintf("rows_scanned meta data parse error: %s", err.Error()), kind: ResponseError, req: req, resBytes: resBytes}
 			}
 			meta.RowsScanned = val
+		case "next_cursor":
+			if valueType == jsonparser.String {
+				meta.NextCursor = string(valueBytes)
+			}
+		case "revision":
+			val, err := jsonparser.ParseInt(valueBytes)
+			if err != nil {
+				return &PeerError{msg: fmt.Sprintf("revision meta data parse error: %s", err.Error()), kind: ResponseError, req: req, resBytes: resBytes}
+			}
+			meta.Revision = val
+		case "resync":
+			meta.Resync = valueType == jsonparser.Boolean && string(valueBytes) == "true"
 		case "data":
 			dataBytes = valueBytes
 		}
@@ -989,6 +1351,36 @@ func (req *Request) parseWrappedJSONMeta(resBytes []byte, meta *ResultMetaData)
 	return dataBytes, nil
 }
 
+// validateStatsHaving checks if all StatsHaving headers refer to an existing stats result.
+func (req *Request) validateStatsHaving() error {
+	for _, h := range req.StatsHaving {
+		if h.Index > len(req.Stats) {
+			return fmt.Errorf("bad request: invalid stats index %s, must be between 1 and %d in: StatsHaving: %s", strings.Fields(h.raw)[0], len(req.Stats), h.raw)
+		}
+	}
+	return nil
+}
+
+// validateCursor checks if cursor based pagination can be used for this request.
+func (req *Request) validateCursor() error {
+	if req.Command != "" {
+		return nil
+	}
+	table := Objects.Tables[req.Table]
+	switch {
+	case len(req.Stats) > 0:
+		return fmt.Errorf("bad request: cursor cannot be used with stats queries")
+	case req.Offset > 0:
+		return fmt.Errorf("bad request: cursor cannot be combined with offset")
+	case len(table.PrimaryKey) == 0 || table.PassthroughOnly || table.Virtual != nil:
+		return fmt.Errorf("bad request: cursor is not supported for table %s", table.Name.String())
+	}
+	if err := req.Cursor.Validate(req.Sort); err != nil {
+		return fmt.Errorf("bad request: %s", err.Error())
+	}
+	return nil
+}
+
 // IsDefaultSortOrder returns true if the sortfields are the default for the given table.
 func (req *Request) IsDefaultSortOrder() bool {
 	if len(req.Sort) == 0 {
@@ -1010,7 +1402,8 @@ func (req *Request) IsDefaultSortOrder() bool {
 }
 
 func (req *Request) optimizeResultLimit() (limit int) {
-	if req.Limit != nil && req.IsDefaultSortOrder() {
+	// cursor pages need all rows after the cursor to find the next page
+	if req.Limit != nil && req.IsDefaultSortOrder() && req.Cursor == nil {
 		limit = *req.Limit
 		if req.Offset > 0 {
 			limit += req.Offset
@@ -1024,7 +1417,7 @@ func (req *Request) optimizeResultLimit() (limit int) {
 // optimizeFilterIndentation removes unnecessary filter indentation
 func (req *Request) optimizeFilterIndentation() {
 	for {
-		if len(req.Filter) == 1 && len(req.Filter[0].Filter) > 0 && req.Filter[0].GroupOperator == And {
+		if len(req.Filter) == 1 && len(req.Filter[0].Filter) > 0 && req.Filter[0].GroupOperator == And && !req.Filter[0].Negate {
 			req.Filter = req.Filter[0].Filter
 		} else {
 			break
@@ -1057,7 +1450,7 @@ func (req *Request) optimizeStatsGroups(stats []*Filter, renumber bool) []*Filte
 		if renumber {
 			s.StatsPos = i
 		}
-		if s.StatsType != Counter || s.Column != nil || len(s.Filter) < 2 {
+		if s.StatsType != Counter || s.Column != nil || len(s.Filter) < 2 || s.Negate {
 			groupedStats = append(groupedStats, s)
 			continue
 		}
@@ -1077,7 +1470,7 @@ func (req *Request) optimizeStatsGroups(stats []*Filter, renumber bool) []*Filte
 		// start a new group if the current first stats filter matches the next first stats filter
 		if len(stats) > i+1 {
 			next := stats[i+1]
-			if next.StatsType != Counter || next.Column != nil || len(next.Filter) < 2 {
+			if next.StatsType != Counter || next.Column != nil || len(next.Filter) < 2 || next.Negate {
 				groupedStats = append(groupedStats, s)
 				continue
 			}
@@ -25,7 +25,8 @@ func TestRequestStatsTac(t *testing.T) {
 	if err = assertEq(int64(1), meta.Total); err != nil {
 		t.Error(err)
 	}
-	if err = assertEq(int64(40), meta.RowsScanned); err != nil {
+	// stats are answered from the tac counters, so only the distinct counter keys are scanned
+	if err = assertEq(int64(12), meta.RowsScanned); err != nil {
 		t.Error(err)
 	}
 	if err = assertEq(float64(40), res[0][0]); err != nil {
@@ -50,7 +51,7 @@ func TestRequestStatsTac(t *testing.T) {
 	if err = assertEq(int64(1), meta2.Total); err != nil {
 		t.Error(err)
 	}
-	if err = assertEq(int64(40), meta2.RowsScanned); err != nil {
+	if err = assertEq(int64(12), meta2.RowsScanned); err != nil {
 		t.Error(err)
 	}
 	if err = assertEq(res, res2); err != nil {
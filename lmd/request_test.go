@@ -40,6 +40,15 @@ func TestRequestHeader(t *testing.T) {
 		"GET hosts\nAuthUser: testUser\n\n",
 		"GET hosts\nColumns: name\nFilter: contact_groups >= test\nNegate:\n\n",
 		"GET hosts\nColumns: name\nFilter: state ~~ 0|1|2\n\n",
+		"GET hosts\nOutputFormat: csv\nSeparators: 10 59 44 124\nColumns: name state\n\n",
+		"GET hosts\nColumns: name\nLimit: 10\nSort: name asc\nCursor:\n\n",
+		"GET hosts\nOutputFormat: json\nColumns: name\nColumnHeaders: on\nKeepAlive: on\n\n",
+		"GET hosts\nColumns: name\nExplain: on\n\n",
+		"GET hosts\nColumns: name\nChangedSince: 5\n\n",
+		"GET hosts\nColumns: name\nFilter: state = 1\nFilter: state = 2\nOr: 2\nNegate:\n\n",
+		"GET hosts\nStats: state = 1\nStatsNegate:\nStats: state = 1\nStats: state = 2\nStatsOr: 2\nStatsNegate:\n\n",
+		"GET hosts\nColumns: name\nStats: state = 1\nStats: sum latency\nStatsHaving: 1 > 5\nSort: stats_2 desc\n\n",
+		"GET hosts\nColumns: name\nWaitTrigger: check\nWaitObject: test\nWaitTimeout: 10000\nWaitConditionNegate:\nWaitCondition: state = 1\n\n",
 	}
 	for _, str := range testRequestStrings {
 		buf := bufio.NewReader(bytes.NewBufferString(str))
@@ -53,6 +62,33 @@ func TestRequestHeader(t *testing.T) {
 	}
 }
 
+func TestRequestHeaderResponseHeader(t *testing.T) {
+	buf := bufio.NewReader(bytes.NewBufferString("GET hosts\nResponseHeader: fixed16\nResponseHeader: off\n"))
+	req, _, err := NewRequest(context.TODO(), buf, ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := assertEq(false, req.ResponseFixed16); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequestHeaderLocaltime(t *testing.T) {
+	// client clock is 1 hour and a few seconds ahead
+	str := fmt.Sprintf("GET hosts\nColumns: name\nLocaltime: %d\nFilter: last_check > 1473760401\nFilter: last_check = 0\n", time.Now().Unix()+3610)
+	buf := bufio.NewReader(bytes.NewBufferString(str))
+	req, _, err := NewRequest(context.TODO(), buf, ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := assertEq(int64(3600), req.LocaltimeOffset); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertEq("GET hosts\nColumns: name\nFilter: last_check > 1473756801\nFilter: last_check = 0\n\n", req.String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestRequestHeaderTable(t *testing.T) {
 	buf := bufio.NewReader(bytes.NewBufferString("GET hosts\n"))
 	req, _, _ := NewRequest(context.TODO(), buf, ParseOptimize)
@@ -250,8 +286,12 @@ func TestResponseErrorsFunc(t *testing.T) {
 		{"GET hosts\nOffset: x", "bad request: expecting a positive number in: Offset: x"},
 		{"GET hosts\nOffset: -1", "bad request: expecting a positive number in: Offset: -1"},
 		{"GET hosts\nSort: name none", "bad request: unrecognized sort direction, must be asc or desc in: Sort: name none"},
-		{"GET hosts\nResponseheader: none", "bad request: unrecognized responseformat, only fixed16 is supported in: Responseheader: none"},
-		{"GET hosts\nOutputFormat: csv: none", "bad request: unrecognized outputformat, choose from json, wrapped_json and python in: OutputFormat: csv: none"},
+		{"GET hosts\nResponseheader: none", "bad request: unrecognized responseformat, choose from fixed16 and off in: Responseheader: none"},
+		{"GET hosts\nLocaltime: none", "bad request: expecting a unix timestamp in: Localtime: none"},
+		{"GET hosts\nLocaltime: 0", "bad request: timezone difference greater than or equal to 24 hours in: Localtime: 0"},
+		{"GET hosts\nStatsNegate:", "bad request: no filter on stack to negate in: StatsNegate:"},
+		{"GET hosts\nStats: sum latency\nStatsNegate:", "bad request: only stats counter can be negated in: StatsNegate:"},
+		{"GET hosts\nOutputFormat: csv: none", "bad request: unrecognized outputformat, choose from csv, json, ndjson, wrapped_json and python in: OutputFormat: csv: none"},
 		{"GET hosts\nStatsAnd: 1", "bad request: not enough filter on stack in: StatsAnd: 1"},
 		{"GET hosts\nStatsOr: 1", "bad request: not enough filter on stack in: StatsOr: 1"},
 		{"GET hosts\nFilter: name", "bad request: filter header must be Filter: <field> <operator> <value> in: Filter: name"},
@@ -260,6 +300,12 @@ func TestResponseErrorsFunc(t *testing.T) {
 		{"GET hosts\nFilter: name !=\nAnd: x", "bad request: And must be a positive number in: And: x"},
 		{"GET hosts\nColumns: name\nFilter: custom_variables =", "bad request: custom variable filter must have form \"Filter: custom_variables <op> <variable> [<value>]\" in: Filter: custom_variables ="},
 		{"GET hosts\nKeepalive: broke", "bad request: must be 'on' or 'off' in: Keepalive: broke"},
+		{"GET hosts\nCursor: x", "bad request: invalid cursor in: Cursor: x"},
+		{"GET hosts\nCursor:\nOffset: 1", "bad request: cursor cannot be combined with offset"},
+		{"GET hosts\nCursor:\nStats: state = 0", "bad request: cursor cannot be used with stats queries"},
+		{"GET status\nCursor:", "bad request: cursor is not supported for table status"},
+		{"GET hosts\nChangedSince: x", "bad request: expecting a positive number in: ChangedSince: x"},
+		{"GET log\nChangedSince: 1", "bad request: changedsince is not supported for table log"},
 	}
 
 	for _, er := range testRequestStrings {
@@ -408,6 +454,429 @@ func TestRequestStatsGroupBy(t *testing.T) {
 	}
 }
 
+func TestRequestStatsPercentile(t *testing.T) {
+	peer := StartTestPeer(4, 10, 10)
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET services\nStats: percentile90 current_attempt\nStats: median current_attempt\nStats: stddev current_attempt\nStats: median execution_time\nStats: percentile0 execution_time\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(3), res[0][0]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(1), res[0][1]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("0.8000", fmt.Sprintf("%.4f", res[0][2])); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(0.008605999999999999, res[0][3]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(0.005842, res[0][4]); err != nil {
+		t.Error(err)
+	}
+
+	res, _, err = peer.QueryString("GET services\nColumns: state\nStats: median current_attempt\nStats: stddev current_attempt\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(2, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(1), res[0][1]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(0), res[0][2]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(3), res[1][1]); err != nil {
+		t.Error(err)
+	}
+
+	_, _, err = peer.QueryString("GET services\nStats: percentile101 current_attempt\n\n")
+	if err = assertEq("bad request: bad percentile percentile101, must be a number between 0 and 100, ex.: percentile95 in: Stats: percentile101 current_attempt", err.Error()); err != nil {
+		t.Error(err)
+	}
+
+	for _, nth := range []string{"nan", "inf", "-inf"} {
+		_, _, err = peer.QueryString("GET services\nStats: percentile" + nth + " current_attempt\n\n")
+		if err == nil {
+			t.Fatalf("expected error for percentile%s", nth)
+		}
+		if err = assertLike("bad percentile percentile"+nth+", must be a number between 0 and 100", err.Error()); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestRequestStatsCountDistinct(t *testing.T) {
+	peer := StartTestPeer(4, 10, 10)
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET services\nFilter: state = 1\nStats: count_distinct host_name\nStats: state = 1\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(2), res[0][0]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(8), res[0][1]); err != nil {
+		t.Error(err)
+	}
+
+	res, _, err = peer.QueryString("GET hosts\nStats: count_distinct contacts\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(2), res[0][0]); err != nil {
+		t.Error(err)
+	}
+
+	res, _, err = peer.QueryString("GET services\nColumns: state\nStats: count_distinct host_name\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(2, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(8), res[0][1]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(2), res[1][1]); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestRequestStatsHaving(t *testing.T) {
+	peer := StartTestPeer(4, 10, 10)
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET services\nColumns: host_name\nStats: state = 1\nStats: avg execution_time\nStatsHaving: 1 > 0\nSort: stats_2 desc\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(2, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("testhost_2", res[0][0]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(float64(4), res[0][1]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("testhost_1", res[1][0]); err != nil {
+		t.Error(err)
+	}
+
+	res, meta, err := peer.QueryString("GET services\nColumns: host_name\nStats: sum execution_time\nSort: stats_1 desc\nLimit: 3\nOutputFormat: wrapped_json\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(3, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(int64(10), meta.Total); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("testhost_5", res[0][0]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("testhost_3", res[1][0]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("testhost_2", res[2][0]); err != nil {
+		t.Error(err)
+	}
+
+	res, _, err = peer.QueryString("GET services\nColumns: host_name\nStats: state = 1\nSort: host_name desc\nOffset: 1\nLimit: 1\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("testhost_8", res[0][0]); err != nil {
+		t.Error(err)
+	}
+
+	_, _, err = peer.QueryString("GET services\nStats: state = 1\nStatsHaving: stats_2 > 1\n\n")
+	if err = assertEq("bad request: invalid stats index stats_2, must be between 1 and 1 in: StatsHaving: stats_2 > 1", err.Error()); err != nil {
+		t.Error(err)
+	}
+
+	// stats index is validated after all headers have been parsed
+	res, _, err = peer.QueryString("GET services\nColumns: host_name\nStatsHaving: stats_2 > 0\nStats: state = 1\nStats: avg execution_time\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(10, len(res)); err != nil {
+		t.Error(err)
+	}
+
+	// other sort columns of grouped stats are ignored
+	res, _, err = peer.QueryString("GET services\nColumns: host_name\nStats: state = 1\nSort: description asc\nSort: host_name desc\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(10, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("testhost_9", res[0][0]); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestRequestStatsNegate(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET services\nStats: state = 0\nStats: state = 0\nStatsNegate:\nStats: host_name = testhost_1\nStats: state = 1\nStatsAnd: 2\nStatsNegate:\nStats: host_name = testhost_1\nStats: state = 0\nStatsAnd: 2\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq([]interface{}{8.0, 2.0, 9.0, 0.0}, res[0]); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestRequestLocaltime(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	str := fmt.Sprintf("GET hosts\nColumns: name last_check\nFilter: last_check = 1557957521\nLocaltime: %d\nOutputFormat: json\n\n", time.Now().Unix()+3600)
+	req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString(str)), ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = req.ExpandRequestedBackends(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := req.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(10, len(res.Result)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq([]interface{}{"testhost_1", int64(1557957521)}, res.Result[0]); err != nil {
+		t.Error(err)
+	}
+
+	// grouped stats keys are shifted as well
+	str = fmt.Sprintf("GET hosts\nColumns: last_check\nFilter: last_check = 1557957521\nStats: state = 0\nLocaltime: %d\n\n", time.Now().Unix()+3600)
+	req, _, err = NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString(str)), ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = req.ExpandRequestedBackends(); err != nil {
+		t.Fatal(err)
+	}
+	res, err = req.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res.Result)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("1557957521", *(res.Result[0][0].(*string))); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestRequestCursor(t *testing.T) {
+	peer := StartTestPeer(2, 10, 10)
+	PauseTestPeers(peer)
+
+	for _, sort := range []string{"Sort: name asc\n", "Sort: state asc\nSort: name desc\n", ""} {
+		seen := make(map[string]bool)
+		cursor := ""
+		pages := 0
+		for {
+			query := "GET hosts\nColumns: name peer_key\n" + sort + "Limit: 3\nOutputFormat: wrapped_json\nCursor: " + cursor + "\n\n"
+			res, meta, err := peer.QueryString(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages++
+			if err = assertEq(int64(20), meta.Total); err != nil {
+				t.Error(err)
+			}
+			for _, row := range res {
+				key := fmt.Sprintf("%s:%s", row[1], row[0])
+				if seen[key] {
+					t.Errorf("row %s returned twice", key)
+				}
+				seen[key] = true
+			}
+			if meta.NextCursor == "" {
+				break
+			}
+			if err = assertEq(3, len(res)); err != nil {
+				t.Fatal(err)
+			}
+			cursor = meta.NextCursor
+		}
+		if err := assertEq(20, len(seen)); err != nil {
+			t.Errorf("%s: %s", sort, err.Error())
+		}
+		if err := assertEq(7, pages); err != nil {
+			t.Errorf("%s: %s", sort, err.Error())
+		}
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestRequestChangedSince(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	query := "GET hosts\nColumns: name\nOutputFormat: wrapped_json\nChangedSince: %d\n\n"
+	res, meta, err := peer.QueryString(fmt.Sprintf(query, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(10, len(res)); err != nil {
+		t.Error(err)
+	}
+	revision := meta.Revision
+	if revision <= 0 {
+		t.Fatalf("expected revision greater than 0, got %d", revision)
+	}
+
+	// nothing changed yet
+	res, _, err = peer.QueryString(fmt.Sprintf(query, revision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(0, len(res)); err != nil {
+		t.Error(err)
+	}
+
+	// update a single host
+	ds, err := PeerMap[PeerMapOrder[0]].GetDataStoreSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := ds.Get(TableHosts)
+	ds.Lock.Lock()
+	err = store.Index["testhost_2"].UpdateValuesNumberOnly(0, []interface{}{float64(1)}, ColumnList{store.GetColumn("state")}, time.Now().Unix())
+	ds.Lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, meta, err = peer.QueryString(fmt.Sprintf(query, revision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("testhost_2", res[0][0]); err != nil {
+		t.Error(err)
+	}
+	if meta.Revision <= revision {
+		t.Errorf("expected revision greater than %d, got %d", revision, meta.Revision)
+	}
+
+	// services of the changed host are reported as well
+	res, _, err = peer.QueryString(fmt.Sprintf("GET services\nColumns: host_name host_state\nOutputFormat: wrapped_json\nChangedSince: %d\n\n", revision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) == 0 {
+		t.Fatal("expected services of testhost_2")
+	}
+	for _, row := range res {
+		if err = assertEq([]interface{}{"testhost_2", float64(1)}, row); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// new rows are reported
+	query = "GET comments\nColumns: id\nOutputFormat: wrapped_json\nChangedSince: %d\n\n"
+	_, meta, err = peer.QueryString(fmt.Sprintf(query, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revision = meta.Revision
+	comments := ds.Get(TableComments)
+	keys, columns := comments.GetInitialColumns()
+	req := &Request{Table: TableComments, Columns: keys}
+	PeerMap[PeerMapOrder[0]].setQueryOptions(req)
+	comment, _, err := PeerMap[PeerMapOrder[0]].Query(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment = comment[:1]
+	for i, key := range keys {
+		if key == "id" {
+			comment[0][i] = float64(999)
+		}
+	}
+	if err = comments.AppendData(comment, columns); err != nil {
+		t.Fatal(err)
+	}
+	res, meta, err = peer.QueryString(fmt.Sprintf(query, revision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq([][]interface{}{{float64(999)}}, [][]interface{}(res)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(false, meta.Resync); err != nil {
+		t.Error(err)
+	}
+
+	// removed rows require a resync
+	revision = meta.Revision
+	ds.Lock.Lock()
+	comments.RemoveItem(comments.Index["999"])
+	ds.Lock.Unlock()
+	res, meta, err = peer.QueryString(fmt.Sprintf(query, revision))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(len(comments.Data), len(res)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(true, meta.Resync); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
 func TestRequestStatsEmpty(t *testing.T) {
 	peer := StartTestPeer(2, 0, 0)
 	PauseTestPeers(peer)
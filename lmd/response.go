@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -18,6 +19,12 @@ import (
 const (
 	// SpinUpPeersTimeout sets timeout to wait for peers after spin up
 	SpinUpPeersTimeout = 5 * time.Second
+
+	// SpoolMemoryLimit sets the size in bytes after which streamed fixed16 responses will be spooled to disk
+	SpoolMemoryLimit = 10 * 1024 * 1024
+
+	// StreamFlushSize sets the size in bytes after which streamed json output will be flushed
+	StreamFlushSize = 64 * 1024
 )
 
 // Response contains the livestatus response data as long with some meta data
@@ -33,6 +40,12 @@ type Response struct {
 	RowsScanned   int // total number of data rows scanned for this result
 	Failed        map[string]string
 	SelectedPeers []*Peer
+	Streaming     bool       // result rows will be gathered while writing the response
+	NextCursor    *RowCursor // position of the last returned row if there are more rows
+	Revision      int64      // data revision at the time the response has been created
+	Resync        bool       // rows have been removed since the ChangedSince revision, the result contains all rows
+	Plan          *QueryPlan // query plan for explain requests
+	Cached        []byte     // already encoded response from the result cache
 }
 
 // PeerResponse is the sub result from a peer before merged into the end result
@@ -46,10 +59,14 @@ type PeerResponse struct {
 // It returns the Response object and any error encountered.
 func NewResponse(req *Request) (res *Response, err error) {
 	res = &Response{
-		Code:    200,
-		Failed:  req.BackendErrors,
-		Request: req,
-		Lock:    new(deadlock.RWMutex),
+		Code:     200,
+		Failed:   req.BackendErrors,
+		Request:  req,
+		Lock:     new(deadlock.RWMutex),
+		Revision: atomic.LoadInt64(&dataRevision),
+	}
+	if req.Explain {
+		res.Plan = NewQueryPlan("local")
 	}
 	if res.Failed == nil {
 		res.Failed = make(map[string]string)
@@ -93,7 +110,7 @@ func NewResponse(req *Request) (res *Response, err error) {
 	}
 
 	// if all backends are down, send an error instead of an empty result
-	if res.Request.OutputFormat != OutputFormatWrappedJSON && len(res.Failed) > 0 && len(res.Failed) == len(req.Backends) {
+	if !res.Request.OutputFormat.HasMetaData() && len(res.Failed) > 0 && len(res.Failed) == len(req.Backends) {
 		res.Code = 502
 		err = &PeerError{msg: res.Failed[req.Backends[0]], kind: ConnectionError}
 		return
@@ -104,14 +121,31 @@ func NewResponse(req *Request) (res *Response, err error) {
 		// no backends selected, return empty result
 		res.Result = make(ResultSet, 0)
 		return
+	case table.PassthroughOnly && table.Name == TableLog && logCache != nil && res.BuildLogCacheResult():
+		// log requests answered from the local log cache
+		if res.Plan != nil {
+			res.Plan.Mode = "logcache"
+		}
+		res.RawResults.PostProcessing(res)
 	case table.PassthroughOnly:
 		// passthrough requests, ex.: log table
+		if res.Plan != nil {
+			res.Plan.Mode = "passthrough"
+		}
 		res.BuildPassThroughResult()
 		res.PostProcessing()
 	default:
 		// normal requests
 		res.RawResults = &RawResultSet{}
 		res.RawResults.Sort = req.Sort
+		res.RawResults.TieBreak = req.Cursor != nil
+		if req.ChangedSince > 0 {
+			res.Resync = res.requiresResync(table)
+		}
+		if res.canStream() {
+			res.Streaming = true
+			return
+		}
 		res.BuildLocalResponse()
 		res.RawResults.PostProcessing(res)
 	}
@@ -130,9 +164,12 @@ func (res *Response) Less(i, j int) bool {
 	for k := range res.Request.Sort {
 		s := res.Request.Sort[k]
 		var sortType DataType
-		if s.Group {
+		switch {
+		case s.Group:
 			sortType = StringCol
-		} else {
+		case s.Stats:
+			sortType = FloatCol
+		default:
 			sortType = res.Request.RequestColumns[s.Index].DataType
 		}
 		switch sortType {
@@ -153,12 +190,8 @@ func (res *Response) Less(i, j int) bool {
 		case JSONCol:
 			fallthrough
 		case StringCol:
-			index := s.Index
-			if s.Group {
-				index = 0
-			}
-			s1 := interface2stringNoDedup(res.Result[i][index])
-			s2 := interface2stringNoDedup(res.Result[j][index])
+			s1 := interface2stringNoDedup(res.Result[i][s.Index])
+			s2 := interface2stringNoDedup(res.Result[j][s.Index])
 			if s1 == s2 {
 				continue
 			}
@@ -228,6 +261,9 @@ func (res *Response) PostProcessing() {
 			sort.Sort(res)
 			duration := time.Since(t1)
 			logWith(res).Debugf("sorting result took %s", duration.String())
+			if res.Plan != nil {
+				res.Plan.SortDuration = duration
+			}
 		}
 	}
 
@@ -285,23 +321,60 @@ func (res *Response) CalculateFinalStats() {
 			res.Result[j][i] = finalStatsApply(s)
 
 			if res.Request.SendStatsData {
-				res.Result[j][i] = []interface{}{s.Stats, s.StatsCount}
+				res.Result[j][i] = s.StatsData()
 				continue
 			}
 		}
-		j++
 		res.RowsScanned += res.Request.StatsResult.RowsScanned
+
+		// intermediate results are filtered after merging them
+		if !res.Request.SendStatsData && !res.matchStatsHaving(res.Result[j][hasColumns:]) {
+			continue
+		}
+		j++
 	}
+	res.Result = res.Result[:j]
 
-	if hasColumns > 0 {
+	if hasColumns > 0 && len(res.Request.Sort) == 0 {
 		// Sort by stats key
 		res.Request.Sort = make([]*SortField, 0, hasColumns)
 		for i := range res.Request.Columns {
-			res.Request.Sort = append(res.Request.Sort, &SortField{Index: i, Group: true, Direction: Asc})
+			res.Request.Sort = append(res.Request.Sort, &SortField{Name: res.Request.Columns[i], Index: i, Group: true, Direction: Asc})
 		}
-		sort.Sort(res)
 	}
 	res.ResultTotal += len(res.Result)
+
+	// intermediate results are sorted and limited after merging them
+	if res.Request.SendStatsData {
+		return
+	}
+	if len(res.Request.Sort) > 0 {
+		sort.Sort(res)
+	}
+
+	// apply request offset
+	if res.Request.Offset > 0 {
+		if res.Request.Offset > len(res.Result) {
+			res.Result = make(ResultSet, 0)
+		} else {
+			res.Result = res.Result[res.Request.Offset:]
+		}
+	}
+
+	// apply request limit
+	if res.Request.Limit != nil && *res.Request.Limit >= 0 && *res.Request.Limit < len(res.Result) {
+		res.Result = res.Result[0:*res.Request.Limit]
+	}
+}
+
+// matchStatsHaving returns true if the final stats row matches all StatsHaving filters
+func (res *Response) matchStatsHaving(stats []interface{}) bool {
+	for _, h := range res.Request.StatsHaving {
+		if !h.Match(stats) {
+			return false
+		}
+	}
+	return true
 }
 
 func finalStatsApply(s *Filter) (res float64) {
@@ -320,6 +393,12 @@ func finalStatsApply(s *Filter) (res float64) {
 		} else {
 			res = 0
 		}
+	case Percentile, Median:
+		res = percentile(s.StatsValues, s.StatsPercentile)
+	case StdDev:
+		res = stdDeviation(s.Stats, s.StatsSquares, s.StatsCount)
+	case CountDistinct:
+		res = float64(len(s.StatsDistinct))
 	default:
 		log.Panicf("not implemented")
 	}
@@ -339,11 +418,17 @@ func (res *Response) Send(c net.Conn) (size int64, err error) {
 
 // SendFixed16 converts the result object to a livestatus answer and writes the resulting bytes back to the client.
 func (res *Response) SendFixed16(c net.Conn) (size int64, err error) {
-	resBuffer, err := res.Buffer()
+	// spool the response first, the size is required for the header
+	resBuffer := NewSpoolWriter(SpoolMemoryLimit)
+	defer func() {
+		LogErrors(resBuffer.Close())
+	}()
+	err = res.WriteResponse(resBuffer)
 	if err != nil {
 		return
 	}
-	size = int64(resBuffer.Len()) + 1
+	trailer := res.trailer()
+	size = resBuffer.Size + int64(len(trailer))
 	headerFixed16 := fmt.Sprintf("%d %11d", res.Code, size)
 	logWith(res).Tracef("write: %s", headerFixed16)
 	_, err = fmt.Fprintf(c, "%s\n", headerFixed16)
@@ -360,55 +445,72 @@ func (res *Response) SendFixed16(c net.Conn) (size int64, err error) {
 		return
 	}
 	localAddr := c.LocalAddr().String()
-	promFrontendBytesSend.WithLabelValues(localAddr).Add(float64(written + 1))
-	if written != size-1 {
+	promFrontendBytesSend.WithLabelValues(localAddr).Add(float64(size))
+	if written != size-int64(len(trailer)) {
 		logWith(res).Warnf("write error: written %d, size: %d", written, size)
 		return
 	}
-	_, err = c.Write([]byte("\n"))
+	_, err = c.Write(trailer)
 	return
 }
 
 // SendUnbuffered directly prints the result to the client connection
 func (res *Response) SendUnbuffered(c io.Writer) (size int64, err error) {
 	countingWriter := NewWriteCounter(c)
-	if res.Error != nil {
-		logWith(res).Warnf("sending error response: %d - %s", res.Code, res.Error.Error())
-		_, err = countingWriter.Write([]byte(res.Error.Error()))
-		if err != nil {
-			return
-		}
-		_, err = countingWriter.Write([]byte("\n"))
-		size = countingWriter.Count
-		return
-	}
-	if res.Request.OutputFormat == OutputFormatWrappedJSON {
-		err = res.WrappedJSON(countingWriter)
-	} else {
-		err = res.JSON(countingWriter)
-	}
+	err = res.WriteResponse(countingWriter)
 	if err != nil {
 		logWith(res).Warnf("write error: %s", err.Error())
 		return
 	}
-	_, err = countingWriter.Write([]byte("\n"))
+	_, err = countingWriter.Write(res.trailer())
 	size = countingWriter.Count
 	return
 }
 
+// trailer returns the bytes written after the response
+func (res *Response) trailer() []byte {
+	// csv rows are already terminated by the dataset separator
+	if res.Error == nil && res.Plan == nil && res.Request.OutputFormat == OutputFormatCSV {
+		return []byte{}
+	}
+	return []byte("\n")
+}
+
 // Buffer fills buffer with the response as bytes array
 func (res *Response) Buffer() (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
+	return buf, res.WriteResponse(buf)
+}
+
+// WriteResponse writes the response in the requested output format
+func (res *Response) WriteResponse(buf io.Writer) error {
 	if res.Error != nil {
 		logWith(res).Warnf("sending error response: %d - %s", res.Code, res.Error.Error())
-		buf.WriteString(res.Error.Error())
-		return buf, nil
+		_, err := buf.Write([]byte(res.Error.Error()))
+		return err
 	}
 
-	if res.Request.OutputFormat == OutputFormatWrappedJSON {
-		return buf, res.WrappedJSON(buf)
+	if res.Cached != nil {
+		_, err := buf.Write(res.Cached)
+		return err
+	}
+	if res.Plan != nil {
+		return res.WriteQueryPlan(buf)
 	}
-	return buf, res.JSON(buf)
+	return res.WriteResult(buf)
+}
+
+// WriteResult writes the result in the requested output format
+func (res *Response) WriteResult(buf io.Writer) error {
+	switch res.Request.OutputFormat {
+	case OutputFormatWrappedJSON:
+		return res.WrappedJSON(buf)
+	case OutputFormatCSV:
+		return res.CSV(buf)
+	case OutputFormatNDJSON:
+		return res.NDJSON(buf)
+	}
+	return res.JSON(buf)
 }
 
 // JSON converts the response into a json structure
@@ -427,10 +529,18 @@ func (res *Response) JSON(buf io.Writer) error {
 		}
 	}
 
-	res.WriteDataResponse(json)
+	var err error
+	if res.Streaming {
+		err = res.WriteStreamedDataResponse(json, sendColumnsHeader)
+	} else {
+		err = res.WriteDataResponse(json)
+	}
+	if err != nil {
+		return fmt.Errorf("JSON: %w", err)
+	}
 
 	json.WriteRaw("]")
-	err := json.Flush()
+	err = json.Flush()
 	if err != nil {
 		return fmt.Errorf("JSON: %w", err)
 	}
@@ -444,18 +554,11 @@ func (res *Response) WrappedJSON(buf io.Writer) error {
 	defer jsoniter.ConfigCompatibleWithStandardLibrary.ReturnStream(json)
 
 	json.WriteRaw("{\"data\":\n[")
-	res.WriteDataResponse(json)
-	json.WriteRaw("]\n,\"failed\": {")
-	num := 0
-	for k, v := range res.Failed {
-		if num > 0 {
-			json.WriteMore()
-		}
-		json.WriteObjectField(k)
-		json.WriteString(strings.TrimSpace(v))
-		num++
+	if err := res.WriteDataResponse(json); err != nil {
+		return fmt.Errorf("WrappedJSON: %w", err)
 	}
-	json.WriteObjectEnd()
+	json.WriteRaw("]\n,\"failed\": ")
+	res.WriteFailedResponse(json)
 
 	// add optional columns header as first row
 	if res.SendColumnsHeader() {
@@ -464,6 +567,14 @@ func (res *Response) WrappedJSON(buf io.Writer) error {
 	}
 
 	json.WriteRaw(fmt.Sprintf("\n,\"rows_scanned\":%d", res.RowsScanned))
+	if res.Request.Cursor != nil {
+		json.WriteRaw("\n,\"next_cursor\":")
+		res.WriteNextCursor(json)
+	}
+	json.WriteRaw(fmt.Sprintf("\n,\"revision\":%d", res.Revision))
+	if res.Resync {
+		json.WriteRaw("\n,\"resync\":true")
+	}
 	json.WriteRaw(fmt.Sprintf("\n,\"total_count\":%d}", res.ResultTotal))
 	err := json.Flush()
 	if err != nil {
@@ -473,14 +584,218 @@ func (res *Response) WrappedJSON(buf io.Writer) error {
 	return nil
 }
 
+// NDJSON converts the response into newline delimited json. Each row is written
+// as json array on its own line, followed by a json object line with the meta data.
+func (res *Response) NDJSON(buf io.Writer) error {
+	countingWriter := NewWriteCounter(buf)
+	json := jsoniter.ConfigCompatibleWithStandardLibrary.BorrowStream(countingWriter)
+	defer jsoniter.ConfigCompatibleWithStandardLibrary.ReturnStream(json)
+
+	if err := res.WriteDataResponse(json); err != nil {
+		return fmt.Errorf("NDJSON: %w", err)
+	}
+	if countingWriter.Count > 0 || json.Buffered() > 0 {
+		json.WriteRaw("\n")
+	}
+
+	json.WriteRaw("{\"failed\":")
+	res.WriteFailedResponse(json)
+	if res.SendColumnsHeader() {
+		json.WriteRaw(",\"columns\":")
+		json.WriteVal(res.ColumnNames())
+	}
+	json.WriteRaw(fmt.Sprintf(",\"rows_scanned\":%d", res.RowsScanned))
+	if res.Request.Cursor != nil {
+		json.WriteRaw(",\"next_cursor\":")
+		res.WriteNextCursor(json)
+	}
+	json.WriteRaw(fmt.Sprintf(",\"total_count\":%d}", res.ResultTotal))
+	err := json.Flush()
+	if err != nil {
+		return fmt.Errorf("NDJSON: %w", err)
+	}
+	json.Reset(nil)
+	return nil
+}
+
+// CSV converts the response into the livestatus csv format
+func (res *Response) CSV(buf io.Writer) error {
+	sep := res.Request.Separators
+	if sep == nil {
+		sep = &DefaultSeparators
+	}
+	line := new(bytes.Buffer)
+
+	// add optional columns header as first row
+	if res.SendColumnsHeader() {
+		for i, name := range res.ColumnNames() {
+			if i > 0 {
+				line.WriteByte(sep.Column)
+			}
+			line.WriteString(name)
+		}
+		line.WriteByte(sep.Dataset)
+	}
+
+	writeRow := func(row []interface{}) error {
+		for i := range row {
+			if i > 0 {
+				line.WriteByte(sep.Column)
+			}
+			writeCSVValue(line, row[i], sep)
+		}
+		line.WriteByte(sep.Dataset)
+		_, err := line.WriteTo(buf)
+		return err
+	}
+
+	switch {
+	case res.Streaming:
+		row := make([]interface{}, len(res.Request.RequestColumns))
+		err := res.StreamResultRows(func(rows []*DataRow) error {
+			for _, d := range rows {
+				if d.DataStore.PeerLockMode == PeerLockModeFull {
+					d.DataStore.Peer.Lock.RLock()
+				}
+				for j, col := range res.Request.RequestColumns {
+					row[j] = d.GetValueByColumn(col)
+				}
+				if d.DataStore.PeerLockMode == PeerLockModeFull {
+					d.DataStore.Peer.Lock.RUnlock()
+				}
+				if err := writeRow(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("CSV: %w", err)
+		}
+	case res.Result != nil:
+		for i := range res.Result {
+			if err := writeRow(res.Result[i]); err != nil {
+				return fmt.Errorf("CSV: %w", err)
+			}
+		}
+	case res.RawResults != nil:
+		res.ResultTotal = res.RawResults.Total
+		res.RowsScanned = res.RawResults.RowsScanned
+		row := make([]interface{}, len(res.Request.RequestColumns))
+		for _, d := range res.RawResults.DataResult {
+			if d.DataStore.PeerLockMode == PeerLockModeFull {
+				d.DataStore.Peer.Lock.RLock()
+			}
+			for j, col := range res.Request.RequestColumns {
+				row[j] = d.GetValueByColumn(col)
+			}
+			err := writeRow(row)
+			if d.DataStore.PeerLockMode == PeerLockModeFull {
+				d.DataStore.Peer.Lock.RUnlock()
+			}
+			if err != nil {
+				return fmt.Errorf("CSV: %w", err)
+			}
+		}
+	}
+
+	if _, err := line.WriteTo(buf); err != nil {
+		return fmt.Errorf("CSV: %w", err)
+	}
+	return nil
+}
+
+// writeCSVValue writes a single value in livestatus csv format
+// lists are joined by the list separator, nested lists, host/service pairs and
+// custom variables by the host/service separator
+func writeCSVValue(buf *bytes.Buffer, value interface{}, sep *Separators) {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		buf.WriteString(v)
+	case *string:
+		buf.WriteString(*v)
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		if v {
+			buf.WriteByte('1')
+		} else {
+			buf.WriteByte('0')
+		}
+	case []string:
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(sep.List)
+			}
+			buf.WriteString(v[i])
+		}
+	case []int64:
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(sep.List)
+			}
+			buf.WriteString(strconv.FormatInt(v[i], 10))
+		}
+	case []ServiceMember:
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(sep.List)
+			}
+			buf.WriteString(v[i][0])
+			buf.WriteByte(sep.HostService)
+			buf.WriteString(v[i][1])
+		}
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(sep.List)
+			}
+			buf.WriteString(k)
+			buf.WriteByte(sep.HostService)
+			buf.WriteString(v[k])
+		}
+	case []interface{}:
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(sep.List)
+			}
+			sub, ok := v[i].([]interface{})
+			if !ok {
+				writeCSVValue(buf, v[i], sep)
+				continue
+			}
+			for j := range sub {
+				if j > 0 {
+					buf.WriteByte(sep.HostService)
+				}
+				writeCSVValue(buf, sub[j], sep)
+			}
+		}
+	default:
+		buf.WriteString(fmt.Sprintf("%v", v))
+	}
+}
+
 // WriteDataResponse writes the data part of the result
-func (res *Response) WriteDataResponse(json *jsoniter.Stream) {
+func (res *Response) WriteDataResponse(json *jsoniter.Stream) error {
 	switch {
+	case res.Streaming:
+		return res.WriteStreamedDataResponse(json, false)
 	case res.Result != nil:
 		// append result row by row
 		for i := range res.Result {
 			if i > 0 {
-				json.WriteRaw(",\n")
+				json.WriteRaw(res.rowSeparator())
 				json.Flush()
 			}
 			json.WriteArrayStart()
@@ -500,12 +815,12 @@ func (res *Response) WriteDataResponse(json *jsoniter.Stream) {
 		// PeerLockModeFull means we have to lock all peers before creating the result
 		if len(res.RawResults.DataResult) > 0 && res.RawResults.DataResult[0].DataStore.PeerLockMode == PeerLockModeFull {
 			res.WriteDataResponseRowLocked(json)
-			return
+			return nil
 		}
 
 		for i := range res.RawResults.DataResult {
 			if i > 0 {
-				json.WriteRaw(",\n")
+				json.WriteRaw(res.rowSeparator())
 				json.Flush()
 			}
 			res.RawResults.DataResult[i].WriteJSON(json, res.Request.RequestColumns)
@@ -513,13 +828,14 @@ func (res *Response) WriteDataResponse(json *jsoniter.Stream) {
 	default:
 		logWith(res).Errorf("response contains no result at all")
 	}
+	return nil
 }
 
 // WriteDataResponseRowLocked appends each row but locks the peer before doing so. We don't have to lock for each column then
 func (res *Response) WriteDataResponseRowLocked(json *jsoniter.Stream) {
 	for i := range res.RawResults.DataResult {
 		if i > 0 {
-			json.WriteRaw(",\n")
+			json.WriteRaw(res.rowSeparator())
 		}
 		row := res.RawResults.DataResult[i]
 		row.DataStore.Peer.Lock.RLock()
@@ -528,9 +844,86 @@ func (res *Response) WriteDataResponseRowLocked(json *jsoniter.Stream) {
 	}
 }
 
+// WriteFailedResponse writes the failed backends as json object
+func (res *Response) WriteFailedResponse(json *jsoniter.Stream) {
+	json.WriteObjectStart()
+	num := 0
+	for k, v := range res.Failed {
+		if num > 0 {
+			json.WriteMore()
+		}
+		json.WriteObjectField(k)
+		json.WriteString(strings.TrimSpace(v))
+		num++
+	}
+	json.WriteObjectEnd()
+}
+
+// WriteNextCursor writes the cursor for the next page or null if this is the last page
+func (res *Response) WriteNextCursor(json *jsoniter.Stream) {
+	if res.NextCursor == nil {
+		json.WriteNil()
+		return
+	}
+	json.WriteString(res.NextCursor.String())
+}
+
+// rowSeparator returns the separator used between json result rows
+func (res *Response) rowSeparator() string {
+	if res.Request.OutputFormat == OutputFormatNDJSON {
+		return "\n"
+	}
+	return ",\n"
+}
+
+// WriteStreamedDataResponse gathers and writes the result rows peer by peer.
+// It returns the first write error, so the caller can abort the response.
+func (res *Response) WriteStreamedDataResponse(json *jsoniter.Stream, needSeparator bool) error {
+	err := res.StreamResultRows(func(rows []*DataRow) error {
+		for _, row := range rows {
+			if needSeparator {
+				json.WriteRaw(res.rowSeparator())
+			}
+			needSeparator = true
+			if row.DataStore.PeerLockMode == PeerLockModeFull {
+				row.DataStore.Peer.Lock.RLock()
+				row.WriteJSON(json, res.Request.RequestColumns)
+				row.DataStore.Peer.Lock.RUnlock()
+			} else {
+				row.WriteJSON(json, res.Request.RequestColumns)
+			}
+			if json.Buffered() > StreamFlushSize {
+				if err := json.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logWith(res).Warnf("streaming response failed: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
 // WriteColumnsResponse writes the columns header
 func (res *Response) WriteColumnsResponse(json *jsoniter.Stream) {
-	cols := make([]string, len(res.Request.RequestColumns)+len(res.Request.Stats))
+	cols := res.ColumnNames()
+	json.WriteArrayStart()
+	for i, s := range cols {
+		if i > 0 {
+			json.WriteMore()
+		}
+		json.WriteString(s)
+	}
+	json.WriteArrayEnd()
+	json.WriteRaw("\n")
+}
+
+// ColumnNames returns the column names used in the columns header
+func (res *Response) ColumnNames() (cols []string) {
+	cols = make([]string, len(res.Request.RequestColumns)+len(res.Request.Stats))
 	for k := 0; k < len(res.Request.RequestColumns); k++ {
 		if k < len(res.Request.Columns) {
 			cols[k] = res.Request.Columns[k]
@@ -545,15 +938,7 @@ func (res *Response) WriteColumnsResponse(json *jsoniter.Stream) {
 		buffer.WriteString(strconv.Itoa(i + 1))
 		cols[index] = buffer.String()
 	}
-	json.WriteArrayStart()
-	for i, s := range cols {
-		if i > 0 {
-			json.WriteMore()
-		}
-		json.WriteString(s)
-	}
-	json.WriteArrayEnd()
-	json.WriteRaw("\n")
+	return
 }
 
 // BuildLocalResponse builds local data table result for all selected peers
@@ -636,19 +1021,7 @@ func (res *Response) MergeStats(stats *ResultSetStats) {
 	if res.Request.StatsResult == nil {
 		res.Request.StatsResult = NewResultSetStats()
 	}
-	// apply stats queries
-	for key, stats := range stats.Stats {
-		if _, ok := res.Request.StatsResult.Stats[key]; !ok {
-			res.Request.StatsResult.Stats[key] = stats
-		} else {
-			for i := range stats {
-				s := stats[i]
-				res.Request.StatsResult.Stats[key][i].ApplyValue(s.Stats, s.StatsCount)
-			}
-		}
-	}
-	res.Request.StatsResult.Total += stats.Total
-	res.Request.StatsResult.RowsScanned += stats.RowsScanned
+	res.Request.StatsResult.Merge(stats)
 }
 
 // BuildPassThroughResult passes a query transparently to one or more remote sites and builds the response
@@ -671,6 +1044,10 @@ func (res *Response) BuildPassThroughResult() {
 	}
 	for i := range res.Request.Sort {
 		s := res.Request.Sort[i]
+		if s.Group || s.Stats {
+			// stats requests are sorted after calculating the final stats
+			continue
+		}
 		if j, ok := columnsIndex[s.Column]; ok {
 			// sort column does exist in the request columns
 			s.Index = j
@@ -723,6 +1100,88 @@ func (res *Response) BuildPassThroughResult() {
 	logWith(passthroughRequest).Debugf("waiting for passed through requests done")
 }
 
+// canStream returns true if the result rows can be written while gathering them, which
+// is possible if the rows do not have to be sorted or are requested in index order.
+func (res *Response) canStream() bool {
+	req := res.Request
+	if !res.SelectedPeers[0].GlobalConfig.StreamResponses {
+		return false
+	}
+	if nodeAccessor != nil && nodeAccessor.IsClustered() {
+		return false
+	}
+	if len(req.Stats) > 0 || req.WaitTrigger != "" || req.LocaltimeOffset != 0 || req.Cursor != nil || req.Explain {
+		return false
+	}
+	if Objects.Tables[req.Table].Virtual != nil {
+		return false
+	}
+	if len(req.Sort) > 0 && (!req.IsDefaultSortOrder() || len(res.SelectedPeers) > 1) {
+		return false
+	}
+	return true
+}
+
+// StreamResultRows gathers the result rows peer by peer and passes them to the callback
+// as soon as a peer is done. Offset and limit are applied across all peers.
+func (res *Response) StreamResultRows(fn func(rows []*DataRow) error) error {
+	req := res.Request
+	skip := req.Offset
+	remaining := -1
+	if req.Limit != nil && *req.Limit >= 0 {
+		remaining = *req.Limit
+	}
+	for _, p := range res.SelectedPeers {
+		p.StatusSet(LastQuery, time.Now().Unix())
+
+		store, err := p.GetDataStore(req.Table)
+		if err != nil {
+			res.Lock.Lock()
+			res.Failed[p.ID] = err.Error()
+			res.Lock.Unlock()
+			continue
+		}
+
+		resultcollector := make(chan *PeerResponse, 1)
+		res.BuildLocalResponseData(store, resultcollector)
+		var result *PeerResponse
+		select {
+		case result = <-resultcollector:
+		default:
+			// empty store
+			continue
+		}
+		res.ResultTotal += result.Total
+		res.RowsScanned += result.RowsScanned
+
+		rows := result.Rows
+		if skip > 0 {
+			if skip >= len(rows) {
+				skip -= len(rows)
+				continue
+			}
+			rows = rows[skip:]
+			skip = 0
+		}
+		if remaining >= 0 {
+			if remaining < len(rows) {
+				rows = rows[0:remaining]
+			}
+			remaining -= len(rows)
+		}
+		if len(rows) > 0 {
+			if err := fn(rows); err != nil {
+				return err
+			}
+		}
+		// no need to continue unless the total number is required in the meta data
+		if remaining == 0 && !req.OutputFormat.HasMetaData() {
+			break
+		}
+	}
+	return nil
+}
+
 // SendColumnsHeader determines if the response should contain the columns header
 func (res *Response) SendColumnsHeader() bool {
 	if len(res.Request.Stats) > 0 {
@@ -748,6 +1207,60 @@ func (res *Response) SetResultData() {
 	}
 }
 
+// ApplyLocaltimeOffset shifts all timestamp columns by the offset from the Localtime header.
+// Empty timestamps (0) are kept to not break "never happened" checks on client side.
+func (res *Response) ApplyLocaltimeOffset() {
+	offset := res.Request.LocaltimeOffset
+	if offset == 0 {
+		return
+	}
+	indexes := make([]int, 0)
+	for i, col := range res.Request.RequestColumns {
+		if col.IsTimestamp() {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return
+	}
+	if res.Result == nil && res.RawResults != nil {
+		res.ResultTotal = res.RawResults.Total
+		res.RowsScanned = res.RawResults.RowsScanned
+		res.SetResultData()
+	}
+	for _, row := range res.Result {
+		for _, i := range indexes {
+			if i < len(row) {
+				row[i] = shiftTimestamp(row[i], offset)
+			}
+		}
+	}
+}
+
+func shiftTimestamp(value interface{}, offset int64) interface{} {
+	switch v := value.(type) {
+	case int:
+		if v > 0 {
+			return v + int(offset)
+		}
+	case int64:
+		if v > 0 {
+			return v + offset
+		}
+	case float64:
+		if v > 0 {
+			return v + float64(offset)
+		}
+	case *string:
+		// grouped stats keys
+		if ts, err := strconv.ParseInt(*v, 10, 64); err == nil && ts > 0 {
+			str := strconv.FormatInt(ts+offset, 10)
+			return &str
+		}
+	}
+	return value
+}
+
 // SpinUpPeers starts an immediate parallel delta update for all supplied peer ids.
 func SpinUpPeers(peers []*Peer) {
 	waitgroup := &sync.WaitGroup{}
@@ -765,6 +1278,31 @@ func SpinUpPeers(peers []*Peer) {
 	log.Debugf("spin up completed")
 }
 
+// requiresResync returns true if rows of the selected peers have been removed or
+// replaced after the ChangedSince revision, so only a complete result is consistent.
+// Referenced tables are checked as well, since their columns are part of the rows.
+func (res *Response) requiresResync(table *Table) bool {
+	if table.Virtual != nil {
+		return false
+	}
+	tables := []TableName{table.Name}
+	for i := range table.RefTables {
+		tables = append(tables, table.RefTables[i].Table.Name)
+	}
+	for _, p := range res.SelectedPeers {
+		for _, name := range tables {
+			store, err := p.GetDataStore(name)
+			if err != nil {
+				continue
+			}
+			if res.Request.ChangedSince < atomic.LoadInt64(&store.ResyncRevision) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // BuildLocalResponseData returns the result data for a given request
 func (res *Response) BuildLocalResponseData(store *DataStore, resultcollector chan *PeerResponse) {
 	ds := store.DataSet
@@ -800,6 +1338,13 @@ func (res *Response) gatherResultRows(store *DataStore, resultcollector chan *Pe
 		resultcollector <- result
 	}()
 	req := res.Request
+	t1 := time.Now()
+	rows, index := store.GetPreFilteredDataAuth(req.Filter, req.AuthUser)
+	if res.Plan != nil {
+		defer func() {
+			res.Plan.AddPeer(&QueryPlanPeer{PeerKey: store.PeerKey, PeerName: store.PeerName, Index: index, RowsScanned: result.RowsScanned, RowsMatched: result.Total, Duration: time.Since(t1)})
+		}()
+	}
 
 	// if there is no sort header or sort by name only,
 	// we can drastically reduce the result set by applying the limit here already
@@ -808,11 +1353,27 @@ func (res *Response) gatherResultRows(store *DataStore, resultcollector chan *Pe
 		limit = len(store.Data) + 1
 	}
 
-	// no need to count all the way to the end unless the total number is required in wrapped_json output
-	breakOnLimit := res.Request.OutputFormat != OutputFormatWrappedJSON
+	// no need to count all the way to the end unless the total number is required in the meta data
+	breakOnLimit := !res.Request.OutputFormat.HasMetaData()
+
+	chunks := splitRows(store, rows)
+	if len(chunks) == 1 {
+		res.filterRows(rows, limit, breakOnLimit, result)
+		return
+	}
+	chunkResults := make([]*PeerResponse, len(chunks))
+	processChunks(store, chunks, func(num int, chunk []*DataRow) {
+		chunkResults[num] = &PeerResponse{}
+		res.filterRows(chunk, limit, breakOnLimit, chunkResults[num])
+	})
+	mergeChunkRows(result, chunkResults, limit)
+}
 
+// filterRows appends all rows matching the request to the result until the limit is reached
+func (res *Response) filterRows(rows []*DataRow, limit int, breakOnLimit bool, result *PeerResponse) {
+	req := res.Request
 Rows:
-	for _, row := range store.GetPreFilteredData(req.Filter) {
+	for _, row := range rows {
 		result.RowsScanned++
 
 		// does our filter match?
@@ -826,11 +1387,21 @@ Rows:
 			continue Rows
 		}
 
+		// skip rows which have not changed since the requested revision
+		if req.ChangedSince > 0 && !res.Resync && row.changedRevision() <= req.ChangedSince {
+			continue Rows
+		}
+
 		result.Total++
 
+		// skip all rows up to the cursor position
+		if req.Cursor != nil && req.Cursor.Compare(row, req.Sort) <= 0 {
+			continue Rows
+		}
+
 		// check if we have enough result rows already
 		// we still need to count how many result we would have...
-		if result.Total > limit {
+		if len(result.Rows) >= limit {
 			if breakOnLimit {
 				return
 			}
@@ -841,12 +1412,45 @@ Rows:
 }
 
 func (res *Response) gatherStatsResult(store *DataStore) *ResultSetStats {
+	req := res.Request
+	t1 := time.Now()
+	if result, ok := res.gatherTacCounterResult(store); ok {
+		if res.Plan != nil {
+			res.Plan.AddPeer(&QueryPlanPeer{PeerKey: store.PeerKey, PeerName: store.PeerName, Index: "taccounters", RowsScanned: result.RowsScanned, RowsMatched: result.Total, Duration: time.Since(t1)})
+		}
+		return result
+	}
 	result := NewResultSetStats()
+	rows, index := store.GetPreFilteredDataAuth(req.Filter, req.AuthUser)
+	if res.Plan != nil {
+		defer func() {
+			res.Plan.AddPeer(&QueryPlanPeer{PeerKey: store.PeerKey, PeerName: store.PeerName, Index: index, RowsScanned: result.RowsScanned, RowsMatched: result.Total, Duration: time.Since(t1)})
+		}()
+	}
+
+	chunks := splitRows(store, rows)
+	if len(chunks) == 1 {
+		res.countStatsRows(rows, result)
+		return result
+	}
+	chunkResults := make([]*ResultSetStats, len(chunks))
+	processChunks(store, chunks, func(num int, chunk []*DataRow) {
+		chunkResults[num] = NewResultSetStats()
+		res.countStatsRows(chunk, chunkResults[num])
+	})
+	for _, chunk := range chunkResults {
+		result.Merge(chunk)
+	}
+
+	return result
+}
+
+// countStatsRows applies the stats of all rows matching the request to the result
+func (res *Response) countStatsRows(rows []*DataRow, result *ResultSetStats) {
 	req := res.Request
 	localStats := result.Stats
-
 Rows:
-	for _, row := range store.GetPreFilteredData(req.Filter) {
+	for _, row := range rows {
 		result.RowsScanned++
 		// does our filter match?
 		for _, f := range req.Filter {
@@ -859,6 +1463,11 @@ Rows:
 			continue Rows
 		}
 
+		// skip rows which have not changed since the requested revision
+		if req.ChangedSince > 0 && !res.Resync && row.changedRevision() <= req.ChangedSince {
+			continue Rows
+		}
+
 		result.Total++
 
 		key := row.getStatsKey(res)
@@ -875,6 +1484,4 @@ Rows:
 			row.CountStats(req.StatsGrouped, stat)
 		}
 	}
-
-	return result
 }
@@ -4,8 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
+
+	jsoniter "github.com/json-iterator/go"
 )
 
 func TestRequestHeaderTableFail(t *testing.T) {
@@ -15,3 +19,224 @@ func TestRequestHeaderTableFail(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestResponseCSV(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	query := func(str string) string {
+		req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString(str)), ParseOptimize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = req.ExpandRequestedBackends(); err != nil {
+			t.Fatal(err)
+		}
+		res, err := NewResponse(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := res.Buffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	res := query("GET hosts\nColumns: name state contacts\nFilter: name = testhost_1\nOutputFormat: csv\nColumnHeaders: on\n\n")
+	if err := assertEq("name;state;contacts\ntesthost_1;0;example\n", res); err != nil {
+		t.Error(err)
+	}
+
+	res = query("GET hosts\nColumns: name services_with_state\nFilter: name = testhost_1\nOutputFormat: csv\nSeparators: 10 124 59 44\n\n")
+	if err := assertEq("testhost_1|testsvc_1,1,1\n", res); err != nil {
+		t.Error(err)
+	}
+
+	res = query("GET services\nColumns: state\nStats: state = 1\nOutputFormat: csv\n\n")
+	if err := assertEq("0;0\n1;2\n", res); err != nil {
+		t.Error(err)
+	}
+
+	_, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString("GET hosts\nSeparators: 10 59 300\n\n")), ParseOptimize)
+	if err = assertEq(errors.New("bad request: invalid separator 300, must be an ascii code between 0 and 255 in: Separators: 10 59 300"), err); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+var errWriteFailed = errors.New("write failed")
+
+// errWriter fails on every write
+type errWriter struct{}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func TestResponseStreaming(t *testing.T) {
+	peer := StartTestPeerExtra(2, 10, 10, "StreamResponses = true\n")
+	PauseTestPeers(peer)
+
+	res, _, err := peer.QueryString("GET services\nColumns: host_name description\nResponseHeader: fixed16\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(20, len(res)); err != nil {
+		t.Error(err)
+	}
+
+	// offset and limit apply across all backends
+	res, _, err = peer.QueryString("GET hosts\nColumns: name peer_key\nLimit: 3\nOffset: 9\nResponseHeader: fixed16\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(ResultSet{{"testhost_10", "mockid0"}, {"testhost_1", "mockid1"}, {"testhost_2", "mockid1"}}, res); err != nil {
+		t.Error(err)
+	}
+
+	res, meta, err := peer.QueryString("GET hosts\nColumns: name\nLimit: 5\nOutputFormat: wrapped_json\nColumnHeaders: on\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(5, len(res)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(int64(20), meta.Total); err != nil {
+		t.Error(err)
+	}
+
+	// write errors abort the response
+	req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString("GET hosts\nColumns: name\n\n")), ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = req.ExpandRequestedBackends(); err != nil {
+		t.Fatal(err)
+	}
+	response, err := NewResponse(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(true, response.Streaming); err != nil {
+		t.Fatal(err)
+	}
+	json := jsoniter.ConfigCompatibleWithStandardLibrary.BorrowStream(&errWriter{})
+	defer jsoniter.ConfigCompatibleWithStandardLibrary.ReturnStream(json)
+	json.WriteRaw(strings.Repeat(" ", StreamFlushSize))
+	if err = assertEq(errWriteFailed, response.WriteStreamedDataResponse(json, false)); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestResponseNDJSON(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString("GET hosts\nColumns: name state\nFilter: name ~ ^testhost_[12]$\nLimit: 1\nOutputFormat: ndjson\nColumnHeaders: on\n\n")), ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = req.ExpandRequestedBackends(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewResponse(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := res.Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("[\"testhost_1\",0]\n{\"failed\":{},\"columns\":[\"name\",\"state\"],\"rows_scanned\":10,\"total_count\":2}", buf.String()); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestResponseExplain(t *testing.T) {
+	peer := StartTestPeer(2, 10, 10)
+	PauseTestPeers(peer)
+
+	req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString("GET services\nColumns: host_name description\nFilter: host_name = testhost_1\nFilter: description ~~ .*SVC.*\nSort: description asc\nExplain: on\n\n")), ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = req.ExpandRequestedBackends(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := req.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := res.Buffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := make(map[string]interface{})
+	if err = json.Unmarshal(buf.Bytes(), &plan); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("local", plan["mode"]); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq([]interface{}{"Filter: host_name = testhost_1", "Filter: description_lc contains svc"}, plan["filter"]); err != nil {
+		t.Error(err)
+	}
+	peers := plan["peers"].([]interface{})
+	if err = assertEq(2, len(peers)); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range peers {
+		details := p.(map[string]interface{})
+		if err = assertEq("services.host_name", details["index"]); err != nil {
+			t.Error(err)
+		}
+		if err = assertEq(float64(1), details["rows_scanned"]); err != nil {
+			t.Error(err)
+		}
+	}
+	if err = assertEq(float64(2), plan["total_count"]); err != nil {
+		t.Error(err)
+	}
+	timings := plan["timings"].(map[string]interface{})
+	for _, phase := range []string{"filter", "sort", "encode", "total"} {
+		if _, ok := timings[phase]; !ok {
+			t.Errorf("missing timing for %s", phase)
+		}
+	}
+
+	// plans from other cluster nodes are merged into the distributed plan
+	merged := NewQueryPlan("distributed")
+	merged.AddRemotePlan("node2", plan)
+	merged.AddRemotePlan("node3", plan)
+	if err = assertEq(4, len(merged.Peers)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("node2", merged.Peers[0].Node); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq("services.host_name", merged.Peers[0].Index); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(1, merged.Peers[0].RowsScanned); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(4, merged.RemoteTotal); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// ResultCacheMaxEntrySize sets the maximum size of a single cached response in bytes.
+// Larger results will not be cached.
+const ResultCacheMaxEntrySize = 5 * 1024 * 1024
+
+// errResultCacheEntryTooLarge is returned while encoding responses which exceed the ResultCacheMaxEntrySize
+var errResultCacheEntryTooLarge = fmt.Errorf("result exceeds maximum cache entry size")
+
+// resultCache is the shared result cache, it is nil if the cache is disabled
+var resultCache *ResultCache
+
+// ResultCache caches encoded responses of identical requests until one of the
+// selected backends has been updated. Concurrent identical requests wait for
+// the first one instead of computing the same result again.
+type ResultCache struct {
+	noCopy  noCopy
+	lock    *deadlock.Mutex
+	size    int // maximum number of cached entries
+	entries map[string]*ResultCacheEntry
+}
+
+// ResultCacheEntry contains a single cached response.
+type ResultCacheEntry struct {
+	noCopy   noCopy
+	stamp    string        // revision and state of all selected backends
+	done     chan struct{} // closed once the result is available
+	uncached bool          // response has been streamed or is too large and therefore has not been cached
+	data     []byte
+	code     int
+	err      error
+	lastUsed time.Time
+}
+
+// NewResultCache creates a new result cache with up to size entries.
+// It returns nil if size is not greater than 0.
+func NewResultCache(size int) *ResultCache {
+	if size <= 0 {
+		return nil
+	}
+	return &ResultCache{
+		lock:    new(deadlock.Mutex),
+		size:    size,
+		entries: make(map[string]*ResultCacheEntry),
+	}
+}
+
+// GetResponse returns the cached response for this request or computes it if there is
+// no valid cache entry. The build function is called at most once for concurrent requests.
+func (c *ResultCache) GetResponse(req *Request, build func() (*Response, error)) (*Response, error) {
+	key := req.cacheKey()
+	// cached results still count as queries, idling backends have to be woken up
+	// before the stamp is taken, since they will update their data
+	req.touchPeers()
+	stamp := req.cacheStamp()
+
+	c.lock.Lock()
+	entry, ok := c.entries[key]
+	if ok && entry.stamp == stamp {
+		entry.lastUsed = time.Now()
+		c.lock.Unlock()
+		<-entry.done
+		if entry.uncached {
+			return build()
+		}
+		promResultCacheHits.Inc()
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return &Response{Code: entry.code, Request: req, Cached: entry.data, Lock: new(deadlock.RWMutex)}, nil
+	}
+	entry = &ResultCacheEntry{
+		stamp:    stamp,
+		done:     make(chan struct{}),
+		lastUsed: time.Now(),
+	}
+	c.evict()
+	c.entries[key] = entry
+	c.lock.Unlock()
+	promResultCacheMisses.Inc()
+
+	res, err := c.build(entry, build)
+
+	// do not keep failed, partial, streamed, huge or outdated results
+	if err != nil || entry.uncached || len(res.Failed) > 0 || req.cacheStamp() != stamp {
+		c.lock.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.lock.Unlock()
+	}
+	return res, err
+}
+
+// build computes and encodes the response for a new cache entry
+func (c *ResultCache) build(entry *ResultCacheEntry, build func() (*Response, error)) (res *Response, err error) {
+	// waiting requests must not block forever, even if building the response panics
+	defer func() {
+		entry.err = err
+		close(entry.done)
+	}()
+	res, err = build()
+	if err != nil {
+		return
+	}
+	// streamed responses are written while gathering the rows, buffering them would defeat that
+	if res.Streaming {
+		entry.uncached = true
+		return
+	}
+	buf := &resultCacheBuffer{limit: ResultCacheMaxEntrySize}
+	err = res.WriteResponse(buf)
+	if errors.Is(err, errResultCacheEntryTooLarge) {
+		// huge responses are written directly to the client instead
+		entry.uncached = true
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	entry.data = buf.Bytes()
+	entry.code = res.Code
+	res.Cached = entry.data
+	return
+}
+
+// resultCacheBuffer is a bytes.Buffer which fails as soon as the limit is exceeded,
+// so large responses are never kept in memory completely
+type resultCacheBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+// Write appends p to the buffer unless the limit would be exceeded
+func (b *resultCacheBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errResultCacheEntryTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// evict removes the least recently used entry if the cache is full, lock must be held
+func (c *ResultCache) evict() {
+	if len(c.entries) < c.size {
+		return
+	}
+	oldestKey := ""
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if oldestKey == "" || entry.lastUsed.Before(oldest) {
+			oldestKey = key
+			oldest = entry.lastUsed
+		}
+	}
+	delete(c.entries, oldestKey)
+}
+
+// IsCacheable returns true if the result of this request may be served from the result cache.
+func (req *Request) IsCacheable() bool {
+	if req.Command != "" || req.WaitTrigger != "" || req.Explain {
+		return false
+	}
+	if nodeAccessor != nil && nodeAccessor.IsClustered() {
+		return false
+	}
+	table := Objects.Tables[req.Table]
+	// virtual tables change without backend updates and passthrough tables are not stored at all
+	if table.Virtual != nil || table.PassthroughOnly {
+		return false
+	}
+	return true
+}
+
+// cacheKey returns the normalized request string used as cache key
+func (req *Request) cacheKey() string {
+	key := req.String()
+	// connection options do not change the result
+	key = strings.Replace(key, "ResponseHeader: fixed16\n", "", 1)
+	key = strings.Replace(key, "KeepAlive: on\n", "", 1)
+	return fmt.Sprintf("%sLocaltimeOffset: %d\n", key, req.LocaltimeOffset)
+}
+
+// touchPeers sets the last query timestamp of all selected backends and spins up idling backends
+func (req *Request) touchPeers() {
+	now := time.Now().Unix()
+	spinUpPeers := make([]*Peer, 0)
+	PeerMapLock.RLock()
+	for id := range req.BackendsMap {
+		p, ok := PeerMap[id]
+		if !ok || p.HasFlag(MultiBackend) {
+			continue
+		}
+		if nodeAccessor == nil || !nodeAccessor.IsOurBackend(p.ID) {
+			continue
+		}
+		p.StatusSet(LastQuery, now)
+		if p.StatusGet(Idling).(bool) {
+			spinUpPeers = append(spinUpPeers, p)
+		}
+	}
+	PeerMapLock.RUnlock()
+	if len(spinUpPeers) > 0 {
+		SpinUpPeers(spinUpPeers)
+	}
+}
+
+// cacheStamp returns the update state of all requested backends. The revision of a backend
+// is incremented after its rows have been changed, so results built from outdated data
+// will not match anymore.
+func (req *Request) cacheStamp() string {
+	ids := make([]string, 0, len(req.BackendsMap))
+	for id := range req.BackendsMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var stamp strings.Builder
+	PeerMapLock.RLock()
+	defer PeerMapLock.RUnlock()
+	for _, id := range ids {
+		p, ok := PeerMap[id]
+		if !ok {
+			continue
+		}
+		p.Lock.RLock()
+		stamp.WriteString(fmt.Sprintf("%s:%d:%d:%d;", id, p.Status[PeerState], p.Status[LastUpdate], atomic.LoadInt64(&p.revision)))
+		p.Lock.RUnlock()
+	}
+	return stamp.String()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestResultCache(t *testing.T) {
+	peer := StartTestPeerExtra(2, 10, 10, "ResultCacheSize = 10\n")
+	PauseTestPeers(peer)
+
+	query := "GET hosts\nColumns: name state\nFilter: name ~ testhost_1\nOutputFormat: json\n\n"
+	hits := testutil.ToFloat64(promResultCacheHits)
+	misses := testutil.ToFloat64(promResultCacheMisses)
+
+	res1, _, err := peer.QueryString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2, _, err := peer.QueryString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(res1, res2); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(hits+1, testutil.ToFloat64(promResultCacheHits)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(misses+1, testutil.ToFloat64(promResultCacheMisses)); err != nil {
+		t.Error(err)
+	}
+
+	// queries on temporary stores do not invalidate the cache
+	_, _, err = peer.QueryString("GET sites\nColumns: name status\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = peer.QueryString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(hits+2, testutil.ToFloat64(promResultCacheHits)); err != nil {
+		t.Error(err)
+	}
+
+	// data updates invalidate the cache
+	PeerMapLock.RLock()
+	for _, p := range PeerMap {
+		atomic.AddInt64(&p.revision, 1)
+	}
+	PeerMapLock.RUnlock()
+	_, _, err = peer.QueryString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(misses+2, testutil.ToFloat64(promResultCacheMisses)); err != nil {
+		t.Error(err)
+	}
+
+	// concurrent requests are computed only once
+	builds := 0
+	lock := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 5; i++ {
+		req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString("GET hosts\nColumns: name\n\n")), ParseOptimize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = req.ExpandRequestedBackends(); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(req *Request) {
+			defer wg.Done()
+			res, err := resultCache.GetResponse(req, func() (*Response, error) {
+				lock.Lock()
+				builds++
+				lock.Unlock()
+				time.Sleep(100 * time.Millisecond)
+				return req.buildResponse()
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err = assertEq(20, bytes.Count(res.Cached, []byte("testhost_"))); err != nil {
+				t.Error(err)
+			}
+		}(req)
+	}
+	wg.Wait()
+	if err = assertEq(1, builds); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestResultCacheStreaming(t *testing.T) {
+	peer := StartTestPeerExtra(2, 10, 10, "ResultCacheSize = 10\nStreamResponses = true\n")
+	PauseTestPeers(peer)
+
+	query := "GET hosts\nColumns: name state\nOutputFormat: json\n\n"
+	hits := testutil.ToFloat64(promResultCacheHits)
+	for i := 0; i < 2; i++ {
+		res, _, err := peer.QueryString(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = assertEq(20, len(res)); err != nil {
+			t.Error(err)
+		}
+	}
+	// streamed responses are not cached
+	if err := assertEq(hits, testutil.ToFloat64(promResultCacheHits)); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(0, len(resultCache.entries)); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
+
+func TestResultCacheBuffer(t *testing.T) {
+	buf := &resultCacheBuffer{limit: 5}
+	if _, err := buf.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	// writes exceeding the limit are rejected
+	if _, err := buf.Write([]byte("def")); err != errResultCacheEntryTooLarge {
+		t.Errorf("expected errResultCacheEntryTooLarge, got: %v", err)
+	}
+	if err := assertEq("abc", buf.String()); err != nil {
+		t.Error(err)
+	}
+}
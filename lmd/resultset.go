@@ -25,6 +25,21 @@ func NewResultSetStats() *ResultSetStats {
 	return &res
 }
 
+// Merge adds the intermediate stats result from another ResultSetStats
+func (r *ResultSetStats) Merge(o *ResultSetStats) {
+	for key, stats := range o.Stats {
+		if _, ok := r.Stats[key]; !ok {
+			r.Stats[key] = stats
+			continue
+		}
+		for i := range stats {
+			r.Stats[key][i].MergeStats(stats[i])
+		}
+	}
+	r.Total += o.Total
+	r.RowsScanned += o.RowsScanned
+}
+
 // NewResultSet parses resultset from given bytes
 func NewResultSet(data []byte) (res ResultSet, err error) {
 	res = make(ResultSet, 0)
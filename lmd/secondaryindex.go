@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SecondaryIndex maps the values of a column to the rows containing this value.
+// It is maintained on insert, update and removal of rows and used to reduce the
+// number of rows which have to be filtered.
+type SecondaryIndex struct {
+	noCopy    noCopy
+	Name      string  // definition from the config, ex.: services.check_command
+	Column    *Column // indexed column
+	CustomVar string  // name of the custom variable for custom variable indexes
+	rows      map[string]map[*DataRow]struct{}
+	values    map[*DataRow][]string
+}
+
+// parseSecondaryIndexDefinition parses an index definition like <table>.<column> or
+// <table>.custom_variables.<NAME>. It returns the table, the column and the custom variable name.
+func parseSecondaryIndexDefinition(definition string) (table *Table, col *Column, customVar string, err error) {
+	parts := strings.SplitN(definition, ".", 3)
+	if len(parts) < 2 {
+		err = fmt.Errorf("invalid index %s, must be <table>.<column>", definition)
+		return
+	}
+	tableName, err := NewTableName(parts[0])
+	if err != nil {
+		err = fmt.Errorf("invalid index %s: %s", definition, err.Error())
+		return
+	}
+	table = Objects.Tables[tableName]
+	if table.Virtual != nil || table.PassthroughOnly {
+		err = fmt.Errorf("invalid index %s, table %s cannot be indexed", definition, table.Name.String())
+		return
+	}
+	col, ok := table.ColumnsIndex[parts[1]]
+	if !ok {
+		err = fmt.Errorf("invalid index %s, no such column", definition)
+		return
+	}
+	if col.DataType == CustomVarCol {
+		if len(parts) != 3 || parts[2] == "" {
+			err = fmt.Errorf("invalid index %s, must be <table>.%s.<name>", definition, col.Name)
+			return
+		}
+		customVar = strings.ToUpper(parts[2])
+		return
+	}
+	if len(parts) != 2 {
+		err = fmt.Errorf("invalid index %s, must be <table>.<column>", definition)
+		return
+	}
+	if col.StorageType != LocalStore {
+		err = fmt.Errorf("invalid index %s, only local columns can be indexed", definition)
+		return
+	}
+	switch col.DataType {
+	case StringCol, StringListCol, IntCol, Int64Col:
+	default:
+		err = fmt.Errorf("invalid index %s, unsupported column type %s", definition, col.DataType.String())
+	}
+	return
+}
+
+// NewSecondaryIndex creates a new empty index from the given definition.
+func NewSecondaryIndex(definition string) (*SecondaryIndex, *Table, error) {
+	table, col, customVar, err := parseSecondaryIndexDefinition(definition)
+	if err != nil {
+		return nil, nil, err
+	}
+	index := &SecondaryIndex{
+		Name:      definition,
+		Column:    col,
+		CustomVar: customVar,
+		rows:      make(map[string]map[*DataRow]struct{}),
+		values:    make(map[*DataRow][]string),
+	}
+	return index, table, nil
+}
+
+// keys returns the indexed values of a row
+func (idx *SecondaryIndex) keys(row *DataRow) []string {
+	col := idx.Column
+	if col.StorageType == RefStore && row.Refs[col.RefColTableName] == nil {
+		// references are not set yet
+		return nil
+	}
+	if idx.CustomVar != "" {
+		val := row.GetCustomVarValue(col, idx.CustomVar)
+		if val == "" {
+			return nil
+		}
+		return []string{val}
+	}
+	switch col.DataType {
+	case StringListCol:
+		return row.GetStringList(col)
+	case IntCol:
+		return []string{strconv.Itoa(row.GetInt(col))}
+	case Int64Col:
+		return []string{strconv.FormatInt(row.GetInt64(col), 10)}
+	default:
+		return []string{row.GetString(col)}
+	}
+}
+
+// update adds the row to the index or moves it if the indexed values have changed
+func (idx *SecondaryIndex) update(row *DataRow) {
+	keys := idx.keys(row)
+	old, exists := idx.values[row]
+	if exists && stringListEqual(old, keys) {
+		return
+	}
+	idx.remove(row)
+	for _, key := range keys {
+		rows, ok := idx.rows[key]
+		if !ok {
+			rows = make(map[*DataRow]struct{})
+			idx.rows[key] = rows
+		}
+		rows[row] = struct{}{}
+	}
+	idx.values[row] = keys
+}
+
+// remove removes the row from the index
+func (idx *SecondaryIndex) remove(row *DataRow) {
+	old, ok := idx.values[row]
+	if !ok {
+		return
+	}
+	for _, key := range old {
+		delete(idx.rows[key], row)
+		if len(idx.rows[key]) == 0 {
+			delete(idx.rows, key)
+		}
+	}
+	delete(idx.values, row)
+}
+
+// lookup returns all rows possibly matching the filter. It returns false if the index cannot be used.
+func (idx *SecondaryIndex) lookup(f *Filter) (map[*DataRow]struct{}, bool) {
+	if f.Column != idx.Column || f.Negate {
+		return nil, false
+	}
+	key := f.StrValue
+	switch {
+	case idx.CustomVar != "":
+		if f.Operator != Equal || f.CustomTag != idx.CustomVar {
+			return nil, false
+		}
+		// empty values are not indexed, missing variables match as well
+		if f.IsEmpty || f.StrValue == "" {
+			return nil, false
+		}
+	case f.Column.DataType == StringListCol:
+		if f.Operator != GreaterThan {
+			return nil, false
+		}
+	case f.Column.DataType == IntCol || f.Column.DataType == Int64Col:
+		if f.Operator != Equal || f.IsEmpty {
+			return nil, false
+		}
+		key = strconv.FormatInt(int64(f.FloatValue), 10)
+	default:
+		if f.Operator != Equal {
+			return nil, false
+		}
+	}
+	return idx.rows[key], true
+}
+
+// updateSecondaryIndexes updates all secondary indexes of this store for the given row
+func (d *DataStore) updateSecondaryIndexes(row *DataRow) {
+	for _, idx := range d.SecondaryIndexes {
+		idx.update(row)
+	}
+}
+
+// trySecondaryIndexData returns the rows found by the secondary indexes or nil if no index can be used.
+// The rows are returned in the same order as in the store.
+func (d *DataStore) trySecondaryIndexData(filter []*Filter) ([]*DataRow, string) {
+	if len(d.SecondaryIndexes) == 0 {
+		return nil, ""
+	}
+	rows, index, ok := d.secondaryIndexAnd(filter)
+	if !ok {
+		return nil, ""
+	}
+	data := make([]*DataRow, 0, len(rows))
+	for row := range rows {
+		data = append(data, row)
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].seq < data[j].seq
+	})
+	log.Tracef("using secondary index %s with dataset of size: %d", index, len(data))
+	return data, index
+}
+
+// secondaryIndexAnd returns the smallest set of rows from all usable indexes of the and combined filter
+func (d *DataStore) secondaryIndexAnd(filter []*Filter) (result map[*DataRow]struct{}, index string, found bool) {
+	for _, f := range filter {
+		rows, name, ok := d.secondaryIndexFilter(f)
+		if !ok {
+			continue
+		}
+		if !found || len(rows) < len(result) {
+			result = rows
+			index = name
+			found = true
+		}
+	}
+	return
+}
+
+// secondaryIndexOr returns the union of all rows of the or combined filter, it requires an index for each filter
+func (d *DataStore) secondaryIndexOr(filter []*Filter) (result map[*DataRow]struct{}, index string, found bool) {
+	result = make(map[*DataRow]struct{})
+	names := make([]string, 0)
+	for _, f := range filter {
+		rows, name, ok := d.secondaryIndexFilter(f)
+		if !ok {
+			return nil, "", false
+		}
+		for row := range rows {
+			result[row] = struct{}{}
+		}
+		names = append(names, name)
+	}
+	return result, strings.Join(names, ","), len(names) > 0
+}
+
+// secondaryIndexFilter returns the rows for a single filter or filter group
+func (d *DataStore) secondaryIndexFilter(f *Filter) (map[*DataRow]struct{}, string, bool) {
+	if f.Negate {
+		return nil, "", false
+	}
+	if len(f.Filter) > 0 {
+		switch f.GroupOperator {
+		case And:
+			return d.secondaryIndexAnd(f.Filter)
+		case Or:
+			return d.secondaryIndexOr(f.Filter)
+		}
+		return nil, "", false
+	}
+	for _, idx := range d.SecondaryIndexes {
+		if rows, ok := idx.lookup(f); ok {
+			return rows, idx.Name, true
+		}
+	}
+	return nil, "", false
+}
+
+// stringListEqual returns true if both lists contain the same elements in the same order
+func stringListEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
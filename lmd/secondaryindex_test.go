@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"testing"
+)
+
+func testSecondaryIndexFilter(t *testing.T, query string) []*Filter {
+	t.Helper()
+	req, _, err := NewRequest(context.TODO(), bufio.NewReader(bytes.NewBufferString(query)), ParseOptimize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req.Filter
+}
+
+// testSecondaryIndexLookup verifies the used index and compares the prefiltered rows with a full table scan
+func testSecondaryIndexLookup(t *testing.T, store *DataStore, query, expectedIndex string) []*DataRow {
+	t.Helper()
+	filter := testSecondaryIndexFilter(t, query)
+	data, index := store.GetPreFilteredDataIndex(filter)
+	if err := assertEq(expectedIndex, index); err != nil {
+		t.Error(err)
+	}
+	matching := func(rows []*DataRow) (result []*DataRow) {
+		for _, row := range rows {
+			match := true
+			for _, f := range filter {
+				if !row.MatchFilter(f) {
+					match = false
+					break
+				}
+			}
+			if match {
+				result = append(result, row)
+			}
+		}
+		return
+	}
+	expected := matching(store.Data)
+	got := matching(data)
+	if len(expected) == 0 {
+		t.Errorf("query does not match any row: %s", query)
+	}
+	if err := assertEq(expected, got); err != nil {
+		t.Error(err)
+	}
+	return got
+}
+
+func TestSecondaryIndex(t *testing.T) {
+	extraConfig := `
+		SecondaryIndexes = ["services.check_command", "hosts.state", "services.host_custom_variables.TEST", "hosts.contacts", "hosts.nosuchcolumn"]
+	`
+	peer := StartTestPeerExtra(1, 10, 10, extraConfig)
+	PauseTestPeers(peer)
+
+	PeerMapLock.RLock()
+	p := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+
+	ds, err := p.GetDataStoreSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := ds.Get(TableHosts)
+	services := ds.Get(TableServices)
+	if err = assertEq(2, len(hosts.SecondaryIndexes)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(2, len(services.SecondaryIndexes)); err != nil {
+		t.Fatal(err)
+	}
+
+	ds.Lock.RLock()
+	testSecondaryIndexLookup(t, services, "GET services\nFilter: check_command = check_http\n\n", "services.check_command")
+	testSecondaryIndexLookup(t, services, "GET services\nFilter: host_custom_variables = TEST 1\n\n", "services.host_custom_variables.TEST")
+	testSecondaryIndexLookup(t, hosts, "GET hosts\nFilter: contacts >= example\nFilter: state = 0\nOr: 2\n\n", "hosts.contacts,hosts.state")
+
+	// empty custom variables are not indexed, so the index cannot be used to find them
+	_, index := services.GetPreFilteredDataIndex(testSecondaryIndexFilter(t, "GET services\nFilter: host_custom_variables = TEST\n\n"))
+	if err = assertEq("", index); err != nil {
+		t.Error(err)
+	}
+
+	// negated filter cannot use the index
+	testSecondaryIndexLookup(t, hosts, "GET hosts\nFilter: state != 1\n\n", "")
+
+	ds.Lock.RUnlock()
+
+	// index follows updates
+	err = updateTestRow(ds, TableHosts, []string{"testhost_1"}, "state", float64(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds.Lock.RLock()
+	data := testSecondaryIndexLookup(t, hosts, "GET hosts\nFilter: state = 1\n\n", "hosts.state")
+	if err = assertEq(1, len(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq("testhost_1", data[0].GetStringByName("name")); err != nil {
+		t.Error(err)
+	}
+	ds.Lock.RUnlock()
+
+	res, _, err := peer.QueryString("GET hosts\nColumns: name\nFilter: state = 0\nOutputFormat: json\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(9, len(res)); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// snapshotRunning is set while snapshots are written to prevent overlapping runs
+var snapshotRunning int32
+
+// snapshotFile returns the path of the snapshot tarball for the given peer
+func snapshotFile(dir string, p *Peer) string {
+	return filepath.Join(dir, fmt.Sprintf("snapshot-%s.tar.gz", strings.ReplaceAll(p.ID, string(os.PathSeparator), "_")))
+}
+
+// writeSnapshots persists the data of all online peers into the state directory
+func writeSnapshots(dir string) {
+	if !atomic.CompareAndSwapInt32(&snapshotRunning, 0, 1) {
+		log.Debugf("skipping snapshot, previous snapshot is still running")
+		return
+	}
+	defer atomic.StoreInt32(&snapshotRunning, 0)
+
+	err := os.MkdirAll(dir, DefaultDirPerm)
+	if err != nil {
+		log.Warnf("failed to create state directory: %s", err.Error())
+		return
+	}
+
+	peers := make([]*Peer, 0)
+	PeerMapLock.RLock()
+	for _, id := range PeerMapOrder {
+		p := PeerMap[id]
+		// sub peers will be recreated by their parent
+		if p.ParentID != "" || p.HasFlag(MultiBackend) {
+			continue
+		}
+		if nodeAccessor == nil || !nodeAccessor.IsOurBackend(p.ID) {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	PeerMapLock.RUnlock()
+
+	for _, p := range peers {
+		if err := writeStateChanges(p, dir); err != nil {
+			logWith(p).Warnf("failed to write state changes: %s", err.Error())
+		}
+
+		// only persist fully synchronized data
+		if !p.hasPeerState([]PeerStatus{PeerStatusUp}) {
+			continue
+		}
+		t1 := time.Now()
+		err := writeSnapshot(p, dir)
+		if err != nil {
+			logWith(p).Warnf("failed to write snapshot: %s", err.Error())
+			continue
+		}
+		logWith(p).Debugf("snapshot written in %s", time.Since(t1).String())
+	}
+}
+
+// writeSnapshot writes the data of a single peer into the state directory
+func writeSnapshot(p *Peer, dir string) (err error) {
+	file := snapshotFile(dir, p)
+	tmpFile := file + ".tmp"
+	ex := &Exporter{config: p.GlobalConfig}
+	err = ex.writeTarball(tmpFile, func() error {
+		_, err := ex.exportPeer(p)
+		return err
+	})
+	if err != nil {
+		LogErrors(os.Remove(tmpFile))
+		return
+	}
+	// replace the old snapshot atomically
+	return os.Rename(tmpFile, file)
+}
+
+// restoreSnapshot loads the peer data from its snapshot in the state directory. The
+// peer will be marked as stale until the first synchronization has finished.
+// It returns false if there is no snapshot for this peer.
+func restoreSnapshot(p *Peer, dir string) (restored bool, err error) {
+	file := snapshotFile(dir, p)
+	stat, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	data := NewDataStoreSet(p)
+	err = readTarball(file, func(header *tar.Header, tarReader io.Reader) error {
+		matches := reImportFileTable.FindStringSubmatch(header.Name)
+		if len(matches) != 2 {
+			return fmt.Errorf("no idea what to do with file: %s", header.Name)
+		}
+		table, rows, columns, err := importReadFile(matches[1], tarReader, header.Size)
+		if err != nil {
+			return err
+		}
+		if table.Name == TableSites {
+			if len(rows) != 1 {
+				return fmt.Errorf("wrong number of site rows, expected 1 but got: %d", len(rows))
+			}
+			// flags are required to create the stores with the correct optional columns
+			restoreSnapshotFlags(p, rows[0], columns)
+			return nil
+		}
+		store := NewDataStore(table, p)
+		store.DataSet = data
+		err = store.InsertData(rows, columns, false)
+		if err != nil {
+			return fmt.Errorf("failed to insert data: %s", err)
+		}
+		data.Set(table.Name, store)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	err = data.SetReferences()
+	if err != nil {
+		return
+	}
+	err = data.RebuildCommentsList()
+	if err != nil {
+		return
+	}
+	err = data.RebuildDowntimesList()
+	if err != nil {
+		return
+	}
+
+	p.Lock.Lock()
+	p.SetDataStoreSet(data, false)
+	p.Status[PeerState] = PeerStatusWarning
+	p.Status[SnapshotData] = true
+	p.Status[LastOnline] = time.Now().Unix()
+	p.Status[LastError] = fmt.Sprintf("serving stale data from snapshot created at %s", stat.ModTime().Format(time.RFC3339))
+	p.Lock.Unlock()
+	logWith(p).Infof("restored data from snapshot %s", file)
+	return true, nil
+}
+
+// restoreSnapshotFlags sets the peer flags from the exported sites row
+func restoreSnapshotFlags(p *Peer, row []interface{}, columns ColumnList) {
+	for i, col := range columns {
+		if col.Name != "flags" {
+			continue
+		}
+		for _, name := range interface2stringlist(row[i]) {
+			for flag, flagName := range OptionalFlagsStrings {
+				if flagName == name {
+					p.SetFlag(flag)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	dir, err := ioutil.TempDir("", "lmd-snapshot-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	PeerMapLock.RLock()
+	source := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+
+	if err = writeSnapshot(source, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// restore into a new peer with the same id
+	con := &Connection{ID: source.ID, Name: source.Name, Source: source.Source}
+	p := NewPeer(source.GlobalConfig, con, &sync.WaitGroup{}, make(chan bool))
+	restored, err := restoreSnapshot(p, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(true, restored); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(PeerStatusWarning, p.StatusGet(PeerState)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(source.Flags, p.Flags); err != nil {
+		t.Error(err)
+	}
+	for _, table := range []TableName{TableHosts, TableServices} {
+		store, err := p.GetDataStore(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = assertEq(10, len(store.Data)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// the next update replaces the snapshot data completely
+	if err = assertEq(true, p.StatusGet(SnapshotData)); err != nil {
+		t.Error(err)
+	}
+	if err = p.periodicUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(false, p.StatusGet(SnapshotData)); err != nil {
+		t.Error(err)
+	}
+	if err = assertNeq(int64(0), p.StatusGet(ProgramStart)); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(PeerStatusUp, p.StatusGet(PeerState)); err != nil {
+		t.Error(err)
+	}
+
+	// missing snapshots are no error
+	con = &Connection{ID: "none", Name: "none", Source: source.Source}
+	restored, err = restoreSnapshot(NewPeer(source.GlobalConfig, con, &sync.WaitGroup{}, make(chan bool)), dir)
+	if err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(false, restored); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// SourceRetryInterval sets the seconds after which a failed source is used again
+	SourceRetryInterval = 30
+
+	// SourceLatencyWeight sets the weight of the latest response time in the latency moving average
+	SourceLatencyWeight = 0.3
+
+	// SourceLatencyMinimum is added to the latency, so idle sources without measurements are still rated by running queries
+	SourceLatencyMinimum = 0.001
+
+	// SourceSwitchFactor sets how many times faster another source has to be before the updates are moved to it.
+	// Switching the update source requires a full update.
+	SourceSwitchFactor = 2
+)
+
+// SourceHealth contains the health status of a single source of a peer.
+type SourceHealth struct {
+	Addr          string  `json:"addr"`
+	Healthy       bool    `json:"healthy"`
+	Latency       float64 `json:"latency"` // moving average of the response time in seconds
+	Active        int64   `json:"active"`  // number of currently running queries
+	Queries       int64   `json:"queries"`
+	Errors        int64   `json:"errors"`
+	LastError     string  `json:"last_error"`
+	LastErrorTime int64   `json:"last_error_time"`
+	LastOnline    int64   `json:"last_online"`
+}
+
+// SourceBalancer tracks the health of all sources of a peer. For load balanced
+// peers it selects the source for each query.
+type SourceBalancer struct {
+	noCopy  noCopy
+	lock    *deadlock.Mutex
+	sources []*SourceHealth
+	next    int // start index of the next selection, rotates to spread queries across equally rated sources
+}
+
+// NewSourceBalancer creates a new SourceBalancer, all sources start healthy.
+func NewSourceBalancer(sources []string) *SourceBalancer {
+	b := &SourceBalancer{
+		lock:    new(deadlock.Mutex),
+		sources: make([]*SourceHealth, len(sources)),
+	}
+	for i, addr := range sources {
+		b.sources[i] = &SourceHealth{Addr: addr, Healthy: true}
+	}
+	return b
+}
+
+// Pick returns the number of the best source which is not excluded.
+// Healthy sources are rated by latency and running queries. Failed sources are used
+// again after SourceRetryInterval or if there is no other source left.
+// It returns -1 if all sources are excluded.
+func (b *SourceBalancer) Pick(exclude map[int]bool) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.pick(exclude)
+}
+
+// pick implements Pick, the lock must be held
+func (b *SourceBalancer) pick(exclude map[int]bool) int {
+	now := time.Now().Unix()
+	best := -1
+	bestScore := float64(0)
+	fallback := -1
+	num := len(b.sources)
+	for x := 0; x < num; x++ {
+		i := (b.next + x) % num
+		if exclude[i] {
+			continue
+		}
+		source := b.sources[i]
+		if !source.Healthy && source.LastErrorTime > now-SourceRetryInterval {
+			if fallback == -1 || source.LastErrorTime < b.sources[fallback].LastErrorTime {
+				fallback = i
+			}
+			continue
+		}
+		score := (source.Latency + SourceLatencyMinimum) * float64(source.Active+1)
+		if !source.Healthy {
+			// retry interval passed, give it a chance to recover
+			score = 0
+		}
+		if best == -1 || score < bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+	if best == -1 {
+		best = fallback
+	}
+	if best != -1 {
+		b.next = (best + 1) % num
+	}
+	return best
+}
+
+// PickUpdateSource returns the number of the source used for the updates. The current
+// source is kept as long as it is healthy and no other source is SourceSwitchFactor
+// times faster. Otherwise the best source is returned like from Pick.
+func (b *SourceBalancer) PickUpdateSource(current int) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if current < 0 || current >= len(b.sources) || !b.sources[current].Healthy {
+		return b.pick(nil)
+	}
+	best := current
+	bestLatency := b.sources[current].Latency / SourceSwitchFactor
+	for i, source := range b.sources {
+		// sources without measurements are not rated yet
+		if !source.Healthy || source.Latency == 0 {
+			continue
+		}
+		if source.Latency < bestLatency {
+			best = i
+			bestLatency = source.Latency
+		}
+	}
+	return best
+}
+
+// Start marks a query on the given source as running.
+func (b *SourceBalancer) Start(num int) {
+	if num < 0 || num >= len(b.sources) {
+		return
+	}
+	b.lock.Lock()
+	b.sources[num].Active++
+	b.lock.Unlock()
+}
+
+// Done records the result of a query or connection attempt on the given source.
+// Started queries have to be finished by Done.
+func (b *SourceBalancer) Done(num int, started bool, duration time.Duration, err error) {
+	if num < 0 || num >= len(b.sources) {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	source := b.sources[num]
+	if started {
+		source.Active--
+		source.Queries++
+	}
+	if _, ok := err.(*PeerCommandError); err != nil && !ok {
+		source.Healthy = false
+		source.Errors++
+		source.LastError = strings.TrimSpace(err.Error())
+		source.LastErrorTime = time.Now().Unix()
+		return
+	}
+	source.Healthy = true
+	source.LastError = ""
+	source.LastOnline = time.Now().Unix()
+	if source.Latency == 0 {
+		source.Latency = duration.Seconds()
+	} else {
+		source.Latency = (1-SourceLatencyWeight)*source.Latency + SourceLatencyWeight*duration.Seconds()
+	}
+}
+
+// NumHealthy returns the number of healthy sources.
+func (b *SourceBalancer) NumHealthy() (num int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, source := range b.sources {
+		if source.Healthy {
+			num++
+		}
+	}
+	return
+}
+
+// Status returns a copy of the health status of all sources.
+func (b *SourceBalancer) Status() []SourceHealth {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	status := make([]SourceHealth, len(b.sources))
+	for i, source := range b.sources {
+		status[i] = *source
+	}
+	return status
+}
+
+// VirtualColSources returns the health status of all sources of a peer as json
+func VirtualColSources(d *DataRow, _ *Column) interface{} {
+	p := d.DataStore.Peer
+	if p == nil || p.balancer == nil {
+		return "[]"
+	}
+	data, err := json.Marshal(p.balancer.Status())
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSourceBalancerPick(t *testing.T) {
+	b := NewSourceBalancer([]string{"a", "b", "c"})
+
+	// equally rated sources are used round robin
+	picked := []int{}
+	for i := 0; i < 3; i++ {
+		num := b.Pick(nil)
+		picked = append(picked, num)
+		b.Start(num)
+		b.Done(num, true, 10*time.Millisecond, nil)
+	}
+	if err := assertEq([]int{0, 1, 2}, picked); err != nil {
+		t.Error(err)
+	}
+
+	// slow sources are avoided
+	b.Done(0, false, 2*time.Second, nil)
+	b.Done(0, false, 2*time.Second, nil)
+	for i := 0; i < 3; i++ {
+		if err := assertNeq(0, b.Pick(nil)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// running queries count as well
+	b.Start(1)
+	b.Start(1)
+	if err := assertEq(2, b.Pick(nil)); err != nil {
+		t.Error(err)
+	}
+	b.Done(1, true, 10*time.Millisecond, nil)
+	b.Done(1, true, 10*time.Millisecond, nil)
+
+	// failed sources are skipped
+	b.Done(2, false, 0, fmt.Errorf("connection refused"))
+	if err := assertEq(2, b.NumHealthy()); err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := assertEq(1, b.Pick(map[int]bool{0: true})); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// failed sources are still used if nothing else is left
+	if err := assertEq(2, b.Pick(map[int]bool{0: true, 1: true})); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(-1, b.Pick(map[int]bool{0: true, 1: true, 2: true})); err != nil {
+		t.Error(err)
+	}
+
+	// command errors do not affect the source health
+	b.Done(1, false, 0, &PeerCommandError{err: fmt.Errorf("unknown command"), code: 400})
+	status := b.Status()
+	if err := assertEq(true, status[1].Healthy); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(false, status[2].Healthy); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq("connection refused", status[2].LastError); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSourceBalancerPickUpdateSource(t *testing.T) {
+	b := NewSourceBalancer([]string{"a", "b", "c"})
+	b.Done(0, false, 100*time.Millisecond, nil)
+	b.Done(1, false, 80*time.Millisecond, nil)
+
+	// slightly faster sources and sources without measurements do not justify a full update
+	if err := assertEq(0, b.PickUpdateSource(0)); err != nil {
+		t.Error(err)
+	}
+
+	// much faster sources do
+	b.Done(2, false, 10*time.Millisecond, nil)
+	if err := assertEq(2, b.PickUpdateSource(0)); err != nil {
+		t.Error(err)
+	}
+
+	// failed sources are left immediately
+	b.Done(2, false, 0, fmt.Errorf("connection refused"))
+	if err := assertNeq(2, b.PickUpdateSource(2)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSourceBalancerPeer(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	lbPeer := NewPeer(GlobalTestConfig, &Connection{Source: []string{"doesnotexist.sock", "test.sock"}, Name: "Balanced", ID: "balancedid", LoadBalance: true}, TestPeerWaitGroup, make(chan bool))
+	// updates use the current source and fail over to the next one
+	if err := lbPeer.InitAllTables(); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertEq(1, lbPeer.StatusGet(CurPeerAddrNum)); err != nil {
+		t.Error(err)
+	}
+	// status updates stay on the same source, so no restart is detected
+	if err := lbPeer.periodicUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		req := &Request{Table: TableHosts, Columns: []string{"name"}}
+		lbPeer.setQueryOptions(req)
+		res, _, err := lbPeer.queryBalanced(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = assertEq(10, len(res)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := assertEq(PeerStatusUp, lbPeer.StatusGet(PeerState)); err != nil {
+		t.Error(err)
+	}
+	status := lbPeer.balancer.Status()
+	if err := assertEq(false, status[0].Healthy); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(int64(0), status[0].Queries); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(true, status[1].Healthy); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(true, status[1].Queries > 5); err != nil {
+		t.Error(err)
+	}
+
+	// updates move to a much faster source
+	lbPeer.balancer.Done(0, false, time.Nanosecond, nil)
+	lbPeer.Source[0] = "test.sock"
+	lbPeer.StatusSet(LastUpdate, int64(0))
+	if err := lbPeer.periodicUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertEq(0, lbPeer.StatusGet(CurPeerAddrNum)); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(PeerStatusUp, lbPeer.StatusGet(PeerState)); err != nil {
+		t.Error(err)
+	}
+
+	// backends table contains the status of each source
+	res, _, err := peer.QueryString("GET backends\nColumns: sources\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources, ok := res[0][0].([]interface{})
+	if !ok {
+		t.Fatalf("expected list of sources, got: %v", res[0][0])
+	}
+	if err = assertEq(1, len(sources)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(true, sources[0].(map[string]interface{})["healthy"]); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
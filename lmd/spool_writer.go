@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// SpoolWriter keeps written data in memory and moves it into a temporary file
+// once the memory limit is exceeded. It is used to calculate the size of
+// streamed responses before sending them.
+type SpoolWriter struct {
+	noCopy     noCopy
+	Limit      int // maximum number of bytes kept in memory
+	Size       int64
+	buffer     bytes.Buffer
+	file       *os.File
+	fileWriter *bufio.Writer
+}
+
+// NewSpoolWriter creates a new SpoolWriter which keeps up to limit bytes in memory.
+func NewSpoolWriter(limit int) *SpoolWriter {
+	return &SpoolWriter{
+		Limit: limit,
+	}
+}
+
+// Write appends data to the memory buffer or the temporary file.
+func (s *SpoolWriter) Write(p []byte) (written int, err error) {
+	if s.file == nil && s.buffer.Len()+len(p) > s.Limit {
+		s.file, err = ioutil.TempFile("", "lmd-response-")
+		if err != nil {
+			return
+		}
+		s.fileWriter = bufio.NewWriter(s.file)
+		_, err = s.buffer.WriteTo(s.fileWriter)
+		if err != nil {
+			return
+		}
+	}
+	if s.file != nil {
+		written, err = s.fileWriter.Write(p)
+	} else {
+		written, err = s.buffer.Write(p)
+	}
+	s.Size += int64(written)
+	return
+}
+
+// Bytes returns the spooled data if it is still kept in memory.
+func (s *SpoolWriter) Bytes() []byte {
+	if s.file != nil {
+		return nil
+	}
+	return s.buffer.Bytes()
+}
+
+// WriteTo copies all spooled data to the given writer.
+func (s *SpoolWriter) WriteTo(w io.Writer) (written int64, err error) {
+	if s.file == nil {
+		return s.buffer.WriteTo(w)
+	}
+	err = s.fileWriter.Flush()
+	if err != nil {
+		return
+	}
+	_, err = s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return
+	}
+	return io.Copy(w, s.file)
+}
+
+// Close removes the temporary file if there is one.
+func (s *SpoolWriter) Close() (err error) {
+	s.buffer.Reset()
+	if s.file == nil {
+		return
+	}
+	name := s.file.Name()
+	err = s.file.Close()
+	s.file = nil
+	if rErr := os.Remove(name); rErr != nil && err == nil {
+		err = rErr
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSpoolWriter(t *testing.T) {
+	spool := NewSpoolWriter(10)
+	for _, s := range []string{"12345", "67890", "abcde"} {
+		if _, err := spool.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := assertEq(int64(15), spool.Size); err != nil {
+		t.Error(err)
+	}
+	if spool.Bytes() != nil {
+		t.Errorf("data should be spooled to disk")
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := spool.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertEq("1234567890abcde", buf.String()); err != nil {
+		t.Error(err)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
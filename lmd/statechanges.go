@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+// StateChange contains a single state transition of a host or service.
+type StateChange struct {
+	Time               int64  `json:"time"`
+	HostName           string `json:"host_name"`
+	ServiceDescription string `json:"service_description"`
+	OldState           int    `json:"old_state"`
+	State              int    `json:"state"`
+	OldStateType       int    `json:"old_state_type"`
+	StateType          int    `json:"state_type"`
+	OldAcknowledged    int    `json:"old_acknowledged"`
+	Acknowledged       int    `json:"acknowledged"`
+	PluginOutput       string `json:"plugin_output"`
+}
+
+// StateChangeHistory is a ring buffer containing the latest state changes of a peer.
+type StateChangeHistory struct {
+	noCopy  noCopy
+	lock    *deadlock.RWMutex
+	entries []StateChange
+	next    int  // position of the next entry
+	full    bool // flag wether the buffer has been wrapped around
+}
+
+// stateChangeColumns contains the columns used to detect state changes in the hosts or services table.
+type stateChangeColumns struct {
+	hostName     *Column
+	description  *Column
+	state        *Column
+	stateType    *Column
+	acknowledged *Column
+	pluginOutput *Column
+}
+
+// NewStateChangeHistory creates a new history with room for size entries.
+// It returns nil if size is not greater than 0.
+func NewStateChangeHistory(size int) *StateChangeHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &StateChangeHistory{
+		lock:    new(deadlock.RWMutex),
+		entries: make([]StateChange, size),
+	}
+}
+
+// Add appends a state change and overwrites the oldest entry if the history is full.
+func (h *StateChangeHistory) Add(change *StateChange) {
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	h.entries[h.next] = *change
+	h.next++
+	if h.next == len(h.entries) {
+		h.next = 0
+		h.full = true
+	}
+	h.lock.Unlock()
+}
+
+// List returns all state changes in chronological order.
+func (h *StateChangeHistory) List() []StateChange {
+	if h == nil {
+		return nil
+	}
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	list := make([]StateChange, 0, len(h.entries))
+	if h.full {
+		list = append(list, h.entries[h.next:]...)
+	}
+	list = append(list, h.entries[:h.next]...)
+	return list
+}
+
+// newStateChangeColumns returns the columns to detect state changes or nil if
+// the store does not support state changes.
+func newStateChangeColumns(store *DataStore) *stateChangeColumns {
+	cols := &stateChangeColumns{
+		state:        store.GetColumn("state"),
+		stateType:    store.GetColumn("state_type"),
+		acknowledged: store.GetColumn("acknowledged"),
+		pluginOutput: store.GetColumn("plugin_output"),
+	}
+	switch store.Table.Name {
+	case TableHosts:
+		cols.hostName = store.GetColumn("name")
+	case TableServices:
+		cols.hostName = store.GetColumn("host_name")
+		cols.description = store.GetColumn("description")
+	default:
+		return nil
+	}
+	return cols
+}
+
+// values returns the state, state type and acknowledged status of a row
+func (cols *stateChangeColumns) values(row *DataRow) [3]int {
+	return [3]int{row.GetInt(cols.state), row.GetInt(cols.stateType), row.GetInt(cols.acknowledged)}
+}
+
+// Record adds a state change if the values of the updated row differ from the old values.
+func (h *StateChangeHistory) Record(cols *stateChangeColumns, row *DataRow, old [3]int, timestamp int64) {
+	if h == nil || cols == nil {
+		return
+	}
+	cur := cols.values(row)
+	if cur == old {
+		return
+	}
+	change := &StateChange{
+		Time:            timestamp,
+		HostName:        row.GetString(cols.hostName),
+		OldState:        old[0],
+		State:           cur[0],
+		OldStateType:    old[1],
+		StateType:       cur[1],
+		OldAcknowledged: old[2],
+		Acknowledged:    cur[2],
+		PluginOutput:    row.GetString(cols.pluginOutput),
+	}
+	if cols.description != nil {
+		change.ServiceDescription = row.GetString(cols.description)
+	}
+	h.Add(change)
+}
+
+// GetStatechangesStore returns the virtual data for the statechanges table.
+func GetStatechangesStore(table *Table, peer *Peer) *DataStore {
+	if !peer.isOnline() {
+		return nil
+	}
+	store := NewDataStore(table, peer)
+	store.DataSet = peer.data
+	changes := peer.stateChanges.List()
+	data := make(ResultSet, 0, len(changes))
+	for i := range changes {
+		c := &changes[i]
+		data = append(data, []interface{}{c.Time, c.HostName, c.ServiceDescription, c.OldState, c.State, c.OldStateType, c.StateType, c.OldAcknowledged, c.Acknowledged, c.PluginOutput})
+	}
+	_, columns := store.GetInitialColumns()
+	err := store.InsertData(data, columns, false)
+	if err != nil {
+		log.Errorf("store error: %s", err.Error())
+	}
+	return store
+}
+
+// stateChangesFile returns the path of the persisted state changes of the given peer
+func stateChangesFile(dir string, p *Peer) string {
+	return filepath.Join(dir, fmt.Sprintf("statechanges-%s.json", strings.ReplaceAll(p.ID, string(os.PathSeparator), "_")))
+}
+
+// writeStateChanges persists the state change history of a peer into the state directory
+func writeStateChanges(p *Peer, dir string) error {
+	if p.stateChanges == nil {
+		return nil
+	}
+	data, err := json.Marshal(p.stateChanges.List())
+	if err != nil {
+		return err
+	}
+	file := stateChangesFile(dir, p)
+	err = ioutil.WriteFile(file+".tmp", data, DefaultFilePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// restoreStateChanges loads the state change history of a peer from the state directory
+func restoreStateChanges(p *Peer, dir string) error {
+	if p.stateChanges == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(stateChangesFile(dir, p))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	changes := make([]StateChange, 0)
+	err = json.Unmarshal(data, &changes)
+	if err != nil {
+		return err
+	}
+	for i := range changes {
+		p.stateChanges.Add(&changes[i])
+	}
+	return nil
+}
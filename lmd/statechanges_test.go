@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStateChanges(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	PeerMapLock.RLock()
+	p := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+
+	ds, err := p.GetDataStoreSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := ds.Get(TableServices)
+	ds.Lock.RLock()
+	oldState := store.Index2["testhost_1"]["testsvc_1"].GetInt(store.GetColumn("state"))
+	ds.Lock.RUnlock()
+
+	err = updateTestRow(ds, TableServices, []string{"testhost_1", "testsvc_1"}, "state", float64(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// unchanged rows are not recorded
+	err = updateTestRow(ds, TableServices, []string{"testhost_1", "testsvc_1"}, "state", float64(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, _, err := peer.QueryString("GET statechanges\nColumns: host_name service_description old_state state\nOutputFormat: json\n\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(1, len(res)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq([]interface{}{"testhost_1", "testsvc_1", float64(oldState), float64(2)}, res[0]); err != nil {
+		t.Error(err)
+	}
+
+	// ring buffer keeps the latest entries
+	history := NewStateChangeHistory(3)
+	for i := 0; i < 5; i++ {
+		history.Add(&StateChange{Time: int64(i)})
+	}
+	list := history.List()
+	if err = assertEq(3, len(list)); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(int64(2), list[0].Time); err != nil {
+		t.Error(err)
+	}
+	if err = assertEq(int64(4), list[2].Time); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}
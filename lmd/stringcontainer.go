@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
 	"compress/gzip"
-	"io/ioutil"
 )
 
 const DefaultCompressionMinimumSize = 500
@@ -18,6 +16,7 @@ var CompressionLevel = gzip.DefaultCompression
 type StringContainer struct {
 	StringData     string
 	CompressedData []byte
+	Codec          CompressionCodec // codec used to compress the data
 }
 
 // NewStringContainer returns a new StringContainer
@@ -30,29 +29,26 @@ func NewStringContainer(data *string) *StringContainer {
 // Set sets the current string
 func (s *StringContainer) Set(data *string) {
 	// it only makes sense to compress larger strings
-	if len(*data) < CompressionMinimumSize {
+	codec := compressionCodec
+	if len(*data) < CompressionMinimumSize || codec == nil {
 		s.StringData = *data
 		s.CompressedData = nil
+		s.Codec = nil
 		return
 	}
-	s.StringData = ""
-	var b bytes.Buffer
-	gz, _ := gzip.NewWriterLevel(&b, CompressionLevel)
-	_, err := gz.Write([]byte(*data))
-	if err != nil {
-		log.Errorf("gzip error: %s", err.Error())
-		s.StringData = *data
-		s.CompressedData = nil
-		return
-	}
-	err = gz.Close()
-	if err != nil {
-		log.Errorf("gzip error: %s", err.Error())
+	compressed, err := codec.Compress([]byte(*data))
+	if err != nil || len(compressed) == 0 {
+		if err != nil {
+			log.Errorf("%s error: %s", codec.Name(), err.Error())
+		}
 		s.StringData = *data
 		s.CompressedData = nil
+		s.Codec = nil
 		return
 	}
-	s.CompressedData = b.Bytes()
+	s.StringData = ""
+	s.CompressedData = compressed
+	s.Codec = codec
 	if log.IsV(LogVerbosityTrace) {
 		log.Tracef("compressed string from %d to %d (%.1f%%)", len(*data), len(s.CompressedData), 100-(float64(len(s.CompressedData))/float64(len(*data))*100))
 	}
@@ -71,19 +67,21 @@ func (s *StringContainer) StringRef() *string {
 	if s.CompressedData == nil {
 		return &s.StringData
 	}
-	r, err := gzip.NewReader(bytes.NewReader(s.CompressedData))
-	if err != nil {
-		log.Errorf("failed to create gzip reader: %s", err.Error())
-		str := ""
-		return &str
+	cache := stringContainerCache
+	if cache != nil {
+		if str, ok := cache.Get(s.CompressedData); ok {
+			return &str
+		}
 	}
-	b, err := ioutil.ReadAll(r)
-	r.Close()
+	b, err := s.Codec.Decompress(s.CompressedData)
 	if err != nil {
 		log.Errorf("failed to read compressed data: %s", err.Error())
 		str := ""
 		return &str
 	}
 	str := string(b)
+	if cache != nil {
+		cache.Add(s.CompressedData, str)
+	}
 	return &str
 }
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -43,3 +47,183 @@ func TestStringContainerNoCompression(t *testing.T) {
 		t.Fatalf("CompressedData should be nil")
 	}
 }
+
+func TestStringContainerCodecs(t *testing.T) {
+	var teststring strings.Builder
+	for i := range [1000]int{} {
+		teststring.WriteString(fmt.Sprintf("%d x", i))
+	}
+	str := teststring.String()
+
+	dictFile, err := ioutil.TempFile("", "lmd-dict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dictFile.Name())
+	if _, err = dictFile.WriteString("0 x1 x2 x3 x4 x5 x6 x7 x8 x9 x"); err != nil {
+		t.Fatal(err)
+	}
+	dictFile.Close()
+
+	defer func() {
+		compressionCodec = &gzipCodec{}
+		compressionCodecSettings = ""
+	}()
+	for _, name := range []string{"gzip", "deflate", "snappy"} {
+		compressionCodec, err = NewCompressionCodec(name, dictFile.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewStringContainer(&str)
+		if err = assertEq(name, c.Codec.Name()); err != nil {
+			t.Error(err)
+		}
+		if err = assertNeq(nil, c.CompressedData); err != nil {
+			t.Fatal(err)
+		}
+		if err = assertEq(str, c.String()); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	// zstd requires a trained dictionary
+	if _, err = NewCompressionCodec("zstd", dictFile.Name()); err == nil {
+		t.Errorf("expected error for invalid zstd dictionary")
+	}
+	for _, dict := range []string{"", "testdata/zstd.dict"} {
+		compressionCodec, err = NewCompressionCodec("zstd", dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewStringContainer(&str)
+		if err = assertNeq(nil, c.CompressedData); err != nil {
+			t.Fatal(err)
+		}
+		if err = assertEq(str, c.String()); err != nil {
+			t.Errorf("zstd %s: %s", dict, err)
+		}
+	}
+
+	// replaced codecs are closed but still decompress existing values
+	setCompressionCodec("zstd", "")
+	previous := compressionCodec
+	zc := NewStringContainer(&str)
+	setCompressionCodec("zstd", "")
+	if compressionCodec != previous {
+		t.Errorf("codec should not be replaced with unchanged settings")
+	}
+	setCompressionCodec("snappy", "")
+	if !previous.(*zstdCodec).closed {
+		t.Errorf("previous codec should be closed")
+	}
+	if err = assertEq(str, zc.String()); err != nil {
+		t.Error(err)
+	}
+
+	// lz4 only compresses repeated sequences, incompressible data is stored uncompressed
+	compressionCodec, _ = NewCompressionCodec("lz4", "")
+	output := strings.Repeat("OK - load average: 0.01, 0.05, 0.10|load1=0.01;5;10;0\n", 30)
+	c := NewStringContainer(&output)
+	if err = assertEq("lz4", c.Codec.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(output, c.String()); err != nil {
+		t.Error(err)
+	}
+	random := make([]byte, 1000)
+	for i := range random {
+		random[i] = byte(rand.Intn(256))
+	}
+	randomStr := string(random)
+	c = NewStringContainer(&randomStr)
+	if c.CompressedData != nil {
+		t.Errorf("CompressedData should be nil")
+	}
+
+	// values keep their codec after switching
+	c = NewStringContainer(&str)
+	compressionCodec, _ = NewCompressionCodec("none", "")
+	if err = assertEq(str, c.String()); err != nil {
+		t.Error(err)
+	}
+	c = NewStringContainer(&str)
+	if c.CompressedData != nil {
+		t.Errorf("CompressedData should be nil")
+	}
+
+	if _, err = NewCompressionCodec("unknown", ""); err == nil {
+		t.Errorf("expected error for unknown codec")
+	}
+}
+
+func TestStringContainerCache(t *testing.T) {
+	var teststring strings.Builder
+	for i := range [1000]int{} {
+		teststring.WriteString(fmt.Sprintf("%d x", i))
+	}
+	str := teststring.String()
+
+	stringContainerCache = NewStringContainerCache(1)
+	defer func() {
+		stringContainerCache = nil
+	}()
+
+	c1 := NewStringContainer(&str)
+	if err := assertEq(str, c1.String()); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(1, stringContainerCache.Len()); err != nil {
+		t.Error(err)
+	}
+	if cached, ok := stringContainerCache.Get(c1.CompressedData); !ok || cached != str {
+		t.Errorf("string should be cached")
+	}
+
+	// updated values must not return the cached string
+	str2 := str + "changed"
+	c1.Set(&str2)
+	if err := assertEq(str2, c1.String()); err != nil {
+		t.Error(err)
+	}
+	if err := assertEq(1, stringContainerCache.Len()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStringContainerCacheShards(t *testing.T) {
+	cache := NewStringContainerCache(100)
+	if err := assertEq(StringContainerCacheShards, len(cache.shards)); err != nil {
+		t.Error(err)
+	}
+	size := 0
+	for _, s := range cache.shards {
+		size += s.size
+	}
+	if err := assertEq(100, size); err != nil {
+		t.Error(err)
+	}
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := []byte(fmt.Sprintf("%d-%d", i, j))
+				cache.Add(key, string(key))
+				if value, ok := cache.Get(key); ok && value != string(key) {
+					t.Errorf("got wrong value %s for %s", value, key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := assertEq(true, cache.Len() <= 100); err != nil {
+		t.Error(err)
+	}
+
+	// small caches use fewer shards
+	if err := assertEq(3, len(NewStringContainerCache(3).shards)); err != nil {
+		t.Error(err)
+	}
+}
@@ -37,6 +37,7 @@ const (
 	TableHostsbygroup
 	TableServicesbygroup
 	TableServicesbyhostgroup
+	TableStatechanges
 )
 
 // TableNameMapping contains TableName to string mapping
@@ -60,6 +61,7 @@ var TableNameMapping = map[TableName]string{
 	TableHostsbygroup:        "hostsbygroup",
 	TableServicesbygroup:     "servicesbygroup",
 	TableServicesbyhostgroup: "servicesbyhostgroup",
+	TableStatechanges:        "statechanges",
 }
 
 // TableNameLookup is a hash map of string to Table object
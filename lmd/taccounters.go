@@ -0,0 +1,279 @@
+package main
+
+// tacCounterColumns contains the columns used by tactical overview stats queries.
+// Hosts and services are counted by the combination of these values.
+var tacCounterColumns = []string{
+	"state",
+	"state_type",
+	"has_been_checked",
+	"check_type",
+	"acknowledged",
+	"scheduled_downtime_depth",
+	"is_flapping",
+	"active_checks_enabled",
+	"notifications_enabled",
+	"event_handler_enabled",
+	"flap_detection_enabled",
+	"accept_passive_checks",
+	"host_state",
+}
+
+// tacCounterKey contains the values of all counter columns of a single row
+type tacCounterKey [13]int
+
+// TacCounters contains the number of hosts or services for each combination of the tactical overview columns.
+// The counters are updated along with the rows and used to answer stats queries without scanning all rows.
+type TacCounters struct {
+	columns   []*Column
+	positions map[*Column]int
+	state     int // position of the state column
+	hostState int // position of the host_state column or -1
+	counts    map[tacCounterKey]int
+}
+
+// NewTacCounters creates counters for the hosts and services table, it returns nil for all other tables.
+func NewTacCounters(table *Table) *TacCounters {
+	switch table.Name {
+	case TableHosts, TableServices:
+	default:
+		return nil
+	}
+	c := &TacCounters{
+		positions: make(map[*Column]int),
+		state:     -1,
+		hostState: -1,
+	}
+	for _, name := range tacCounterColumns {
+		col, ok := table.ColumnsIndex[name]
+		if !ok || col.DataType != IntCol || col.Optional != NoFlags {
+			continue
+		}
+		switch {
+		case col.StorageType == LocalStore:
+		case col.StorageType == RefStore && col.RefColTableName == TableHosts && name == "host_state":
+			c.hostState = len(c.columns)
+		default:
+			continue
+		}
+		if name == "state" {
+			c.state = len(c.columns)
+		}
+		c.positions[col] = len(c.columns)
+		c.columns = append(c.columns, col)
+	}
+	return c
+}
+
+// isReady returns true if the counters have been built.
+func (c *TacCounters) isReady() bool {
+	return c != nil && c.counts != nil
+}
+
+// key returns the counter key for the given row
+func (c *TacCounters) key(row *DataRow) (key tacCounterKey) {
+	for i, col := range c.columns {
+		if col.StorageType == RefStore && row.Refs[col.RefColTableName] == nil {
+			continue
+		}
+		key[i] = row.GetInt(col)
+	}
+	return
+}
+
+// rebuild counts all rows, it has to be called after the references have been set
+func (c *TacCounters) rebuild(data []*DataRow) {
+	c.counts = make(map[tacCounterKey]int)
+	for _, row := range data {
+		c.counts[c.key(row)]++
+	}
+}
+
+// move changes the counter of a single row from the old to the new key
+func (c *TacCounters) move(oldKey, newKey tacCounterKey) {
+	if oldKey == newKey {
+		return
+	}
+	c.counts[oldKey]--
+	if c.counts[oldKey] <= 0 {
+		delete(c.counts, oldKey)
+	}
+	c.counts[newKey]++
+}
+
+// update changes the counters after the row has been updated. Changed host states are
+// passed to the counters of the services of this host.
+func (c *TacCounters) update(row *DataRow, oldKey tacCounterKey) {
+	newKey := c.key(row)
+	c.move(oldKey, newKey)
+	if row.DataStore.Table.Name != TableHosts || c.state == -1 || oldKey[c.state] == newKey[c.state] {
+		return
+	}
+	ds := row.DataStore.DataSet
+	if ds == nil {
+		return
+	}
+	services := ds.tables[TableServices]
+	if services == nil || !services.TacCounters.isReady() || services.TacCounters.hostState == -1 {
+		return
+	}
+	svcCounters := services.TacCounters
+	for _, svc := range services.Index2[row.GetString(row.DataStore.GetColumn("name"))] {
+		svcKey := svcCounters.key(svc)
+		svcOldKey := svcKey
+		svcOldKey[svcCounters.hostState] = oldKey[c.state]
+		svcCounters.move(svcOldKey, svcKey)
+	}
+}
+
+// supportsFilter returns true if the filter can be answered from the counters
+func (c *TacCounters) supportsFilter(f *Filter) bool {
+	switch f.GroupOperator {
+	case And, Or:
+		for _, sub := range f.Filter {
+			if !c.supportsFilter(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return c.supportsFilterColumn(f)
+}
+
+// supportsFilterColumn returns true if the column and operator of a single filter can be matched against the counters
+func (c *TacCounters) supportsFilterColumn(f *Filter) bool {
+	if f.Column == nil || f.ColumnOptional != NoFlags {
+		return false
+	}
+	if c.isNotEmptyPrimaryKeyFilter(f) {
+		return true
+	}
+	_, ok := c.positions[f.Column]
+	return ok && !f.IsEmpty
+}
+
+// supportsStats returns true if all stats are counters which can be answered from the counters
+func (c *TacCounters) supportsStats(stats []*Filter) bool {
+	for _, s := range stats {
+		switch s.StatsType {
+		case Counter:
+			if !c.supportsFilter(s) {
+				return false
+			}
+		case StatsGroup:
+			// stats groups match their own filter and contain the sub stats
+			if s.GroupOperator == And || s.GroupOperator == Or || !c.supportsFilterColumn(s) {
+				return false
+			}
+			if !c.supportsStats(s.Filter) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isNotEmptyPrimaryKeyFilter returns true for filters like 'description !=' which are often
+// used to count all rows. Primary keys are never empty, so they match every row.
+func (c *TacCounters) isNotEmptyPrimaryKeyFilter(f *Filter) bool {
+	if f.Operator != Unequal || f.StrValue != "" || f.Column.StorageType != LocalStore {
+		return false
+	}
+	for _, name := range f.Column.Table.PrimaryKey {
+		if name == f.Column.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true if the filter matches the rows counted with this key
+func (c *TacCounters) match(f *Filter, key tacCounterKey) bool {
+	switch f.GroupOperator {
+	case And:
+		for _, sub := range f.Filter {
+			if !c.match(sub, key) {
+				return f.Negate
+			}
+		}
+		return !f.Negate
+	case Or:
+		for _, sub := range f.Filter {
+			if c.match(sub, key) {
+				return !f.Negate
+			}
+		}
+		return f.Negate
+	}
+	matched := true
+	if !c.isNotEmptyPrimaryKeyFilter(f) {
+		matched = f.MatchInt(key[c.positions[f.Column]])
+	}
+	if f.Negate {
+		return !matched
+	}
+	return matched
+}
+
+// countStats applies the stats for num rows with the given key, same as DataRow.CountStats
+func (c *TacCounters) countStats(stats []*Filter, key tacCounterKey, num int, result []*Filter) {
+	for i, s := range stats {
+		resultPos := i
+		if s.StatsPos > 0 {
+			resultPos = s.StatsPos
+		}
+		switch s.StatsType {
+		case Counter:
+			if c.match(s, key) {
+				result[resultPos].Stats += float64(num)
+				result[resultPos].StatsCount += num
+			}
+		case StatsGroup:
+			if c.match(s, key) {
+				c.countStats(s.Filter, key, num, result)
+			}
+		}
+	}
+}
+
+// gatherTacCounterResult answers the stats query from the tac counters of the store.
+// It returns false if the query cannot be answered from the counters.
+func (res *Response) gatherTacCounterResult(store *DataStore) (*ResultSetStats, bool) {
+	req := res.Request
+	counters := store.TacCounters
+	if !counters.isReady() || req.AuthUser != "" || req.ChangedSince > 0 || len(req.RequestColumns) > 0 {
+		return nil, false
+	}
+	for _, f := range req.Filter {
+		if !counters.supportsFilter(f) {
+			return nil, false
+		}
+	}
+	stats := req.Stats
+	if req.StatsGrouped != nil {
+		stats = req.StatsGrouped
+	}
+	if !counters.supportsStats(stats) {
+		return nil, false
+	}
+
+	result := NewResultSetStats()
+	var localStats []*Filter
+Keys:
+	for key, num := range counters.counts {
+		result.RowsScanned++
+		for _, f := range req.Filter {
+			if !counters.match(f, key) {
+				continue Keys
+			}
+		}
+		result.Total += num
+		if localStats == nil {
+			localStats = createLocalStatsCopy(req.Stats)
+			result.Stats[""] = localStats
+		}
+		counters.countStats(stats, key, num, localStats)
+	}
+	return result, true
+}
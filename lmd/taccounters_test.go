@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTacCounters(t *testing.T) {
+	peer := StartTestPeer(1, 10, 10)
+	PauseTestPeers(peer)
+
+	PeerMapLock.RLock()
+	p := PeerMap[PeerMapOrder[0]]
+	PeerMapLock.RUnlock()
+
+	ds, err := p.GetDataStoreSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := ds.Get(TableHosts)
+	services := ds.Get(TableServices)
+	if !hosts.TacCounters.isReady() || !services.TacCounters.isReady() {
+		t.Fatal("tac counters have not been created")
+	}
+
+	// change host state, services have to follow the host_state
+	err = updateTestRow(ds, TableHosts, []string{"testhost_1"}, "state", float64(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds.Lock.Lock()
+	for _, store := range []*DataStore{hosts, services} {
+		counts := store.TacCounters.counts
+		store.TacCounters.rebuild(store.Data)
+		if err = assertEq(store.TacCounters.counts, counts); err != nil {
+			t.Errorf("counters of %s differ after update: %s", store.Table.Name.String(), err)
+		}
+	}
+	ds.Lock.Unlock()
+
+	query := strings.ReplaceAll(tacPageStatsQuery, "ResponseHeader: fixed16", "Filter: host_state = 1")
+	res, _, err := peer.QueryString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(float64(1), res[0][0]); err != nil {
+		t.Error(err)
+	}
+
+	// compare with scanning all rows
+	ds.Lock.Lock()
+	services.TacCounters.counts = nil
+	ds.Lock.Unlock()
+	res2, _, err := peer.QueryString(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = assertEq(res2, res); err != nil {
+		t.Error(err)
+	}
+
+	if err := StopTestPeer(peer); err != nil {
+		panic(err.Error())
+	}
+}